@@ -20,6 +20,28 @@ cilium status --wait
 
 # This script installs FluxCD.
 
+# Sealed Secrets in 3-user-space/secrets are decrypted by Flux with an age
+# key kept in ~/.shoulders/age, the same key the shoulders CLI uses.
+ensure_sops_age_secret() {
+    if kubectl -n flux-system get secret sops-age &> /dev/null
+    then
+        return
+    fi
+    local key_file="$HOME/.shoulders/age/age.agekey"
+    if [ ! -f "$key_file" ]
+    then
+        if ! command -v age-keygen &> /dev/null
+        then
+            echo "age-keygen not found; skipping the sops-age Secret. Sealed Secrets will not decrypt."
+            return
+        fi
+        mkdir -p "$(dirname "$key_file")"
+        chmod 700 "$(dirname "$key_file")"
+        age-keygen -o "$key_file"
+    fi
+    kubectl -n flux-system create secret generic sops-age --from-file=age.agekey="$key_file"
+}
+
 if ! command -v flux &> /dev/null
 then
     echo "Flux CLI not found. Installing..."
@@ -37,10 +59,12 @@ then
     echo "Installing FluxCD..."
     cd "$SCRIPT_DIR"
     flux install
+    ensure_sops_age_secret
     kubectl apply -k "profiles/${SHOULDERS_PROFILE}/flux"
 else
     echo "FluxCD already installed. Reconciling..."
     cd "$SCRIPT_DIR"
+    ensure_sops_age_secret
     kubectl apply -k "profiles/${SHOULDERS_PROFILE}/flux"
     flux reconcile source git flux-system
 fi
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/jherreros/shoulders/shoulders-cli/internal/bootstrap"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
 	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -28,7 +30,9 @@ var (
 	appReplicas          int32
 	appDryRun            bool
 	appInternal          bool
+	appGRPC              bool
 	appEnv               []string
+	appExposeTo          []string
 	appEnvFromConfigMaps []string
 	appEnvFromSecrets    []string
 	appSecretMounts      []string
@@ -45,6 +49,7 @@ var (
 	appRunAsUser         int64
 	appApplyFilename     string
 	appImageCluster      string
+	appImagesFromCompose string
 )
 
 var appCmd = &cobra.Command{
@@ -63,6 +68,12 @@ var appInitCmd = &cobra.Command{
 			return err
 		}
 
+		if appHA {
+			appReplicas, err = haReplicas(appReplicas, cmd.Flags().Changed("replicas"))
+			if err != nil {
+				return err
+			}
+		}
 		app, err := buildWebApplication(name, namespace)
 		if err != nil {
 			return err
@@ -81,6 +92,9 @@ var appInitCmd = &cobra.Command{
 			return err
 		}
 		fmt.Printf("WebApplication %s applied in namespace %s\n", name, namespace)
+		if app.Spec.Route != nil && app.Spec.Route.TLS {
+			return syncAppCertificatesAfterChange(cmd.Context())
+		}
 		return nil
 	},
 }
@@ -113,7 +127,8 @@ var appUpdateCmd = &cobra.Command{
 		if !ok {
 			spec = map[string]interface{}{}
 		}
-		changed, err := applyAppFlagOverrides(cmd, name, spec)
+		hadTLS := routeUsesTLS(spec)
+		changed, err := applyAppFlagOverrides(cmd, name, namespace, spec)
 		if err != nil {
 			return err
 		}
@@ -127,6 +142,9 @@ var appUpdateCmd = &cobra.Command{
 			return err
 		}
 		fmt.Printf("WebApplication %s updated in namespace %s\n", name, namespace)
+		if hadTLS || routeUsesTLS(spec) {
+			return syncAppCertificatesAfterChange(cmd.Context())
+		}
 		return nil
 	},
 }
@@ -148,7 +166,10 @@ var appApplyCmd = &cobra.Command{
 			return err
 		}
 		fmt.Printf("Applied manifest %s\n", appApplyFilename)
-		return nil
+		if requestsTLS, err := manifestRequestsTLS(content); err != nil || !requestsTLS {
+			return err
+		}
+		return syncAppCertificatesAfterChange(cmd.Context())
 	},
 }
 
@@ -169,7 +190,7 @@ var appBuildImageCmd = &cobra.Command{
 		if err := bootstrap.BuildLocalImage(cmd.Context(), image, contextPath); err != nil {
 			return err
 		}
-		if err := bootstrap.LoadImageIntoVindCluster(cmd.Context(), clusterName, image); err != nil {
+		if err := loadImagesWithProgress(cmd.Context(), clusterName, []string{image}); err != nil {
 			return err
 		}
 		fmt.Printf("Image %s built and loaded into cluster %s\n", image, clusterName)
@@ -178,19 +199,33 @@ var appBuildImageCmd = &cobra.Command{
 }
 
 var appLoadImageCmd = &cobra.Command{
-	Use:   "load-image <image>",
+	Use:   "load-image [image]",
 	Short: "Load a local Docker image into a vind cluster",
-	Args:  cobra.ExactArgs(1),
+	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if currentConfig.Provider() != config.ProviderVind {
 			return fmt.Errorf("local image loading requires cluster.provider: vind")
 		}
-		image := args[0]
+		images := append([]string(nil), args...)
+		if appImagesFromCompose != "" {
+			content, err := os.ReadFile(appImagesFromCompose)
+			if err != nil {
+				return err
+			}
+			composeImages, err := bootstrap.ComposeImages(content)
+			if err != nil {
+				return err
+			}
+			images = append(images, composeImages...)
+		}
+		if len(images) == 0 {
+			return fmt.Errorf("pass an image or --all-images-from <compose file>")
+		}
 		clusterName := configuredClusterName(cmd, "cluster", appImageCluster)
-		if err := bootstrap.LoadImageIntoVindCluster(cmd.Context(), clusterName, image); err != nil {
+		if err := loadImagesWithProgress(cmd.Context(), clusterName, images); err != nil {
 			return err
 		}
-		fmt.Printf("Image %s loaded into cluster %s\n", image, clusterName)
+		fmt.Printf("Loaded %s into cluster %s\n", strings.Join(images, ", "), clusterName)
 		return nil
 	},
 }
@@ -261,10 +296,17 @@ var appDeleteCmd = &cobra.Command{
 			return err
 		}
 		gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "webapplications"}
+		hadTLS := false
+		if obj, err := dynamicClient.Resource(gvr).Namespace(namespace).Get(cmd.Context(), name, metav1.GetOptions{}); err == nil {
+			hadTLS, _, _ = unstructured.NestedBool(obj.Object, "spec", "route", "tls")
+		}
 		if err := dynamicClient.Resource(gvr).Namespace(namespace).Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
 			return err
 		}
 		fmt.Printf("WebApplication %s deleted in namespace %s\n", name, namespace)
+		if hadTLS {
+			return syncAppCertificatesAfterChange(cmd.Context())
+		}
 		return nil
 	},
 }
@@ -293,7 +335,11 @@ var appDescribeCmd = &cobra.Command{
 			return err
 		}
 		fmt.Println(string(payload))
-		return nil
+		selector := "shoulders.io/webapplication=" + name
+		if err := printContainerStatuses(cmd.Context(), namespace, selector); err != nil {
+			return err
+		}
+		return printPersistentVolumes(cmd.Context(), namespace, selector)
 	},
 }
 
@@ -313,11 +359,31 @@ func buildWebApplication(name, namespace string) (v1alpha1.WebApplication, error
 	if err != nil {
 		return v1alpha1.WebApplication{}, err
 	}
+	configFiles, err := buildConfigFiles(appConfigFiles, appConfigDirs)
+	if err != nil {
+		return v1alpha1.WebApplication{}, err
+	}
+	persistence, err := buildPersistence(appPVCMounts)
+	if err != nil {
+		return v1alpha1.WebApplication{}, err
+	}
+	exposeTo, err := buildExposeTo(namespace, appExposeTo)
+	if err != nil {
+		return v1alpha1.WebApplication{}, err
+	}
 	resources := buildResources()
 	securityContext, err := buildSecurityContext()
 	if err != nil {
 		return v1alpha1.WebApplication{}, err
 	}
+	initContainers, sidecars, err := buildExtraContainers()
+	if err != nil {
+		return v1alpha1.WebApplication{}, err
+	}
+	route, err := buildRouteSpec()
+	if err != nil {
+		return v1alpha1.WebApplication{}, err
+	}
 
 	spec := v1alpha1.WebApplicationSpec{
 		Image:           image,
@@ -325,21 +391,27 @@ func buildWebApplication(name, namespace string) (v1alpha1.WebApplication, error
 		Replicas:        appReplicas,
 		Host:            host,
 		Port:            appPort,
+		Protocol:        appProtocol(),
 		Service:         &v1alpha1.ServiceSpec{Port: appServicePort},
+		Route:           route,
 		Env:             env,
 		EnvFrom:         envFrom,
 		Volumes:         volumes,
 		VolumeMounts:    volumeMounts,
+		ConfigFiles:     configFiles,
+		Persistence:     persistence,
+		ExposeTo:        exposeTo,
 		ReadinessProbe:  buildHTTPProbe(appReadinessPath, appPort),
 		LivenessProbe:   buildHTTPProbe(appLivenessPath, appPort),
 		StartupProbe:    buildHTTPProbe(appStartupPath, appPort),
 		Resources:       resources,
 		SecurityContext: securityContext,
+		InitContainers:  initContainers,
+		Sidecars:        sidecars,
 	}
-	if appInternal {
-		spec.Route = &v1alpha1.RouteSpec{Enabled: boolPtr(false)}
+	if appHA {
+		spec.Availability = haAvailability()
 	}
-
 	return v1alpha1.WebApplication{
 		TypeMeta:   v1alpha1.TypeMeta("WebApplication"),
 		ObjectMeta: v1alpha1.ObjectMeta(name, namespace),
@@ -360,7 +432,7 @@ func applyWebApplication(ctx context.Context, namespace string, content []byte)
 	return kube.Apply(ctx, dynamicClient, gvr, namespace, obj)
 }
 
-func applyAppFlagOverrides(cmd *cobra.Command, name string, spec map[string]interface{}) (bool, error) {
+func applyAppFlagOverrides(cmd *cobra.Command, name, namespace string, spec map[string]interface{}) (bool, error) {
 	changed := false
 	if cmd.Flags().Changed("image") {
 		image, tag := parseImageTag(appImage, appTag)
@@ -382,18 +454,25 @@ func applyAppFlagOverrides(cmd *cobra.Command, name string, spec map[string]inte
 		spec["port"] = appPort
 		changed = true
 	}
+	if cmd.Flags().Changed("grpc") {
+		spec["protocol"] = "http"
+		if appGRPC {
+			spec["protocol"] = "grpc"
+		}
+		changed = true
+	}
 	if cmd.Flags().Changed("service-port") {
 		spec["service"] = map[string]interface{}{"port": appServicePort}
 		changed = true
 	}
 	if cmd.Flags().Changed("host") {
 		spec["host"] = appHost
-		spec["route"] = map[string]interface{}{"enabled": true}
+		setRouteEnabled(spec, true)
 		changed = true
 	}
 	if cmd.Flags().Changed("internal") && appInternal {
 		delete(spec, "host")
-		spec["route"] = map[string]interface{}{"enabled": false}
+		setRouteEnabled(spec, false)
 		changed = true
 	}
 	if cmd.Flags().Changed("env") {
@@ -417,6 +496,32 @@ func applyAppFlagOverrides(cmd *cobra.Command, name string, spec map[string]inte
 		spec["volumeMounts"] = volumeMounts
 		changed = true
 	}
+	configFilesChanged, err := applyConfigFileFlagOverrides(cmd, spec)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || configFilesChanged
+	persistenceChanged, err := applyPersistenceFlagOverrides(cmd, spec)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || persistenceChanged
+	if cmd.Flags().Changed("expose-to") {
+		exposeTo, err := buildExposeTo(namespace, appExposeTo)
+		if err != nil {
+			return false, err
+		}
+		if len(exposeTo) == 0 {
+			delete(spec, "exposeTo")
+		} else {
+			converted := make([]interface{}, 0, len(exposeTo))
+			for _, workspace := range exposeTo {
+				converted = append(converted, workspace)
+			}
+			spec["exposeTo"] = converted
+		}
+		changed = true
+	}
 	if cmd.Flags().Changed("readiness-path") {
 		spec["readinessProbe"] = buildHTTPProbe(appReadinessPath, appPort)
 		changed = true
@@ -441,13 +546,33 @@ func applyAppFlagOverrides(cmd *cobra.Command, name string, spec map[string]inte
 		spec["securityContext"] = securityContext
 		changed = true
 	}
+	containersChanged, err := applyContainerFlagOverrides(cmd.Flags().Changed("init"), cmd.Flags().Changed("sidecar"), spec)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || containersChanged
+	routeChanged, err := applyRouteFlagOverrides(cmd, spec)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || routeChanged
+	if routeChanged || cmd.Flags().Changed("grpc") {
+		if err := validateGRPCRoute(spec); err != nil {
+			return false, err
+		}
+	}
+	availabilityChanged, err := applyAvailabilityFlagOverrides(cmd, spec)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || availabilityChanged
 	if cmd.Flags().Changed("internal") && !appInternal {
 		host := strings.TrimSpace(appHost)
 		if host == "" {
 			host = fmt.Sprintf("%s.local", name)
 		}
 		spec["host"] = host
-		spec["route"] = map[string]interface{}{"enabled": true}
+		setRouteEnabled(spec, true)
 		changed = true
 	}
 	return changed, nil
@@ -472,7 +597,12 @@ func parseEnvVars(entries []string) ([]map[string]interface{}, error) {
 	env := make([]map[string]interface{}, 0, len(entries))
 	for _, entry := range entries {
 		parts := strings.SplitN(entry, "=", 2)
-		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		if len(parts) != 2 {
+			// A bare name is most likely meant for the root --env flag, which
+			// the local container variable flag shadows.
+			return nil, fmt.Errorf("invalid env entry %q, expected KEY=VALUE (select an environment with --environment or -E)", entry)
+		}
+		if strings.TrimSpace(parts[0]) == "" {
 			return nil, fmt.Errorf("invalid env entry %q, expected KEY=VALUE", entry)
 		}
 		env = append(env, map[string]interface{}{
@@ -483,6 +613,31 @@ func parseEnvVars(entries []string) ([]map[string]interface{}, error) {
 	return env, nil
 }
 
+// buildExposeTo validates the workspaces given to --expose-to, dropping
+// duplicates and empty entries.
+func buildExposeTo(namespace string, workspaces []string) ([]string, error) {
+	exposeTo := []string{}
+	seen := map[string]bool{}
+	for _, workspace := range workspaces {
+		workspace = strings.TrimSpace(workspace)
+		if workspace == "" || seen[workspace] {
+			continue
+		}
+		if !volumeNamePattern.MatchString(workspace) {
+			return nil, fmt.Errorf("invalid workspace %q for --expose-to", workspace)
+		}
+		if workspace == namespace {
+			return nil, fmt.Errorf("workspace %s can already reach its own apps", workspace)
+		}
+		seen[workspace] = true
+		exposeTo = append(exposeTo, workspace)
+	}
+	if len(exposeTo) == 0 {
+		return nil, nil
+	}
+	return exposeTo, nil
+}
+
 func buildEnvFrom(configMaps, secrets []string) []map[string]interface{} {
 	envFrom := make([]map[string]interface{}, 0, len(configMaps)+len(secrets))
 	for _, name := range configMaps {
@@ -613,6 +768,37 @@ func buildSecurityContext() (map[string]interface{}, error) {
 	return securityContext, nil
 }
 
+// loadImagesWithProgress loads images into a vind cluster and renders one
+// spinner per node while the imports run.
+func loadImagesWithProgress(ctx context.Context, clusterName string, images []string) error {
+	multi, _ := pterm.DefaultMultiPrinter.Start()
+	defer func() { _, _ = multi.Stop() }()
+
+	var mu sync.Mutex
+	spinners := map[string]*pterm.SpinnerPrinter{}
+	progress := func(node string, state bootstrap.ImageLoadState, detail string) {
+		mu.Lock()
+		defer mu.Unlock()
+		spinner, ok := spinners[node]
+		if !ok {
+			spinner, _ = pterm.DefaultSpinner.WithWriter(multi.NewWriter()).Start(node)
+			spinners[node] = spinner
+		}
+		text := fmt.Sprintf("%s: %s", node, detail)
+		switch state {
+		case bootstrap.ImageLoadSkipped:
+			spinner.Info(text)
+		case bootstrap.ImageLoadDone:
+			spinner.Success(text)
+		case bootstrap.ImageLoadFailed:
+			spinner.Fail(text)
+		default:
+			spinner.UpdateText(text)
+		}
+	}
+	return bootstrap.LoadImagesIntoVindCluster(ctx, clusterName, images, progress)
+}
+
 func optionalNamespace() string {
 	if namespaceOverride != "" {
 		return namespaceOverride
@@ -647,6 +833,7 @@ func init() {
 	appApplyCmd.Flags().StringVarP(&appApplyFilename, "filename", "f", "", "Manifest file to apply")
 	appBuildImageCmd.Flags().StringVar(&appImageCluster, "cluster", "", "Target local vind cluster name")
 	appLoadImageCmd.Flags().StringVar(&appImageCluster, "cluster", "", "Target local vind cluster name")
+	appLoadImageCmd.Flags().StringVar(&appImagesFromCompose, "all-images-from", "", "Load every service image declared in a Docker Compose file")
 
 	registerNamespaceFlag(appInitCmd)
 	registerNamespaceFlag(appUpdateCmd)
@@ -663,12 +850,18 @@ func registerAppSpecFlags(cmd *cobra.Command, requireImage bool) {
 	cmd.Flags().Int32Var(&appPort, "port", 80, "Container port")
 	cmd.Flags().Int32Var(&appServicePort, "service-port", 80, "Kubernetes Service port")
 	cmd.Flags().Int32Var(&appReplicas, "replicas", 1, "Number of replicas")
+	cmd.Flags().BoolVar(&appHA, "ha", false, "Run at least 2 replicas spread across nodes, with a PodDisruptionBudget")
 	cmd.Flags().BoolVar(&appInternal, "internal", false, "Create only an internal Service without an HTTPRoute")
+	cmd.Flags().BoolVar(&appGRPC, "grpc", false, "Serve gRPC: route through a GRPCRoute and probe readiness with the gRPC health service")
+	registerRouteFlags(cmd)
 	cmd.Flags().StringArrayVar(&appEnv, "env", nil, "Environment variable (KEY=VALUE), repeatable")
 	cmd.Flags().StringArrayVar(&appEnvFromConfigMaps, "env-from-configmap", nil, "ConfigMap to expose through envFrom, repeatable")
 	cmd.Flags().StringArrayVar(&appEnvFromSecrets, "env-from-secret", nil, "Secret to expose through envFrom, repeatable")
 	cmd.Flags().StringArrayVar(&appSecretMounts, "secret-mount", nil, "Mount a Secret as a volume (secretName:mountPath[:volumeName]), repeatable")
 	cmd.Flags().StringArrayVar(&appEmptyDirMounts, "empty-dir", nil, "Mount a writable emptyDir volume (name:mountPath), repeatable")
+	registerConfigFileFlags(cmd)
+	registerPersistenceFlags(cmd)
+	cmd.Flags().StringSliceVar(&appExposeTo, "expose-to", nil, "Workspaces whose pods may call the app on its container port (comma-separated, empty to remove)")
 	cmd.Flags().StringVar(&appReadinessPath, "readiness-path", "", "HTTP readiness probe path")
 	cmd.Flags().StringVar(&appLivenessPath, "liveness-path", "", "HTTP liveness probe path")
 	cmd.Flags().StringVar(&appStartupPath, "startup-path", "", "HTTP startup probe path")
@@ -679,6 +872,7 @@ func registerAppSpecFlags(cmd *cobra.Command, requireImage bool) {
 	cmd.Flags().BoolVar(&appReadOnlyRootFS, "read-only-root-filesystem", false, "Set container securityContext.readOnlyRootFilesystem")
 	cmd.Flags().BoolVar(&appRunAsNonRoot, "run-as-non-root", false, "Set container securityContext.runAsNonRoot")
 	cmd.Flags().Int64Var(&appRunAsUser, "run-as-user", -1, "Set container securityContext.runAsUser")
+	registerContainerFlags(cmd)
 	if requireImage {
 		cmd.Flags().BoolVar(&appDryRun, "dry-run", false, "Print YAML instead of applying")
 		if err := cmd.MarkFlagRequired("image"); err != nil {
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/usage"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const defaultCanaryWeight int32 = 10
+
+var (
+	canaryImage        string
+	canaryTag          string
+	canaryWeight       int32
+	canaryReplicas     int32
+	canaryMaxErrorRate float64
+	canaryWindow       time.Duration
+)
+
+var appCanaryCmd = &cobra.Command{
+	Use:   "canary",
+	Short: "Send a share of a WebApplication's traffic to a new image",
+}
+
+var appCanaryStartCmd = &cobra.Command{
+	Use:   "start <name>",
+	Short: "Start a canary release of a WebApplication",
+	Long: "Runs the new image in a separate <name>-canary Deployment next to the current one and " +
+		"sends --weight percent of the route's traffic to it. Starting again replaces the running canary. " +
+		"Apps without an enabled route and a hostname are refused, since the split happens on the route.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateCanaryWeight(canaryWeight); err != nil {
+			return err
+		}
+		image, tag := parseImageTag(canaryImage, canaryTag)
+		canary := map[string]interface{}{
+			"image":  image,
+			"tag":    tag,
+			"weight": int64(canaryWeight),
+		}
+		if cmd.Flags().Changed("replicas") {
+			if canaryReplicas < 0 {
+				return fmt.Errorf("--replicas must not be negative, got %d", canaryReplicas)
+			}
+			canary["replicas"] = int64(canaryReplicas)
+		}
+		return updateCanary(cmd.Context(), args[0], func(spec map[string]interface{}) error {
+			return startCanary(spec, canary)
+		}, func(name, namespace string) string {
+			return fmt.Sprintf("Canary %s:%s started for WebApplication %s in namespace %s with %d%% of traffic", image, tag, name, namespace, canaryWeight)
+		})
+	},
+}
+
+var appCanarySetWeightCmd = &cobra.Command{
+	Use:   "set-weight <name> <weight>",
+	Short: "Change the share of traffic sent to the canary",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		weight, err := parseCanaryWeight(args[1])
+		if err != nil {
+			return err
+		}
+		return updateCanary(cmd.Context(), args[0], func(spec map[string]interface{}) error {
+			canary, err := specCanary(spec)
+			if err != nil {
+				return err
+			}
+			canary["weight"] = int64(weight)
+			return nil
+		}, func(name, namespace string) string {
+			return fmt.Sprintf("Canary of WebApplication %s in namespace %s now receives %d%% of traffic", name, namespace, weight)
+		})
+	},
+}
+
+var appCanaryPromoteCmd = &cobra.Command{
+	Use:   "promote <name>",
+	Short: "Roll the canary image out to the whole WebApplication",
+	Long: "Makes the canary image the WebApplication's image and removes the canary. " +
+		"With --max-error-rate the promotion is refused when the canary's share of 5xx responses " +
+		"over --window, as measured by Hubble in Prometheus, is above the given ratio.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if cmd.Flags().Changed("max-error-rate") {
+			if err := checkCanaryErrorRate(cmd.Context(), name); err != nil {
+				return err
+			}
+		}
+		return updateCanary(cmd.Context(), name, promoteCanary, func(name, namespace string) string {
+			return fmt.Sprintf("Canary of WebApplication %s in namespace %s promoted", name, namespace)
+		})
+	},
+}
+
+var appCanaryAbortCmd = &cobra.Command{
+	Use:   "abort <name>",
+	Short: "Remove the canary and send all traffic back to the current image",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateCanary(cmd.Context(), args[0], func(spec map[string]interface{}) error {
+			if _, err := specCanary(spec); err != nil {
+				return err
+			}
+			delete(spec, "canary")
+			return nil
+		}, func(name, namespace string) string {
+			return fmt.Sprintf("Canary of WebApplication %s in namespace %s aborted", name, namespace)
+		})
+	},
+}
+
+// updateCanary applies edit to the spec of a WebApplication and prints the
+// message built by done once the change is applied.
+func updateCanary(ctx context.Context, name string, edit func(spec map[string]interface{}) error, done func(name, namespace string) string) error {
+	namespace, err := currentNamespace()
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+	gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "webapplications"}
+	obj, err := dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	spec, ok, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		spec = map[string]interface{}{}
+	}
+	if err := edit(spec); err != nil {
+		return fmt.Errorf("webapplication %s: %w", name, err)
+	}
+	if err := unstructured.SetNestedMap(obj.Object, spec, "spec"); err != nil {
+		return err
+	}
+	if err := kube.Apply(ctx, dynamicClient, gvr, namespace, obj); err != nil {
+		return err
+	}
+	fmt.Println(done(name, namespace))
+	return nil
+}
+
+func specCanary(spec map[string]interface{}) (map[string]interface{}, error) {
+	canary, _ := spec["canary"].(map[string]interface{})
+	if canary == nil {
+		return nil, fmt.Errorf("no canary running; start one with shoulders app canary start")
+	}
+	return canary, nil
+}
+
+// startCanary sets canary on spec. The traffic split lives on the app's
+// route, so apps without an enabled route and a hostname are refused rather
+// than running a canary that never receives any of it.
+func startCanary(spec, canary map[string]interface{}) error {
+	if persistence, _ := spec["persistence"].([]interface{}); len(persistence) > 0 {
+		return fmt.Errorf("canary releases are not supported for apps with persistent volumes")
+	}
+	route, _ := spec["route"].(map[string]interface{})
+	if enabled, ok := route["enabled"].(bool); ok && !enabled {
+		return fmt.Errorf("route is disabled, so the canary would receive no traffic; route it again with app update --host")
+	}
+	host, _ := spec["host"].(string)
+	if hosts, _ := route["hosts"].([]interface{}); host == "" && len(hosts) == 0 {
+		return fmt.Errorf("no hostname is routed, so the canary would receive no traffic; set one with app update --host")
+	}
+	spec["canary"] = canary
+	return nil
+}
+
+// promoteCanary moves the canary image and tag to the main container and
+// drops the canary.
+func promoteCanary(spec map[string]interface{}) error {
+	canary, err := specCanary(spec)
+	if err != nil {
+		return err
+	}
+	image, _ := canary["image"].(string)
+	if image == "" {
+		return fmt.Errorf("canary has no image")
+	}
+	spec["image"] = image
+	if tag, _ := canary["tag"].(string); tag != "" {
+		spec["tag"] = tag
+	}
+	delete(spec, "canary")
+	return nil
+}
+
+func validateCanaryWeight(weight int32) error {
+	if weight < 0 || weight > 100 {
+		return fmt.Errorf("canary weight must be between 0 and 100, got %d", weight)
+	}
+	return nil
+}
+
+func parseCanaryWeight(value string) (int32, error) {
+	weight, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid canary weight %q: expected a percentage between 0 and 100", value)
+	}
+	if err := validateCanaryWeight(int32(weight)); err != nil {
+		return 0, err
+	}
+	return int32(weight), nil
+}
+
+// canaryErrorRateQuery returns the share of 5xx responses served by the
+// canary Deployment over window, from the Hubble HTTP metrics.
+func canaryErrorRateQuery(namespace, name string, window time.Duration) string {
+	selector := fmt.Sprintf(`destination_namespace=%q,destination_workload=%q`, namespace, name+"-canary")
+	rangeSelector := fmt.Sprintf("[%s]", promDuration(window))
+	return fmt.Sprintf(`sum(rate(hubble_http_requests_total{%s,status=~"5.."}%s)) / sum(rate(hubble_http_requests_total{%s}%s))`,
+		selector, rangeSelector, selector, rangeSelector)
+}
+
+// promDuration renders d in whole seconds, which Prometheus range selectors
+// always accept.
+func promDuration(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+func checkCanaryErrorRate(ctx context.Context, name string) error {
+	if canaryMaxErrorRate < 0 || canaryMaxErrorRate > 1 {
+		return fmt.Errorf("--max-error-rate must be a ratio between 0 and 1, got %g", canaryMaxErrorRate)
+	}
+	namespace, err := currentNamespace()
+	if err != nil {
+		return err
+	}
+	clientset, err := kube.NewClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+	prometheus := usage.Prometheus{Clientset: clientset}
+	rate, ok, err := prometheus.Value(ctx, canaryErrorRateQuery(namespace, name, canaryWindow))
+	if err != nil {
+		return fmt.Errorf("check canary error rate: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("no HTTP traffic recorded for the canary of %s over the last %s; send it traffic first or promote without --max-error-rate", name, canaryWindow)
+	}
+	if rate > canaryMaxErrorRate {
+		return fmt.Errorf("canary error rate %.2f%% is above the allowed %.2f%%; not promoting", rate*100, canaryMaxErrorRate*100)
+	}
+	fmt.Printf("Canary error rate %.2f%% is within the allowed %.2f%%\n", rate*100, canaryMaxErrorRate*100)
+	return nil
+}
+
+func init() {
+	appCmd.AddCommand(appCanaryCmd)
+	appCanaryCmd.AddCommand(appCanaryStartCmd)
+	appCanaryCmd.AddCommand(appCanarySetWeightCmd)
+	appCanaryCmd.AddCommand(appCanaryPromoteCmd)
+	appCanaryCmd.AddCommand(appCanaryAbortCmd)
+
+	appCanaryStartCmd.Flags().StringVar(&canaryImage, "image", "", "Canary container image (repo or repo:tag)")
+	appCanaryStartCmd.Flags().StringVar(&canaryTag, "tag", "", "Override canary image tag")
+	appCanaryStartCmd.Flags().Int32Var(&canaryWeight, "weight", defaultCanaryWeight, "Percentage of traffic sent to the canary")
+	appCanaryStartCmd.Flags().Int32Var(&canaryReplicas, "replicas", 1, "Number of canary replicas")
+	if err := appCanaryStartCmd.MarkFlagRequired("image"); err != nil {
+		panic(err)
+	}
+	appCanaryPromoteCmd.Flags().Float64Var(&canaryMaxErrorRate, "max-error-rate", 0, "Refuse to promote when the canary's 5xx ratio is above this, for example 0.01")
+	appCanaryPromoteCmd.Flags().DurationVar(&canaryWindow, "window", 5*time.Minute, "Period the canary error rate is measured over")
+
+	registerNamespaceFlag(appCanaryStartCmd)
+	registerNamespaceFlag(appCanarySetWeightCmd)
+	registerNamespaceFlag(appCanaryPromoteCmd)
+	registerNamespaceFlag(appCanaryAbortCmd)
+}
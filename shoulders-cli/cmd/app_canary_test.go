@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCanaryWeight(t *testing.T) {
+	if weight, err := parseCanaryWeight("25"); err != nil || weight != 25 {
+		t.Fatalf("expected 25, got %d, %v", weight, err)
+	}
+	for _, value := range []string{"101", "-1", "ten"} {
+		if _, err := parseCanaryWeight(value); err == nil {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestPromoteCanary(t *testing.T) {
+	spec := map[string]interface{}{
+		"image":    "api",
+		"tag":      "1.0",
+		"replicas": int64(3),
+		"canary":   map[string]interface{}{"image": "api", "tag": "1.1", "weight": int64(10)},
+	}
+	if err := promoteCanary(spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec["tag"] != "1.1" || spec["replicas"] != int64(3) {
+		t.Fatalf("expected the canary tag and existing fields, got %#v", spec)
+	}
+	if _, ok := spec["canary"]; ok {
+		t.Fatalf("expected the canary to be removed, got %#v", spec)
+	}
+	if err := promoteCanary(spec); err == nil {
+		t.Fatalf("expected promoting without a canary to fail")
+	}
+}
+
+func TestCanaryErrorRateQuery(t *testing.T) {
+	query := canaryErrorRateQuery("team-a", "api", 5*time.Minute)
+	if !strings.Contains(query, `destination_workload="api-canary"`) || !strings.Contains(query, `destination_namespace="team-a"`) {
+		t.Fatalf("expected the canary workload selector, got %s", query)
+	}
+	if !strings.Contains(query, `status=~"5.."}[300s]`) {
+		t.Fatalf("expected a 5xx filter over 300s, got %s", query)
+	}
+}
+
+func TestStartCanaryNeedsARoutedHost(t *testing.T) {
+	canary := map[string]interface{}{"image": "api", "tag": "1.1", "weight": int64(10)}
+	for name, spec := range map[string]map[string]interface{}{
+		"internal": {"host": "api.local", "route": map[string]interface{}{"enabled": false}},
+		"no host":  {"route": map[string]interface{}{"enabled": true}},
+		"storage":  {"host": "api.local", "persistence": []interface{}{map[string]interface{}{"name": "data"}}},
+	} {
+		if err := startCanary(spec, canary); err == nil {
+			t.Fatalf("%s: expected the canary to be refused", name)
+		}
+		if _, ok := spec["canary"]; ok {
+			t.Fatalf("%s: expected no canary on a refused start, got %#v", name, spec)
+		}
+	}
+
+	for name, spec := range map[string]map[string]interface{}{
+		"host":       {"host": "api.local"},
+		"extra host": {"route": map[string]interface{}{"hosts": []interface{}{"api.example.com"}}},
+	} {
+		if err := startCanary(spec, canary); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if spec["canary"] == nil {
+			t.Fatalf("%s: expected the canary to be set, got %#v", name, spec)
+		}
+	}
+}
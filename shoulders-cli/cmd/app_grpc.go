@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/pki"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	grpcHealthService string
+	grpcHealthAddress string
+	grpcHealthTimeout time.Duration
+)
+
+var appGRPCHealthCmd = &cobra.Command{
+	Use:   "grpc-health <name>",
+	Short: "Call the gRPC health service of a WebApplication through the gateway",
+	Long: "Calls grpc.health.v1.Health/Check on the app's host through the Gateway, over HTTPS with the " +
+		"local CA when route.tls is set and over cleartext HTTP/2 otherwise. Fails unless the service is SERVING.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		namespace, err := currentNamespace()
+		if err != nil {
+			return err
+		}
+		dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+		if err != nil {
+			return err
+		}
+		gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "webapplications"}
+		obj, err := dynamicClient.Resource(gvr).Namespace(namespace).Get(cmd.Context(), name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		spec, _, err := unstructured.NestedMap(obj.Object, "spec")
+		if err != nil {
+			return err
+		}
+		target, err := grpcHealthTargetFor(name, spec, grpcHealthAddress)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), grpcHealthTimeout)
+		defer cancel()
+		status, err := checkGRPCHealth(ctx, target, grpcHealthService)
+		if err != nil {
+			return fmt.Errorf("check grpc health of %s at %s: %w", name, target.Address, err)
+		}
+		service := grpcHealthService
+		if service == "" {
+			service = "(server)"
+		}
+		fmt.Printf("%s %s via %s: %s\n", name, service, target.Address, status)
+		if status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("grpc health of %s is %s", name, status)
+		}
+		return nil
+	},
+}
+
+// grpcHealthTarget is where and how the health check reaches an app.
+type grpcHealthTarget struct {
+	Host    string
+	Address string
+	TLS     bool
+}
+
+// grpcHealthTargetFor resolves the gateway address of a gRPC WebApplication
+// from its spec, falling back to the first route host when it has no host.
+// address overrides the dialled host:port, for hosts that do not resolve to
+// the gateway; the app's host is still sent as authority.
+func grpcHealthTargetFor(name string, spec map[string]interface{}, address string) (grpcHealthTarget, error) {
+	if protocol, _ := spec["protocol"].(string); protocol != "grpc" {
+		if protocol == "" {
+			protocol = "http"
+		}
+		return grpcHealthTarget{}, fmt.Errorf("webapplication %s serves %s, not grpc; set it with app update %s --grpc", name, protocol, name)
+	}
+	host, _ := spec["host"].(string)
+	route, _ := spec["route"].(map[string]interface{})
+	if hosts, _ := route["hosts"].([]interface{}); host == "" && len(hosts) > 0 {
+		host, _ = hosts[0].(string)
+	}
+	if enabled, ok := route["enabled"].(bool); ok && !enabled {
+		host = ""
+	}
+	if host == "" {
+		return grpcHealthTarget{}, fmt.Errorf("webapplication %s has no route through the gateway", name)
+	}
+	target := grpcHealthTarget{Host: host, TLS: routeUsesTLS(spec)}
+	port := "80"
+	if target.TLS {
+		port = "443"
+	}
+	target.Address = net.JoinHostPort(host, port)
+	if address != "" {
+		target.Address = address
+	}
+	return target, nil
+}
+
+func checkGRPCHealth(ctx context.Context, target grpcHealthTarget, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	creds := insecure.NewCredentials()
+	if target.TLS {
+		roots, err := grpcHealthRootCAs()
+		if err != nil {
+			return healthpb.HealthCheckResponse_UNKNOWN, err
+		}
+		creds = credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: target.Host, MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(target.Address, grpc.WithTransportCredentials(creds), grpc.WithAuthority(target.Host))
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	defer conn.Close()
+
+	response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	return response.GetStatus(), nil
+}
+
+// grpcHealthRootCAs trusts the system roots and, when it exists, the local
+// CA that signs app certificates.
+func grpcHealthRootCAs() (*x509.CertPool, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	dir, err := pki.Dir()
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := os.ReadFile(filepath.Join(dir, pki.CACertFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return roots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("read local ca from %s: no certificates found", dir)
+	}
+	return roots, nil
+}
+
+func init() {
+	appCmd.AddCommand(appGRPCHealthCmd)
+	appGRPCHealthCmd.Flags().StringVar(&grpcHealthService, "service", "", "Health service name to check; empty checks the whole server")
+	appGRPCHealthCmd.Flags().StringVar(&grpcHealthAddress, "address", "", "Dial this host:port instead of the app host, for example 127.0.0.1:80")
+	appGRPCHealthCmd.Flags().DurationVar(&grpcHealthTimeout, "timeout", 5*time.Second, "How long to wait for the health check")
+	registerNamespaceFlag(appGRPCHealthCmd)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestGRPCHealthTargetFor(t *testing.T) {
+	spec := map[string]interface{}{
+		"protocol": "grpc",
+		"host":     "greeter.local",
+		"route":    map[string]interface{}{"tls": true},
+	}
+	target, err := grpcHealthTargetFor("greeter", spec, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.Address != "greeter.local:443" || !target.TLS || target.Host != "greeter.local" {
+		t.Fatalf("unexpected target: %#v", target)
+	}
+
+	target, err = grpcHealthTargetFor("greeter", spec, "127.0.0.1:8443")
+	if err != nil || target.Address != "127.0.0.1:8443" || target.Host != "greeter.local" {
+		t.Fatalf("expected --address to keep the host as authority, got %#v, %v", target, err)
+	}
+
+	if _, err := grpcHealthTargetFor("web", map[string]interface{}{"host": "web.local"}, ""); err == nil {
+		t.Fatalf("expected an http app to be rejected")
+	}
+	internal := map[string]interface{}{"protocol": "grpc", "host": "greeter.local", "route": map[string]interface{}{"enabled": false}}
+	if _, err := grpcHealthTargetFor("greeter", internal, ""); err == nil {
+		t.Fatalf("expected an app without a route to be rejected")
+	}
+	hostsOnly := map[string]interface{}{"protocol": "grpc", "route": map[string]interface{}{"hosts": []interface{}{"greet.example.com", "greet.local"}}}
+	target, err = grpcHealthTargetFor("greeter", hostsOnly, "")
+	if err != nil || target.Address != "greet.example.com:80" {
+		t.Fatalf("expected the first route host, got %#v, %v", target, err)
+	}
+}
+
+func TestCheckGRPCHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("greet.v1.Greeter", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	target := grpcHealthTarget{Host: "greeter.local", Address: listener.Addr().String()}
+	status, err := checkGRPCHealth(ctx, target, "")
+	if err != nil || status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected the server to be SERVING, got %s, %v", status, err)
+	}
+	status, err = checkGRPCHealth(ctx, target, "greet.v1.Greeter")
+	if err != nil || status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("expected the service to be NOT_SERVING, got %s, %v", status, err)
+	}
+}
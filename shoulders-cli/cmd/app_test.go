@@ -1,6 +1,11 @@
 package cmd
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
 
 func TestParseImageTag(t *testing.T) {
 	image, tag := parseImageTag("nginx:1.26", "")
@@ -34,6 +39,47 @@ func TestParseEnvVars(t *testing.T) {
 	}
 }
 
+func TestParseEnvVarsPointsEnvironmentNamesToEnvironmentFlag(t *testing.T) {
+	_, err := parseEnvVars([]string{"staging"})
+	if err == nil || !strings.Contains(err.Error(), "--environment") {
+		t.Fatalf("expected a bare name to point at --environment, got %v", err)
+	}
+}
+
+func TestEnvironmentFlagIsNotShadowedByContainerEnv(t *testing.T) {
+	for _, command := range []*cobra.Command{appInitCmd, appUpdateCmd, workloadWorkerCmd, workloadJobCmd, workloadCronCmd} {
+		if command.LocalFlags().Lookup("env") == nil {
+			t.Fatalf("expected %s to define --env for container variables", command.CommandPath())
+		}
+		if command.LocalFlags().Lookup("environment") != nil || command.LocalFlags().ShorthandLookup("E") != nil {
+			t.Fatalf("expected %s not to shadow the root --environment/-E flag", command.CommandPath())
+		}
+		flag := command.InheritedFlags().Lookup("environment")
+		if flag == nil || flag.Shorthand != "E" {
+			t.Fatalf("expected %s to inherit --environment/-E, got %#v", command.CommandPath(), flag)
+		}
+	}
+}
+
+func TestBuildExposeTo(t *testing.T) {
+	exposeTo, err := buildExposeTo("team-a", []string{"team-b", " team-c", "team-b", ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(exposeTo) != 2 || exposeTo[0] != "team-b" || exposeTo[1] != "team-c" {
+		t.Fatalf("expected deduplicated workspaces, got %#v", exposeTo)
+	}
+	if exposeTo, err := buildExposeTo("team-a", []string{""}); err != nil || exposeTo != nil {
+		t.Fatalf("expected an empty value to clear exposeTo, got %#v (%v)", exposeTo, err)
+	}
+	if _, err := buildExposeTo("team-a", []string{"team-a"}); err == nil {
+		t.Fatalf("expected exposing an app to its own workspace to fail")
+	}
+	if _, err := buildExposeTo("team-a", []string{"Team_B"}); err == nil {
+		t.Fatalf("expected an invalid workspace name to fail")
+	}
+}
+
 func TestBuildVolumesAndMounts(t *testing.T) {
 	volumes, mounts, err := buildVolumesAndMounts([]string{"jwt-secret:/keys:jwt"}, []string{"tmp:/tmp"})
 	if err != nil {
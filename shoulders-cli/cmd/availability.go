@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// haMinReplicas is the replica count --ha starts from, the least that
+// survives a node drain.
+const haMinReplicas int32 = 2
+
+var appHA bool
+
+// haAvailability is what --ha turns on: one pod down at a time during drains,
+// and replicas preferably on different nodes. Both stay soft so apps still
+// schedule on single-node clusters.
+func haAvailability() *v1alpha1.AvailabilitySpec {
+	maxUnavailable := intstr.FromInt32(1)
+	return &v1alpha1.AvailabilitySpec{
+		MaxUnavailable: &maxUnavailable,
+		Spread:         "soft",
+		AntiAffinity:   "soft",
+	}
+}
+
+// haReplicas raises the default replica count to haMinReplicas and rejects
+// an explicit count below it.
+func haReplicas(replicas int32, explicit bool) (int32, error) {
+	if replicas >= haMinReplicas {
+		return replicas, nil
+	}
+	if explicit {
+		return 0, fmt.Errorf("--ha needs at least %d replicas, got --replicas %d", haMinReplicas, replicas)
+	}
+	return haMinReplicas, nil
+}
+
+// applyAvailabilityFlagOverrides turns --ha on or off on an unstructured spec.
+func applyAvailabilityFlagOverrides(cmd *cobra.Command, spec map[string]interface{}) (bool, error) {
+	if !cmd.Flags().Changed("ha") {
+		return false, nil
+	}
+	if !appHA {
+		delete(spec, "availability")
+		return true, nil
+	}
+	current, _ := spec["replicas"].(int64)
+	if cmd.Flags().Changed("replicas") {
+		current = int64(appReplicas)
+	}
+	replicas, err := haReplicas(int32(current), cmd.Flags().Changed("replicas"))
+	if err != nil {
+		return false, err
+	}
+	availability, err := runtime.DefaultUnstructuredConverter.ToUnstructured(haAvailability())
+	if err != nil {
+		return false, err
+	}
+	spec["replicas"] = int64(replicas)
+	spec["availability"] = availability
+	return true, nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestHAReplicas(t *testing.T) {
+	if replicas, err := haReplicas(1, false); err != nil || replicas != 2 {
+		t.Fatalf("expected the default to be raised to 2, got %d, %v", replicas, err)
+	}
+	if replicas, err := haReplicas(3, true); err != nil || replicas != 3 {
+		t.Fatalf("expected 3 replicas to be kept, got %d, %v", replicas, err)
+	}
+	if _, err := haReplicas(1, true); err == nil {
+		t.Fatalf("expected --ha with --replicas 1 to fail")
+	}
+}
+
+func TestApplyAvailabilityFlagOverrides(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().BoolVar(&appHA, "ha", false, "")
+	cmd.Flags().Int32Var(&appReplicas, "replicas", 1, "")
+	if err := cmd.Flags().Set("ha", "true"); err != nil {
+		t.Fatalf("set flag: %v", err)
+	}
+	defer func() { appHA, appReplicas = false, 1 }()
+
+	spec := map[string]interface{}{"replicas": int64(1)}
+	changed, err := applyAvailabilityFlagOverrides(cmd, spec)
+	if err != nil || !changed {
+		t.Fatalf("expected a change, got %t, %v", changed, err)
+	}
+	availability := spec["availability"].(map[string]interface{})
+	if spec["replicas"] != int64(2) || availability["maxUnavailable"] != int64(1) || availability["antiAffinity"] != "soft" {
+		t.Fatalf("unexpected spec: %#v", spec)
+	}
+
+	if err := cmd.Flags().Set("ha", "false"); err != nil {
+		t.Fatalf("set flag: %v", err)
+	}
+	if _, err := applyAvailabilityFlagOverrides(cmd, spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := spec["availability"]; ok {
+		t.Fatalf("expected --ha=false to remove availability, got %#v", spec)
+	}
+}
@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	bindingKindStateStore  = "StateStore"
+	bindingKindEventStream = "EventStream"
+)
+
+// envVarNamePattern matches the prefixes the binding schema accepts.
+var envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var (
+	bindKind      string
+	bindEnvPrefix string
+	bindDatabase  string
+	bindBucket    string
+	bindTopics    []string
+)
+
+var appBindCmd = &cobra.Command{
+	Use:   "bind <app> <statestore|eventstream>",
+	Short: "Inject connection settings for a StateStore or EventStream into a WebApplication",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return bindInfra(cmd, "webapplications", "WebApplication", args[0], args[1])
+	},
+}
+
+var appUnbindCmd = &cobra.Command{
+	Use:   "unbind <app> <statestore|eventstream>",
+	Short: "Remove a StateStore or EventStream binding from a WebApplication",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return unbindInfra(cmd.Context(), "webapplications", "WebApplication", args[0], args[1])
+	},
+}
+
+var workloadBindCmd = &cobra.Command{
+	Use:   "bind <workload> <statestore|eventstream>",
+	Short: "Inject connection settings for a StateStore or EventStream into a Workload",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return bindInfra(cmd, "workloads", "Workload", args[0], args[1])
+	},
+}
+
+var workloadUnbindCmd = &cobra.Command{
+	Use:   "unbind <workload> <statestore|eventstream>",
+	Short: "Remove a StateStore or EventStream binding from a Workload",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return unbindInfra(cmd.Context(), "workloads", "Workload", args[0], args[1])
+	},
+}
+
+func bindInfra(cmd *cobra.Command, resource, kind, name, infra string) error {
+	ctx := cmd.Context()
+	namespace, err := currentNamespace()
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+	binding, err := resolveBinding(ctx, dynamicClient, namespace, infra)
+	if err != nil {
+		return err
+	}
+	if err := applyBindFlags(cmd, &binding); err != nil {
+		return err
+	}
+
+	gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: resource}
+	obj, err := dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	spec, ok, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		spec = map[string]interface{}{}
+	}
+	if err := setBinding(spec, binding); err != nil {
+		return err
+	}
+	if err := unstructured.SetNestedMap(obj.Object, spec, "spec"); err != nil {
+		return err
+	}
+	if err := kube.Apply(ctx, dynamicClient, gvr, namespace, obj); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s bound to %s %s in namespace %s\n", kind, name, binding.Kind, binding.Name, namespace)
+	fmt.Printf("Environment: %s\n", strings.Join(bindingEnvNames(binding), ", "))
+	return nil
+}
+
+func unbindInfra(ctx context.Context, resource, kind, name, infra string) error {
+	namespace, err := currentNamespace()
+	if err != nil {
+		return err
+	}
+	dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+	if err != nil {
+		return err
+	}
+	gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: resource}
+	obj, err := dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	spec, _, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return err
+	}
+	if !removeBinding(spec, infra, bindKind) {
+		return fmt.Errorf("%s %s has no binding to %s", kind, name, infra)
+	}
+	if err := unstructured.SetNestedMap(obj.Object, spec, "spec"); err != nil {
+		return err
+	}
+	if err := kube.Apply(ctx, dynamicClient, gvr, namespace, obj); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s unbound from %s in namespace %s\n", kind, name, infra, namespace)
+	return nil
+}
+
+// resolveBinding looks infra up as a StateStore and an EventStream, or only
+// as --kind, and describes what it offers.
+func resolveBinding(ctx context.Context, client dynamic.Interface, namespace, infra string) (v1alpha1.BindingSpec, error) {
+	kinds := []string{bindingKindStateStore, bindingKindEventStream}
+	if bindKind != "" {
+		kind, err := normalizeBindingKind(bindKind)
+		if err != nil {
+			return v1alpha1.BindingSpec{}, err
+		}
+		kinds = []string{kind}
+	}
+	var found []v1alpha1.BindingSpec
+	for _, kind := range kinds {
+		resource := "statestores"
+		if kind == bindingKindEventStream {
+			resource = "eventstreams"
+		}
+		gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: resource}
+		obj, err := client.Resource(gvr).Namespace(namespace).Get(ctx, infra, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return v1alpha1.BindingSpec{}, err
+		}
+		spec, _, err := unstructured.NestedMap(obj.Object, "spec")
+		if err != nil {
+			return v1alpha1.BindingSpec{}, err
+		}
+		if kind == bindingKindEventStream {
+			found = append(found, bindingFromEventStream(infra, spec))
+		} else {
+			binding, err := bindingFromStateStore(infra, spec, bindBucket)
+			if err != nil {
+				return v1alpha1.BindingSpec{}, err
+			}
+			found = append(found, binding)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return v1alpha1.BindingSpec{}, fmt.Errorf("no %s named %s in namespace %s", strings.Join(kinds, " or "), infra, namespace)
+	case 1:
+		return found[0], nil
+	default:
+		return v1alpha1.BindingSpec{}, fmt.Errorf("both a StateStore and an EventStream are named %s; pick one with --kind", infra)
+	}
+}
+
+func normalizeBindingKind(kind string) (string, error) {
+	switch strings.ToLower(kind) {
+	case "statestore", "db":
+		return bindingKindStateStore, nil
+	case "eventstream", "stream":
+		return bindingKindEventStream, nil
+	default:
+		return "", fmt.Errorf("unsupported binding kind %q (supported: StateStore, EventStream)", kind)
+	}
+}
+
+// bindingFromStateStore binds the services a StateStore has enabled. A
+// single bucket is bound by default; with several, bucket picks one.
+func bindingFromStateStore(name string, spec map[string]interface{}, bucket string) (v1alpha1.BindingSpec, error) {
+	binding := v1alpha1.BindingSpec{Kind: bindingKindStateStore, Name: name}
+	postgresql, _, _ := unstructured.NestedMap(spec, "postgresql")
+	postgresEnabled, _, _ := unstructured.NestedBool(postgresql, "enabled")
+	binding.PostgreSQL = boolPtr(postgresEnabled)
+	if postgresEnabled {
+		binding.SecretName, _, _ = unstructured.NestedString(postgresql, "secretName")
+		binding.Database, _, _ = unstructured.NestedString(postgresql, "database")
+	}
+	binding.Redis, _, _ = unstructured.NestedBool(spec, "redis", "enabled")
+	var buckets []interface{}
+	if enabled, _, _ := unstructured.NestedBool(spec, "objectStorage", "enabled"); enabled {
+		buckets, _, _ = unstructured.NestedSlice(spec, "objectStorage", "buckets")
+	}
+	for _, entry := range buckets {
+		candidate, _ := entry.(map[string]interface{})
+		candidateName, _ := candidate["name"].(string)
+		if (bucket == "" && len(buckets) == 1) || candidateName == bucket {
+			binding.Bucket = candidateName
+			binding.BucketSecretName, _ = candidate["secretName"].(string)
+		}
+	}
+	if bucket != "" && binding.Bucket == "" {
+		return v1alpha1.BindingSpec{}, fmt.Errorf("StateStore %s has no bucket %s", name, bucket)
+	}
+	return binding, nil
+}
+
+// bindingFromEventStream binds the bootstrap servers and every topic.
+func bindingFromEventStream(name string, spec map[string]interface{}) v1alpha1.BindingSpec {
+	binding := v1alpha1.BindingSpec{Kind: bindingKindEventStream, Name: name}
+	topics, _, _ := unstructured.NestedSlice(spec, "topics")
+	for _, entry := range topics {
+		topic, _ := entry.(map[string]interface{})
+		if topicName, _ := topic["name"].(string); topicName != "" {
+			binding.Topics = append(binding.Topics, topicName)
+		}
+	}
+	return binding
+}
+
+func applyBindFlags(cmd *cobra.Command, binding *v1alpha1.BindingSpec) error {
+	binding.EnvPrefix = strings.TrimSpace(bindEnvPrefix)
+	if binding.EnvPrefix != "" && !envVarNamePattern.MatchString(binding.EnvPrefix) {
+		return fmt.Errorf("invalid --env-prefix %q: use letters, digits and underscores", binding.EnvPrefix)
+	}
+	if binding.Kind == bindingKindEventStream {
+		if anyFlagChanged(cmd, "database", "bucket") {
+			return fmt.Errorf("--database and --bucket apply to StateStores only")
+		}
+		if cmd.Flags().Changed("topic") {
+			binding.Topics = parseList(strings.Join(bindTopics, ","))
+		}
+		return nil
+	}
+	if cmd.Flags().Changed("topic") {
+		return fmt.Errorf("--topic applies to EventStreams only")
+	}
+	if cmd.Flags().Changed("database") {
+		if binding.PostgreSQL == nil || !*binding.PostgreSQL {
+			return fmt.Errorf("StateStore %s has no PostgreSQL database", binding.Name)
+		}
+		binding.Database = bindDatabase
+	}
+	return nil
+}
+
+// setBinding adds binding to an unstructured spec, replacing an earlier
+// binding to the same StateStore or EventStream. Another binding of the same
+// kind and env prefix is refused, since both would inject the same variables.
+func setBinding(spec map[string]interface{}, binding v1alpha1.BindingSpec) error {
+	converted, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&binding)
+	if err != nil {
+		return err
+	}
+	existing, _ := spec["bindings"].([]interface{})
+	for _, entry := range existing {
+		current, _ := entry.(map[string]interface{})
+		prefix, _ := current["envPrefix"].(string)
+		if current["kind"] != binding.Kind || current["name"] == binding.Name || prefix != binding.EnvPrefix {
+			continue
+		}
+		if prefix == "" {
+			return fmt.Errorf("%s %s is already bound without a prefix; bind %s with --env-prefix", binding.Kind, current["name"], binding.Name)
+		}
+		return fmt.Errorf("%s %s is already bound with prefix %s; bind %s with another --env-prefix", binding.Kind, current["name"], prefix, binding.Name)
+	}
+	bindings := make([]interface{}, 0, len(existing)+1)
+	replaced := false
+	for _, entry := range existing {
+		current, _ := entry.(map[string]interface{})
+		if current["kind"] == binding.Kind && current["name"] == binding.Name {
+			if !replaced {
+				bindings = append(bindings, converted)
+				replaced = true
+			}
+			continue
+		}
+		bindings = append(bindings, entry)
+	}
+	if !replaced {
+		bindings = append(bindings, converted)
+	}
+	spec["bindings"] = bindings
+	return nil
+}
+
+// removeBinding drops the bindings to name, of kind when it is set, and
+// reports whether there were any.
+func removeBinding(spec map[string]interface{}, name, kind string) bool {
+	if kind != "" {
+		if normalized, err := normalizeBindingKind(kind); err == nil {
+			kind = normalized
+		}
+	}
+	existing, _ := spec["bindings"].([]interface{})
+	bindings := make([]interface{}, 0, len(existing))
+	for _, entry := range existing {
+		current, _ := entry.(map[string]interface{})
+		if current["name"] == name && (kind == "" || current["kind"] == kind) {
+			continue
+		}
+		bindings = append(bindings, entry)
+	}
+	if len(bindings) == len(existing) {
+		return false
+	}
+	if len(bindings) == 0 {
+		delete(spec, "bindings")
+	} else {
+		spec["bindings"] = bindings
+	}
+	return true
+}
+
+// bindingEnvNames lists the variables the compositions inject for binding.
+func bindingEnvNames(binding v1alpha1.BindingSpec) []string {
+	var names []string
+	if binding.Kind == bindingKindEventStream {
+		names = append(names, "KAFKA_BOOTSTRAP_SERVERS")
+		for _, topic := range binding.Topics {
+			names = append(names, "KAFKA_TOPIC_"+strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(topic)))
+		}
+	} else {
+		if binding.PostgreSQL == nil || *binding.PostgreSQL {
+			names = append(names, "PGHOST", "PGPORT", "PGDATABASE", "PGUSER", "PGPASSWORD", "DATABASE_URL")
+		}
+		if binding.Redis {
+			names = append(names, "REDIS_HOST", "REDIS_PORT", "REDIS_URL")
+		}
+		if binding.Bucket != "" {
+			names = append(names, "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "S3_BUCKET", "S3_ENDPOINT", "S3_REGION")
+		}
+	}
+	for index := range names {
+		names[index] = binding.EnvPrefix + names[index]
+	}
+	return names
+}
+
+func registerBindFlags(bind, unbind *cobra.Command) {
+	bind.Flags().StringVar(&bindKind, "kind", "", "Bind a StateStore or an EventStream when both share the name")
+	bind.Flags().StringVar(&bindEnvPrefix, "env-prefix", "", "Prefix for the injected variable names, for example ORDERS_")
+	bind.Flags().StringVar(&bindDatabase, "database", "", "PostgreSQL database to connect to (default: the StateStore's main database)")
+	bind.Flags().StringVar(&bindBucket, "bucket", "", "Object storage bucket to inject S3 settings for")
+	bind.Flags().StringArrayVar(&bindTopics, "topic", nil, "Topic to inject a KAFKA_TOPIC_* variable for, repeatable (default: every topic)")
+	unbind.Flags().StringVar(&bindKind, "kind", "", "Only remove the StateStore or EventStream binding")
+	registerNamespaceFlag(bind)
+	registerNamespaceFlag(unbind)
+}
+
+func init() {
+	appCmd.AddCommand(appBindCmd)
+	appCmd.AddCommand(appUnbindCmd)
+	workloadCmd.AddCommand(workloadBindCmd)
+	workloadCmd.AddCommand(workloadUnbindCmd)
+	registerBindFlags(appBindCmd, appUnbindCmd)
+	registerBindFlags(workloadBindCmd, workloadUnbindCmd)
+}
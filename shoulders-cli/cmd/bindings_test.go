@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+)
+
+func TestBindingFromStateStore(t *testing.T) {
+	spec := map[string]interface{}{
+		"postgresql": map[string]interface{}{"enabled": true, "secretName": "orders-creds", "database": "orders"},
+		"redis":      map[string]interface{}{"enabled": false},
+		"objectStorage": map[string]interface{}{
+			"enabled": true,
+			"buckets": []interface{}{
+				map[string]interface{}{"name": "uploads", "secretName": "uploads-creds"},
+				map[string]interface{}{"name": "exports"},
+			},
+		},
+	}
+	binding, err := bindingFromStateStore("orders", spec, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if binding.PostgreSQL == nil || !*binding.PostgreSQL || binding.SecretName != "orders-creds" || binding.Database != "orders" {
+		t.Fatalf("unexpected postgres binding: %#v", binding)
+	}
+	if binding.Redis || binding.Bucket != "" {
+		t.Fatalf("expected no redis and no bucket without --bucket, got %#v", binding)
+	}
+
+	binding, err = bindingFromStateStore("orders", spec, "uploads")
+	if err != nil || binding.Bucket != "uploads" || binding.BucketSecretName != "uploads-creds" {
+		t.Fatalf("expected the uploads bucket, got %#v, %v", binding, err)
+	}
+	if _, err := bindingFromStateStore("orders", spec, "missing"); err == nil {
+		t.Fatalf("expected an unknown bucket to fail")
+	}
+}
+
+func TestSetAndRemoveBinding(t *testing.T) {
+	spec := map[string]interface{}{
+		"bindings": []interface{}{
+			map[string]interface{}{"kind": "StateStore", "name": "orders"},
+			map[string]interface{}{"kind": "EventStream", "name": "events", "topics": []interface{}{"a"}},
+		},
+	}
+	if err := setBinding(spec, v1alpha1.BindingSpec{Kind: "EventStream", Name: "events", Topics: []string{"a", "b"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bindings := spec["bindings"].([]interface{})
+	if len(bindings) != 2 {
+		t.Fatalf("expected the events binding to be replaced, got %#v", bindings)
+	}
+	if topics := bindings[1].(map[string]interface{})["topics"]; !reflect.DeepEqual(topics, []interface{}{"a", "b"}) {
+		t.Fatalf("unexpected topics: %#v", topics)
+	}
+
+	if err := setBinding(spec, v1alpha1.BindingSpec{Kind: "StateStore", Name: "billing"}); err == nil {
+		t.Fatalf("expected a second unprefixed StateStore binding to be refused")
+	}
+	if err := setBinding(spec, v1alpha1.BindingSpec{Kind: "StateStore", Name: "billing", EnvPrefix: "BILLING_"}); err != nil {
+		t.Fatalf("expected a prefixed binding to be accepted: %v", err)
+	}
+	if err := setBinding(spec, v1alpha1.BindingSpec{Kind: "StateStore", Name: "ledger", EnvPrefix: "BILLING_"}); err == nil {
+		t.Fatalf("expected a binding reusing a prefix to be refused")
+	}
+	if !removeBinding(spec, "billing", "") {
+		t.Fatalf("expected the billing binding to be removed")
+	}
+
+	if removeBinding(spec, "orders", "EventStream") {
+		t.Fatalf("expected --kind to limit which bindings are removed")
+	}
+	if !removeBinding(spec, "orders", "") || !removeBinding(spec, "events", "stream") {
+		t.Fatalf("expected both bindings to be removed")
+	}
+	if _, ok := spec["bindings"]; ok {
+		t.Fatalf("expected an empty bindings list to be dropped, got %#v", spec)
+	}
+}
+
+func TestBindingEnvNames(t *testing.T) {
+	names := bindingEnvNames(v1alpha1.BindingSpec{Kind: "EventStream", Name: "events", EnvPrefix: "EV_", Topics: []string{"order-created"}})
+	if !reflect.DeepEqual(names, []string{"EV_KAFKA_BOOTSTRAP_SERVERS", "EV_KAFKA_TOPIC_ORDER_CREATED"}) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+	names = bindingEnvNames(v1alpha1.BindingSpec{Kind: "StateStore", Name: "cache", PostgreSQL: boolPtr(false), Redis: true})
+	if !reflect.DeepEqual(names, []string{"REDIS_HOST", "REDIS_PORT", "REDIS_URL"}) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+}
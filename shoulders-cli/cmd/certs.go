@@ -0,0 +1,430 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/pki"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// App certificates are Secrets next to the shared Gateway, so its HTTPS
+// listeners reference them without a ReferenceGrant.
+const (
+	appGatewayName        = "cilium-gateway"
+	appGatewayNamespace   = "kube-system"
+	appCertFieldManager   = "shoulders-certs"
+	appCertLabel          = "shoulders.io/app-tls"
+	appCertHostAnnotation = "shoulders.io/tls-host"
+	// appCASecret holds the CA shared by everyone syncing certificates
+	// against the cluster.
+	appCASecret = "shoulders-local-ca"
+)
+
+var gatewayGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+
+var certsExportFile string
+
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Manage the local CA that serves WebApplication routes over HTTPS",
+	Long: "WebApplications with route.tls get a certificate for each of their hosts from a CA stored in the " + appCASecret + " Secret in kube-system " +
+		"and copied to ~/.shoulders/pki. The certificates are stored as Secrets in kube-system and served by HTTPS listeners on the shared Gateway.",
+}
+
+var certsExportCACmd = &cobra.Command{
+	Use:   "export-ca",
+	Short: "Print the cluster's CA certificate so browsers and tools can trust it",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clientset, err := kube.NewClientset(kubeconfig)
+		if err != nil {
+			return err
+		}
+		dir, err := pki.Dir()
+		if err != nil {
+			return err
+		}
+		ca, err := clusterCA(cmd.Context(), clientset.CoreV1().Secrets(appGatewayNamespace), dir)
+		if err != nil {
+			return err
+		}
+		if certsExportFile == "" {
+			fmt.Print(string(ca.CertPEM))
+			return nil
+		}
+		if err := os.WriteFile(certsExportFile, ca.CertPEM, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s (SHA-256 %s)\n", certsExportFile, ca.Fingerprint())
+		fmt.Println("Import it as a trusted root certificate authority in your browser or OS keychain.")
+		return nil
+	},
+}
+
+var certsSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Issue certificates and Gateway listeners for every WebApplication with route.tls",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+		result, err := syncAppCertificates(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if format != output.Table {
+			payload, err := output.Render(result, format)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(payload))
+			return nil
+		}
+		if len(result.Hosts) == 0 && len(result.Removed) == 0 {
+			fmt.Println("No WebApplications request TLS")
+			return nil
+		}
+		rows := make([][]string, 0, len(result.Hosts)+len(result.Removed))
+		for _, host := range result.Hosts {
+			rows = append(rows, []string{host.Host, strings.Join(host.Namespaces, ","), host.Secret, host.Action})
+		}
+		for _, host := range result.Removed {
+			rows = append(rows, []string{host, "", "", "removed"})
+		}
+		return output.PrintTable([]string{"Host", "Namespaces", "Secret", "Action"}, rows)
+	},
+}
+
+// appCertificate is one HTTPS host served by the Gateway.
+type appCertificate struct {
+	Host       string   `json:"host"`
+	Namespaces []string `json:"namespaces"`
+	Secret     string   `json:"secret"`
+	Action     string   `json:"action,omitempty"`
+}
+
+type appCertificateSync struct {
+	Hosts   []appCertificate `json:"hosts"`
+	Removed []string         `json:"removed,omitempty"`
+}
+
+// syncAppCertificates reconciles the certificate Secrets and HTTPS listeners
+// with the WebApplications that set route.tls. Certificates are reissued when
+// their hosts change, the CA changes or they are close to expiry; Secrets and
+// listeners of hosts no longer requested are removed.
+func syncAppCertificates(ctx context.Context) (appCertificateSync, error) {
+	dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+	if err != nil {
+		return appCertificateSync{}, err
+	}
+	clientset, err := kube.NewClientset(kubeconfig)
+	if err != nil {
+		return appCertificateSync{}, err
+	}
+	appGVR := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "webapplications"}
+	apps, err := dynamicClient.Resource(appGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return appCertificateSync{}, fmt.Errorf("list webapplications: %w", err)
+	}
+	desired := desiredAppCertificates(apps.Items)
+
+	secrets := clientset.CoreV1().Secrets(appGatewayNamespace)
+	managed, err := secrets.List(ctx, metav1.ListOptions{LabelSelector: appCertLabel + "=true"})
+	if err != nil {
+		return appCertificateSync{}, fmt.Errorf("list app certificates: %w", err)
+	}
+	if len(desired) == 0 && len(managed.Items) == 0 {
+		return appCertificateSync{}, nil
+	}
+
+	dir, err := pki.Dir()
+	if err != nil {
+		return appCertificateSync{}, err
+	}
+	ca, err := clusterCA(ctx, secrets, dir)
+	if err != nil {
+		return appCertificateSync{}, err
+	}
+
+	existing := map[string]corev1.Secret{}
+	for _, secret := range managed.Items {
+		existing[secret.Name] = secret
+	}
+	result := appCertificateSync{}
+	for _, cert := range desired {
+		cert.Action = "unchanged"
+		if secret, ok := existing[cert.Secret]; !ok || !ca.Current(secret.Data[corev1.TLSCertKey], []string{cert.Host}, time.Now()) {
+			certPEM, keyPEM, err := ca.Issue([]string{cert.Host})
+			if err != nil {
+				return appCertificateSync{}, err
+			}
+			if err := applyAppCertificateSecret(ctx, secrets, cert, certPEM, keyPEM); err != nil {
+				return appCertificateSync{}, err
+			}
+			cert.Action = "issued"
+		}
+		delete(existing, cert.Secret)
+		result.Hosts = append(result.Hosts, cert)
+	}
+
+	if err := applyGatewayListeners(ctx, dynamicClient, gatewayListeners(desired)); err != nil {
+		return appCertificateSync{}, err
+	}
+
+	for _, secret := range existing {
+		if err := secrets.Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return appCertificateSync{}, fmt.Errorf("delete certificate %s: %w", secret.Name, err)
+		}
+		result.Removed = append(result.Removed, secret.Annotations[appCertHostAnnotation])
+	}
+	sort.Strings(result.Removed)
+	return result, nil
+}
+
+// clusterCA returns the CA stored in the cluster, so everyone syncing
+// certificates signs them with the same one instead of reissuing each
+// other's. A cluster without one adopts the CA in dir, or a new one; the
+// cluster's CA is copied to dir for export-ca and the gRPC health check.
+func clusterCA(ctx context.Context, secrets typedcorev1.SecretInterface, dir string) (*pki.CA, error) {
+	secret, err := secrets.Get(ctx, appCASecret, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		local, created, loadErr := pki.LoadOrCreateCA(dir)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if created {
+			fmt.Fprintf(os.Stderr, "Created a local CA in %s\n", dir)
+		}
+		secret, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: appCASecret, Namespace: appGatewayNamespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: local.CertPEM, corev1.TLSPrivateKeyKey: local.KeyPEM()},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// Someone else stored a CA first; use theirs.
+			secret, err = secrets.Get(ctx, appCASecret, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read ca secret %s/%s: %w", appGatewayNamespace, appCASecret, err)
+	}
+	ca, err := pki.ParseCA(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("read ca secret %s/%s: %w", appGatewayNamespace, appCASecret, err)
+	}
+
+	if local, err := os.ReadFile(filepath.Join(dir, pki.CACertFile)); err == nil && bytes.Equal(local, ca.CertPEM) {
+		return ca, nil
+	} else if err == nil {
+		fmt.Fprintf(os.Stderr, "Replaced the CA in %s with the cluster's; trust it again with shoulders certs export-ca\n", dir)
+	}
+	if err := pki.Save(dir, ca); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// desiredAppCertificates returns one certificate per host of the enabled
+// routes that set tls, sorted by host. Apps being deleted are skipped. A host shared by apps in several
+// namespaces gets one listener open to all of them.
+func desiredAppCertificates(apps []unstructured.Unstructured) []appCertificate {
+	namespacesByHost := map[string]map[string]bool{}
+	for _, app := range apps {
+		if app.GetDeletionTimestamp() != nil {
+			continue
+		}
+		tls, _, _ := unstructured.NestedBool(app.Object, "spec", "route", "tls")
+		enabled, found, _ := unstructured.NestedBool(app.Object, "spec", "route", "enabled")
+		if !tls || (found && !enabled) {
+			continue
+		}
+		hosts, _, _ := unstructured.NestedStringSlice(app.Object, "spec", "route", "hosts")
+		if host, _, _ := unstructured.NestedString(app.Object, "spec", "host"); host != "" {
+			hosts = append([]string{host}, hosts...)
+		}
+		for _, host := range hosts {
+			host = strings.ToLower(strings.TrimSpace(host))
+			if host == "" {
+				continue
+			}
+			if namespacesByHost[host] == nil {
+				namespacesByHost[host] = map[string]bool{}
+			}
+			namespacesByHost[host][app.GetNamespace()] = true
+		}
+	}
+
+	certs := make([]appCertificate, 0, len(namespacesByHost))
+	for host, namespaces := range namespacesByHost {
+		cert := appCertificate{Host: host, Secret: appCertificateName("app-tls-", host)}
+		for namespace := range namespaces {
+			cert.Namespaces = append(cert.Namespaces, namespace)
+		}
+		sort.Strings(cert.Namespaces)
+		certs = append(certs, cert)
+	}
+	sort.Slice(certs, func(i, j int) bool { return certs[i].Host < certs[j].Host })
+	return certs
+}
+
+// appCertificateName derives a Secret or listener name from host.
+func appCertificateName(prefix, host string) string {
+	name := prefix + strings.ReplaceAll(strings.ReplaceAll(host, "*", "wildcard"), ".", "-")
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-")
+	}
+	return name
+}
+
+// gatewayListeners renders the HTTPS listener of each certificate. A
+// listener only accepts routes from the namespaces of the apps that asked
+// for its host.
+func gatewayListeners(certs []appCertificate) []interface{} {
+	listeners := make([]interface{}, 0, len(certs))
+	for _, cert := range certs {
+		namespaces := make([]interface{}, 0, len(cert.Namespaces))
+		for _, namespace := range cert.Namespaces {
+			namespaces = append(namespaces, namespace)
+		}
+		listeners = append(listeners, map[string]interface{}{
+			"name":     appCertificateName("https-", cert.Host),
+			"protocol": "HTTPS",
+			"port":     int64(443),
+			"hostname": cert.Host,
+			"tls": map[string]interface{}{
+				"mode": "Terminate",
+				"certificateRefs": []interface{}{
+					map[string]interface{}{"kind": "Secret", "name": cert.Secret},
+				},
+			},
+			"allowedRoutes": map[string]interface{}{
+				"namespaces": map[string]interface{}{
+					"from": "Selector",
+					"selector": map[string]interface{}{
+						"matchExpressions": []interface{}{
+							map[string]interface{}{"key": "kubernetes.io/metadata.name", "operator": "In", "values": namespaces},
+						},
+					},
+				},
+			},
+		})
+	}
+	return listeners
+}
+
+func applyAppCertificateSecret(ctx context.Context, secrets typedcorev1.SecretInterface, cert appCertificate, certPEM, keyPEM []byte) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        cert.Secret,
+			Namespace:   appGatewayNamespace,
+			Labels:      map[string]string{appCertLabel: "true"},
+			Annotations: map[string]string{appCertHostAnnotation: cert.Host},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+	}
+	current, err := secrets.Get(ctx, cert.Secret, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	} else if err == nil {
+		secret.ResourceVersion = current.ResourceVersion
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("store certificate for %s: %w", cert.Host, err)
+	}
+	return nil
+}
+
+// applyGatewayListeners server-side applies the app listeners with their own
+// field manager, so the listeners Flux manages on the same Gateway are left
+// alone and listeners dropped from the list are removed.
+func applyGatewayListeners(ctx context.Context, client dynamic.Interface, listeners []interface{}) error {
+	patch := map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": appGatewayName, "namespace": appGatewayNamespace},
+		"spec":       map[string]interface{}{"listeners": listeners},
+	}
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	force := true
+	_, err = client.Resource(gatewayGVR).Namespace(appGatewayNamespace).Patch(ctx, appGatewayName, types.ApplyPatchType, body, metav1.PatchOptions{
+		FieldManager: appCertFieldManager,
+		Force:        &force,
+	})
+	if err != nil {
+		return fmt.Errorf("update gateway %s/%s listeners: %w", appGatewayNamespace, appGatewayName, err)
+	}
+	return nil
+}
+
+// manifestRequestsTLS reports whether a manifest holds a WebApplication with
+// route.tls set.
+func manifestRequestsTLS(content []byte) (bool, error) {
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 4096)
+	for {
+		var obj unstructured.Unstructured
+		if err := decoder.Decode(&obj); err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		}
+		if obj.Object == nil || obj.GetKind() != "WebApplication" {
+			continue
+		}
+		if tls, _, _ := unstructured.NestedBool(obj.Object, "spec", "route", "tls"); tls {
+			return true, nil
+		}
+	}
+}
+
+// syncAppCertificatesAfterChange runs a certificate sync after an app
+// change that involves TLS and reports what it did.
+func syncAppCertificatesAfterChange(ctx context.Context) error {
+	result, err := syncAppCertificates(ctx)
+	if err != nil {
+		return fmt.Errorf("sync app certificates: %w", err)
+	}
+	for _, host := range result.Hosts {
+		if host.Action == "issued" {
+			fmt.Printf("Issued certificate for https://%s\n", host.Host)
+		}
+	}
+	for _, host := range result.Removed {
+		fmt.Printf("Removed certificate for %s\n", host)
+	}
+	return nil
+}
+
+func init() {
+	certsCmd.AddCommand(certsExportCACmd)
+	certsCmd.AddCommand(certsSyncCmd)
+	certsExportCACmd.Flags().StringVarP(&certsExportFile, "file", "f", "", "Write the CA certificate to this file instead of stdout")
+}
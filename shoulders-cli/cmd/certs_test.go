@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/pki"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func tlsApp(namespace, name string, route map[string]interface{}, host string) unstructured.Unstructured {
+	spec := map[string]interface{}{"route": route}
+	if host != "" {
+		spec["host"] = host
+	}
+	app := unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	app.SetNamespace(namespace)
+	app.SetName(name)
+	return app
+}
+
+func TestDesiredAppCertificates(t *testing.T) {
+	deleting := tlsApp("team-c", "old", map[string]interface{}{"tls": true}, "old.local")
+	now := metav1.Now()
+	deleting.SetDeletionTimestamp(&now)
+
+	apps := []unstructured.Unstructured{
+		tlsApp("team-a", "shop", map[string]interface{}{"tls": true, "hosts": []interface{}{"www.shop.local"}}, "shop.local"),
+		tlsApp("team-b", "shop-api", map[string]interface{}{"tls": true}, "shop.local"),
+		tlsApp("team-a", "plain", map[string]interface{}{}, "plain.local"),
+		tlsApp("team-a", "internal", map[string]interface{}{"tls": true, "enabled": false}, "internal.local"),
+		deleting,
+	}
+
+	certs := desiredAppCertificates(apps)
+	if len(certs) != 2 {
+		t.Fatalf("expected 2 certificates, got %#v", certs)
+	}
+	if certs[0].Host != "shop.local" || len(certs[0].Namespaces) != 2 || certs[0].Secret != "app-tls-shop-local" {
+		t.Fatalf("unexpected shared host certificate: %#v", certs[0])
+	}
+	if certs[1].Host != "www.shop.local" || certs[1].Namespaces[0] != "team-a" {
+		t.Fatalf("unexpected extra host certificate: %#v", certs[1])
+	}
+}
+
+func TestGatewayListeners(t *testing.T) {
+	listeners := gatewayListeners([]appCertificate{{Host: "shop.local", Namespaces: []string{"team-a"}, Secret: "app-tls-shop-local"}})
+	if len(listeners) != 1 {
+		t.Fatalf("expected one listener, got %#v", listeners)
+	}
+	listener := listeners[0].(map[string]interface{})
+	if listener["name"] != "https-shop-local" || listener["protocol"] != "HTTPS" || listener["hostname"] != "shop.local" {
+		t.Fatalf("unexpected listener: %#v", listener)
+	}
+	ref, _, _ := unstructured.NestedSlice(listener, "tls", "certificateRefs")
+	if len(ref) != 1 || ref[0].(map[string]interface{})["name"] != "app-tls-shop-local" {
+		t.Fatalf("unexpected certificate refs: %#v", ref)
+	}
+	from, _, _ := unstructured.NestedString(listener, "allowedRoutes", "namespaces", "from")
+	if from != "Selector" {
+		t.Fatalf("expected the listener to be limited to the app namespaces, got %q", from)
+	}
+}
+
+func TestManifestRequestsTLS(t *testing.T) {
+	manifest := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: shoulders.io/v1alpha1
+kind: WebApplication
+metadata:
+  name: shop
+spec:
+  host: shop.local
+  route:
+    tls: true
+`)
+	requestsTLS, err := manifestRequestsTLS(manifest)
+	if err != nil || !requestsTLS {
+		t.Fatalf("expected the manifest to request TLS, got %t, %v", requestsTLS, err)
+	}
+
+	requestsTLS, err = manifestRequestsTLS([]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n"))
+	if err != nil || requestsTLS {
+		t.Fatalf("expected no TLS request, got %t, %v", requestsTLS, err)
+	}
+}
+
+func TestClusterCAIsSharedBetweenDevelopers(t *testing.T) {
+	ctx := context.Background()
+	secrets := fake.NewSimpleClientset().CoreV1().Secrets(appGatewayNamespace)
+
+	alice := filepath.Join(t.TempDir(), "pki")
+	first, err := clusterCA(ctx, secrets, alice)
+	if err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	if _, err := secrets.Get(ctx, appCASecret, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the CA to be stored in the cluster: %v", err)
+	}
+
+	// A second developer with a CA of their own gets the cluster's instead.
+	bob := filepath.Join(t.TempDir(), "pki")
+	own, _, err := pki.LoadOrCreateCA(bob)
+	if err != nil {
+		t.Fatalf("create ca: %v", err)
+	}
+	second, err := clusterCA(ctx, secrets, bob)
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if second.Fingerprint() != first.Fingerprint() || second.Fingerprint() == own.Fingerprint() {
+		t.Fatalf("expected the cluster's CA, got %s", second.Fingerprint())
+	}
+	local, created, err := pki.LoadOrCreateCA(bob)
+	if err != nil || created || local.Fingerprint() != first.Fingerprint() {
+		t.Fatalf("expected the cluster's CA to be copied locally, got %v, %v", created, err)
+	}
+}
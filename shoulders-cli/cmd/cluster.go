@@ -68,12 +68,15 @@ var clusterUseCmd = &cobra.Command{
 		if err := kube.SwitchContext(kubeconfig, contextName); err != nil {
 			return err
 		}
-		if currentConfig.Provider() == config.ProviderExisting {
-			currentConfig.Cluster.Context = contextName
-		} else {
-			currentConfig.Cluster.Name = name
-		}
-		if err := saveCurrentConfig(); err != nil {
+		existing := currentConfig.Provider() == config.ProviderExisting
+		err := saveConfigChange(func(cfg *config.Config) {
+			if existing {
+				cfg.Cluster.Context = contextName
+			} else {
+				cfg.Cluster.Name = name
+			}
+		})
+		if err != nil {
 			return err
 		}
 		fmt.Printf("Switched to cluster %s (context: %s)\n", name, contextName)
@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"sigs.k8s.io/yaml"
+)
+
+const compositionsDir = "../../2-addons/manifests/crossplane/compositions"
+
+// renderComposition runs the go-templating step of a composition against xr,
+// with the sprig functions function-go-templating provides, and returns the
+// rendered resources.
+func renderComposition(t *testing.T, file, step, xr string) []map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(compositionsDir, file))
+	if err != nil {
+		t.Fatalf("read composition: %v", err)
+	}
+	var composition struct {
+		Spec struct {
+			Pipeline []struct {
+				Step  string `json:"step"`
+				Input struct {
+					Inline struct {
+						Template string `json:"template"`
+					} `json:"inline"`
+				} `json:"input"`
+			} `json:"pipeline"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(data, &composition); err != nil {
+		t.Fatalf("parse composition: %v", err)
+	}
+	source := ""
+	for _, s := range composition.Spec.Pipeline {
+		if s.Step == step {
+			source = s.Input.Inline.Template
+		}
+	}
+	if source == "" {
+		t.Fatalf("%s has no template step %q", file, step)
+	}
+
+	funcs := sprig.TxtFuncMap()
+	funcs["toYaml"] = func(v interface{}) string {
+		out, _ := yaml.Marshal(v)
+		return strings.TrimSuffix(string(out), "\n")
+	}
+	tmpl, err := template.New(step).Funcs(funcs).Parse(source)
+	if err != nil {
+		t.Fatalf("parse template: %v", err)
+	}
+	var composite map[string]interface{}
+	if err := yaml.Unmarshal([]byte(xr), &composite); err != nil {
+		t.Fatalf("parse XR: %v", err)
+	}
+	var out bytes.Buffer
+	input := map[string]interface{}{"observed": map[string]interface{}{"composite": map[string]interface{}{"resource": composite}}}
+	if err := tmpl.Execute(&out, input); err != nil {
+		t.Fatalf("render template: %v", err)
+	}
+
+	var resources []map[string]interface{}
+	for _, doc := range strings.Split(out.String(), "\n---\n") {
+		var resource map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &resource); err != nil {
+			t.Fatalf("rendered invalid YAML: %v\n%s", err, doc)
+		}
+		if resource != nil {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
+
+func renderedOfKind(resources []map[string]interface{}, kind string) []map[string]interface{} {
+	var matches []map[string]interface{}
+	for _, resource := range resources {
+		if resource["kind"] == kind {
+			matches = append(matches, resource)
+		}
+	}
+	return matches
+}
+
+func stringMap(value interface{}) map[string]string {
+	out := map[string]string{}
+	m, _ := value.(map[string]interface{})
+	for key, v := range m {
+		out[key], _ = v.(string)
+	}
+	return out
+}
+
+func labelsMatch(selector, labels map[string]string) bool {
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWorkspaceGrantsSelectCanaryPods(t *testing.T) {
+	app := renderComposition(t, "application-composition.yaml", "go-templating", `
+apiVersion: shoulders.io/v1alpha1
+kind: WebApplication
+metadata:
+  name: team-a-api
+  namespace: team-a
+spec:
+  image: registry.local/api
+  tag: "1.0"
+  replicas: 2
+  port: 8080
+  canary:
+    image: registry.local/api
+    tag: "1.1"
+    weight: 20
+`)
+	workspace := renderComposition(t, "workspace-composition.yaml", "grants", `
+apiVersion: shoulders.io/v1alpha1
+kind: Workspace
+metadata:
+  name: team-a
+spec:
+  allowFrom:
+    - workspace: team-b
+      app: team-a-api
+`)
+
+	deployments := renderedOfKind(app, "Deployment")
+	if len(deployments) != 2 {
+		t.Fatalf("expected a stable and a canary Deployment, got %d", len(deployments))
+	}
+	podLabels := map[string]map[string]string{}
+	for _, deployment := range deployments {
+		template := deployment["spec"].(map[string]interface{})["template"].(map[string]interface{})
+		labels := stringMap(template["metadata"].(map[string]interface{})["labels"])
+		if labels["app"] != "team-a-api" {
+			t.Fatalf("expected every track to keep app: team-a-api, got %v", labels)
+		}
+		podLabels[labels["shoulders.io/track"]] = labels
+	}
+	if podLabels["stable"] == nil || podLabels["canary"] == nil {
+		t.Fatalf("expected stable and canary tracks, got %v", podLabels)
+	}
+
+	for _, service := range renderedOfKind(app, "Service") {
+		selector := stringMap(service["spec"].(map[string]interface{})["selector"])
+		for track, labels := range podLabels {
+			selected := labelsMatch(selector, labels)
+			if selected != (selector["shoulders.io/track"] == track) {
+				t.Fatalf("Service %v selects the %s pods: %t", selector, track, selected)
+			}
+		}
+	}
+
+	policies := renderedOfKind(workspace, "CiliumClusterwideNetworkPolicy")
+	if len(policies) != 1 {
+		t.Fatalf("expected one grants policy, got %d", len(policies))
+	}
+	specs := policies[0]["specs"].([]interface{})
+	ingress := specs[0].(map[string]interface{})["endpointSelector"].(map[string]interface{})
+	selector := stringMap(ingress["matchLabels"])
+	delete(selector, "k8s:io.kubernetes.pod.namespace")
+	for track, labels := range podLabels {
+		if !labelsMatch(selector, labels) {
+			t.Fatalf("grant selector %v misses the %s pods %v", selector, track, labels)
+		}
+	}
+}
+
+func TestServiceSelectsUntrackedPodsWithoutCanary(t *testing.T) {
+	app := renderComposition(t, "application-composition.yaml", "go-templating", `
+apiVersion: shoulders.io/v1alpha1
+kind: WebApplication
+metadata:
+  name: team-a-api
+  namespace: team-a
+spec:
+  image: registry.local/api
+  tag: "1.0"
+  replicas: 2
+  port: 8080
+  availability:
+    minAvailable: 1
+`)
+
+	// Pods rolled out before the track label existed only carry app.
+	untracked := map[string]string{"app": "team-a-api"}
+	services := renderedOfKind(app, "Service")
+	if len(services) != 1 {
+		t.Fatalf("expected one Service, got %d", len(services))
+	}
+	selector := stringMap(services[0]["spec"].(map[string]interface{})["selector"])
+	if !labelsMatch(selector, untracked) {
+		t.Fatalf("Service selector %v drops pods without a track label", selector)
+	}
+	budgets := renderedOfKind(app, "PodDisruptionBudget")
+	if len(budgets) != 1 {
+		t.Fatalf("expected one PodDisruptionBudget, got %d", len(budgets))
+	}
+	selector = stringMap(budgets[0]["spec"].(map[string]interface{})["selector"].(map[string]interface{})["matchLabels"])
+	if !labelsMatch(selector, untracked) {
+		t.Fatalf("PodDisruptionBudget selector %v drops pods without a track label", selector)
+	}
+}
+
+func TestCanaryDoesNotMountPersistentClaims(t *testing.T) {
+	app := renderComposition(t, "application-composition.yaml", "go-templating", `
+apiVersion: shoulders.io/v1alpha1
+kind: WebApplication
+metadata:
+  name: team-a-notes
+  namespace: team-a
+spec:
+  image: registry.local/notes
+  tag: "1.0"
+  replicas: 1
+  persistence:
+    - name: data
+      size: 1Gi
+      mountPath: /var/lib/notes
+  canary:
+    image: registry.local/notes
+    tag: "1.1"
+    weight: 10
+`)
+
+	deployments := renderedOfKind(app, "Deployment")
+	if len(deployments) != 2 {
+		t.Fatalf("expected a stable and a canary Deployment, got %d", len(deployments))
+	}
+	for _, deployment := range deployments {
+		podSpec := deployment["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+		volumes := podSpec["volumes"].([]interface{})
+		data := volumes[len(volumes)-1].(map[string]interface{})
+		_, claim := data["persistentVolumeClaim"]
+		canary := deployment["metadata"].(map[string]interface{})["name"] == "team-a-notes-canary"
+		if claim == canary {
+			t.Fatalf("expected only the stable Deployment to mount the claim, got %s with %v", deployment["metadata"].(map[string]interface{})["name"], data)
+		}
+		if canary && data["emptyDir"] == nil {
+			t.Fatalf("expected the canary to get a scratch volume at the mount path, got %v", data)
+		}
+	}
+}
+
+func TestSidecarsStartBeforeInitContainers(t *testing.T) {
+	containers := `
+  initContainers:
+    - name: migrate
+      image: registry.local/migrate
+  sidecars:
+    - name: cloud-sql-proxy
+      image: registry.local/proxy
+`
+	rendered := map[string][]map[string]interface{}{
+		"Deployment": renderComposition(t, "application-composition.yaml", "go-templating", `
+apiVersion: shoulders.io/v1alpha1
+kind: WebApplication
+metadata:
+  name: team-a-api
+  namespace: team-a
+spec:
+  image: registry.local/api
+  tag: "1.0"
+  replicas: 1
+`+containers),
+		"Job": renderComposition(t, "workload-composition.yaml", "go-templating", `
+apiVersion: shoulders.io/v1alpha1
+kind: Workload
+metadata:
+  name: team-a-backfill
+  namespace: team-a
+spec:
+  type: job
+  image: registry.local/backfill
+  tag: "1.0"
+`+containers),
+	}
+
+	for kind, resources := range rendered {
+		workloads := renderedOfKind(resources, kind)
+		if len(workloads) != 1 {
+			t.Fatalf("expected one %s, got %d", kind, len(workloads))
+		}
+		podSpec := workloads[0]["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+		initContainers := podSpec["initContainers"].([]interface{})
+		if len(initContainers) != 2 {
+			t.Fatalf("%s: expected the sidecar and the init container, got %v", kind, initContainers)
+		}
+		first := initContainers[0].(map[string]interface{})
+		if first["name"] != "cloud-sql-proxy" || first["restartPolicy"] != "Always" {
+			t.Fatalf("%s: expected the sidecar to start first, got %v", kind, initContainers)
+		}
+	}
+}
+
+func TestSpecEnvReplacesBindingVariables(t *testing.T) {
+	app := renderComposition(t, "application-composition.yaml", "go-templating", `
+apiVersion: shoulders.io/v1alpha1
+kind: WebApplication
+metadata:
+  name: team-a-api
+  namespace: team-a
+spec:
+  image: registry.local/api
+  tag: "1.0"
+  replicas: 1
+  bindings:
+    - kind: StateStore
+      name: orders
+      postgresql: true
+  env:
+    - name: PGHOST
+      value: pgbouncer
+    - name: LOG_LEVEL
+      value: debug
+`)
+
+	deployments := renderedOfKind(app, "Deployment")
+	if len(deployments) != 1 {
+		t.Fatalf("expected one Deployment, got %d", len(deployments))
+	}
+	podSpec := deployments[0]["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	container := podSpec["containers"].([]interface{})[0].(map[string]interface{})
+	var names []string
+	values := map[string]interface{}{}
+	for _, entry := range container["env"].([]interface{}) {
+		variable := entry.(map[string]interface{})
+		name := variable["name"].(string)
+		if _, ok := values[name]; ok {
+			t.Fatalf("expected %s once, got %v", name, container["env"])
+		}
+		names = append(names, name)
+		values[name] = variable["value"]
+	}
+	if values["PGHOST"] != "pgbouncer" || values["LOG_LEVEL"] != "debug" {
+		t.Fatalf("expected spec.env to win over the binding, got %v", container["env"])
+	}
+	// DATABASE_URL refers to $(PGHOST), so the override keeps its place.
+	if names[0] != "PGHOST" || names[len(names)-1] != "LOG_LEVEL" {
+		t.Fatalf("expected PGHOST to stay first and LOG_LEVEL to be appended, got %v", names)
+	}
+}
@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	configViewShowOrigin bool
+	configMigrateDryRun  bool
+)
+
+type configValueOrigin struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value" yaml:"value"`
+	Origin string `json:"origin" yaml:"origin"`
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read and edit the Shoulders config file",
+	Long: "Keys are dot-separated paths of the config file, for example platform.flux.gitRepository.url. " +
+		"Map entries use their key (environments.staging.cluster.provider) and list items their index (platform.addons.0.name).",
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a config key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		value, err := config.GetValue(currentConfig, args[0])
+		if err != nil {
+			return err
+		}
+		text, err := formatConfigValue(value)
+		if err != nil {
+			return err
+		}
+		fmt.Println(text)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a config key in the config file",
+	Long:  "Strings are stored verbatim, booleans and numbers are parsed, and lists and objects are parsed as YAML, for example '[a, b]' or '{enabled: true}'.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editConfigFile(func(cfg *config.Config) error {
+			return config.SetValue(cfg, args[0], args[1])
+		})
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a config key from the config file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editConfigFile(func(cfg *config.Config) error {
+			return config.UnsetValue(cfg, args[0])
+		})
+	},
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Print the effective configuration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+
+		if !configViewShowOrigin {
+			if format == output.Table {
+				format = output.YAML
+			}
+			payload, err := output.Render(currentConfig, format)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(payload))
+			return nil
+		}
+
+		leaves := config.Leaves(currentConfig)
+		origins := make([]configValueOrigin, 0, len(leaves))
+		for _, key := range config.SortedKeys(leaves) {
+			origin := string(currentConfig.Origin(key))
+			if origin == "" {
+				origin = string(config.OriginFile)
+			}
+			origins = append(origins, configValueOrigin{Key: key, Value: leaves[key], Origin: origin})
+		}
+		if format == output.Table {
+			rows := make([][]string, 0, len(origins))
+			for _, entry := range origins {
+				rows = append(rows, []string{entry.Key, entry.Value, entry.Origin})
+			}
+			return output.PrintTable([]string{"Key", "Value", "Origin"}, rows)
+		}
+		payload, err := output.Render(origins, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
+		return nil
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Open the config file in $EDITOR and validate it on save",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		original, err := os.ReadFile(loadedConfigPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		// Edit a copy so an invalid result never replaces the working file.
+		draft, err := os.CreateTemp("", "shoulders-config-*.yaml")
+		if err != nil {
+			return err
+		}
+		draftPath := draft.Name()
+		if _, err := draft.Write(original); err != nil {
+			_ = draft.Close()
+			return err
+		}
+		if err := draft.Close(); err != nil {
+			return err
+		}
+
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+		parts := strings.Fields(editor)
+		editorCmd := exec.Command(parts[0], append(parts[1:], draftPath)...)
+		editorCmd.Stdin = os.Stdin
+		editorCmd.Stdout = os.Stdout
+		editorCmd.Stderr = os.Stderr
+		if err := editorCmd.Run(); err != nil {
+			return fmt.Errorf("run editor %q: %w", editor, err)
+		}
+
+		edited, err := os.ReadFile(draftPath)
+		if err != nil {
+			return err
+		}
+		if string(edited) == string(original) {
+			_ = os.Remove(draftPath)
+			fmt.Println("Config unchanged")
+			return nil
+		}
+		if _, err := config.Load(draftPath); err != nil {
+			return fmt.Errorf("edited config is invalid, changes kept in %s: %w", draftPath, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(loadedConfigPath), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(loadedConfigPath, edited, 0o644); err != nil {
+			return err
+		}
+		_ = os.Remove(draftPath)
+		fmt.Printf("Saved %s\n", loadedConfigPath)
+		return nil
+	},
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the config file to the current schema version",
+	Long: "Rewrites the config file with the current apiVersion after running every migration step. " +
+		"The original file is kept next to it with a .bak suffix.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		original, err := os.ReadFile(loadedConfigPath)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no config file at %s", loadedConfigPath)
+		}
+		if err != nil {
+			return err
+		}
+		cfg, err := config.LoadFile(environmentName, loadedConfigPath)
+		if err != nil {
+			return err
+		}
+		if !cfg.NeedsMigration() {
+			fmt.Printf("%s already uses %s\n", loadedConfigPath, config.APIVersion)
+			return nil
+		}
+
+		from := config.VersionLabel(cfg.FileAPIVersion())
+		if configMigrateDryRun {
+			migrated, err := config.Render(cfg)
+			if err != nil {
+				return err
+			}
+			diff, err := unifiedDiff(string(original), string(migrated), loadedConfigPath+" ("+from+")", loadedConfigPath+" ("+config.APIVersion+")")
+			if err != nil {
+				return err
+			}
+			fmt.Print(diff)
+			return nil
+		}
+
+		backup := config.BackupPath(loadedConfigPath, cfg.FileAPIVersion())
+		if err := config.Save(cfg, loadedConfigPath); err != nil {
+			return err
+		}
+		fmt.Printf("Migrated %s from %s to %s (backup: %s)\n", loadedConfigPath, from, config.APIVersion, backup)
+		return nil
+	},
+}
+
+// editConfigFile applies edit to the config file as stored on disk, without
+// the --set overrides and defaults of the running command.
+func editConfigFile(edit func(*config.Config) error) error {
+	cfg, err := config.LoadFile(environmentName, loadedConfigPath)
+	if err != nil {
+		return err
+	}
+	if err := edit(cfg); err != nil {
+		return err
+	}
+	if err := config.Save(cfg, loadedConfigPath); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s\n", loadedConfigPath)
+	return nil
+}
+
+func formatConfigValue(value interface{}) (string, error) {
+	reflected := reflect.ValueOf(value)
+	for reflected.Kind() == reflect.Ptr {
+		if reflected.IsNil() {
+			return "", nil
+		}
+		reflected = reflected.Elem()
+	}
+	switch reflected.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Interface:
+		payload, err := yaml.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(payload), "\n"), nil
+	default:
+		return fmt.Sprint(reflected.Interface()), nil
+	}
+}
+
+func init() {
+	configViewCmd.Flags().BoolVar(&configViewShowOrigin, "show-origin", false, "List every set key with the layer that supplied it (file, env, flag or default)")
+
+	configMigrateCmd.Flags().BoolVar(&configMigrateDryRun, "dry-run", false, "Print the migrated file as a diff without writing it")
+
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configViewCmd)
+	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configMigrateCmd)
+}
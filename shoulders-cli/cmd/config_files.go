@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	defaultConfigMountDir = "/etc/config"
+	// maxConfigFilesSize keeps the rendered ConfigMap under the 1MiB object
+	// limit with room for metadata.
+	maxConfigFilesSize = 900 * 1024
+)
+
+// configKeyPattern matches the keys a ConfigMap accepts.
+var configKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+var (
+	appConfigFiles []string
+	appConfigDirs  []string
+)
+
+// buildConfigFiles reads --config-file and --config-dir entries into config
+// files for the spec.
+func buildConfigFiles(files, dirs []string) ([]v1alpha1.ConfigFileSpec, error) {
+	configFiles := []v1alpha1.ConfigFileSpec{}
+	for _, entry := range files {
+		source, mountPath := splitConfigSource(entry)
+		if source == "" {
+			return nil, fmt.Errorf("invalid config file %q, expected path[:mountPath]", entry)
+		}
+		configFile, err := readConfigFile(source, mountPath)
+		if err != nil {
+			return nil, err
+		}
+		configFiles = append(configFiles, configFile)
+	}
+	for _, entry := range dirs {
+		dir, mountDir := splitConfigSource(entry)
+		if dir == "" {
+			return nil, fmt.Errorf("invalid config dir %q, expected dir[:mountDir]", entry)
+		}
+		if mountDir == "" {
+			mountDir = defaultConfigMountDir
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("read config dir %s: %w", dir, err)
+		}
+		for _, dirEntry := range entries {
+			if !dirEntry.Type().IsRegular() {
+				continue
+			}
+			configFile, err := readConfigFile(filepath.Join(dir, dirEntry.Name()), path.Join(mountDir, dirEntry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			configFiles = append(configFiles, configFile)
+		}
+	}
+	if err := validateConfigFiles(configFiles); err != nil {
+		return nil, err
+	}
+	if len(configFiles) == 0 {
+		return nil, nil
+	}
+	return configFiles, nil
+}
+
+// splitConfigSource splits path[:mountPath] at the last colon followed by an
+// absolute path, so local paths containing colons still work.
+func splitConfigSource(entry string) (string, string) {
+	entry = strings.TrimSpace(entry)
+	if index := strings.LastIndex(entry, ":"); index > 0 && strings.HasPrefix(entry[index+1:], "/") {
+		return entry[:index], entry[index+1:]
+	}
+	return entry, ""
+}
+
+func readConfigFile(source, mountPath string) (v1alpha1.ConfigFileSpec, error) {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return v1alpha1.ConfigFileSpec{}, fmt.Errorf("read config file: %w", err)
+	}
+	if !utf8.Valid(content) {
+		return v1alpha1.ConfigFileSpec{}, fmt.Errorf("config file %s is not UTF-8 text; mount binary files from a Secret instead", source)
+	}
+	return v1alpha1.ConfigFileSpec{
+		Name:      filepath.Base(source),
+		Content:   string(content),
+		MountPath: mountPath,
+	}, nil
+}
+
+func validateConfigFiles(configFiles []v1alpha1.ConfigFileSpec) error {
+	seen := map[string]bool{}
+	size := 0
+	for _, configFile := range configFiles {
+		if !configKeyPattern.MatchString(configFile.Name) {
+			return fmt.Errorf("invalid config file name %q: use letters, digits, '-', '_' or '.'", configFile.Name)
+		}
+		if seen[configFile.Name] {
+			return fmt.Errorf("config file %s is given more than once", configFile.Name)
+		}
+		seen[configFile.Name] = true
+		size += len(configFile.Content)
+	}
+	if size > maxConfigFilesSize {
+		return fmt.Errorf("config files total %d bytes, more than the %d a ConfigMap can hold", size, maxConfigFilesSize)
+	}
+	return nil
+}
+
+// mergeConfigFiles replaces the config files in current that share a name
+// with updates and appends the rest, keeping the result sorted by name.
+func mergeConfigFiles(current []interface{}, updates []v1alpha1.ConfigFileSpec) ([]interface{}, error) {
+	byName := map[string]interface{}{}
+	for _, item := range current {
+		configFile, _ := item.(map[string]interface{})
+		name, _ := configFile["name"].(string)
+		if name != "" {
+			byName[name] = configFile
+		}
+	}
+	for _, configFile := range updates {
+		object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&configFile)
+		if err != nil {
+			return nil, err
+		}
+		byName[configFile.Name] = object
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	merged := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		merged = append(merged, byName[name])
+	}
+	return merged, nil
+}
+
+// applyConfigFileFlagOverrides merges --config-file and --config-dir into an
+// unstructured spec, keeping config files that are not given again.
+func applyConfigFileFlagOverrides(cmd *cobra.Command, spec map[string]interface{}) (bool, error) {
+	if !anyFlagChanged(cmd, "config-file", "config-dir") {
+		return false, nil
+	}
+	configFiles, err := buildConfigFiles(appConfigFiles, appConfigDirs)
+	if err != nil {
+		return false, err
+	}
+	current, _ := spec["configFiles"].([]interface{})
+	merged, err := mergeConfigFiles(current, configFiles)
+	if err != nil {
+		return false, err
+	}
+	specFiles := make([]v1alpha1.ConfigFileSpec, 0, len(merged))
+	for _, item := range merged {
+		configFile, _ := item.(map[string]interface{})
+		content, _ := configFile["content"].(string)
+		name, _ := configFile["name"].(string)
+		specFiles = append(specFiles, v1alpha1.ConfigFileSpec{Name: name, Content: content})
+	}
+	if err := validateConfigFiles(specFiles); err != nil {
+		return false, err
+	}
+	spec["configFiles"] = merged
+	return true, nil
+}
+
+func registerConfigFileFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&appConfigFiles, "config-file", nil, "Mount a local file from a ConfigMap (path[:mountPath], default /etc/config/<file>), repeatable")
+	cmd.Flags().StringArrayVar(&appConfigDirs, "config-dir", nil, "Mount every file in a local directory from a ConfigMap (dir[:mountDir], default /etc/config), repeatable")
+}
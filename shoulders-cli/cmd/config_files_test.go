@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+)
+
+func TestSplitConfigSource(t *testing.T) {
+	cases := map[string][2]string{
+		"nginx.conf":                        {"nginx.conf", ""},
+		"nginx.conf:/etc/nginx/nginx.conf":  {"nginx.conf", "/etc/nginx/nginx.conf"},
+		`C:\config\app.yaml`:                {`C:\config\app.yaml`, ""},
+		`C:\config\app.yaml:/etc/app.yaml`:  {`C:\config\app.yaml`, "/etc/app.yaml"},
+		"conf/a:b.yaml:/etc/config/ab.yaml": {"conf/a:b.yaml", "/etc/config/ab.yaml"},
+	}
+	for entry, want := range cases {
+		source, mountPath := splitConfigSource(entry)
+		if source != want[0] || mountPath != want[1] {
+			t.Fatalf("%q: expected %q and %q, got %q and %q", entry, want[0], want[1], source, mountPath)
+		}
+	}
+}
+
+func TestBuildConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "nginx.conf"), []byte("worker_processes 1;\n"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	confDir := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(confDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"a.conf", "b.conf"} {
+		if err := os.WriteFile(filepath.Join(confDir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(confDir, "nested"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	configFiles, err := buildConfigFiles(
+		[]string{filepath.Join(dir, "nginx.conf") + ":/etc/nginx/nginx.conf"},
+		[]string{confDir + ":/etc/nginx/conf.d"},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []v1alpha1.ConfigFileSpec{
+		{Name: "nginx.conf", Content: "worker_processes 1;\n", MountPath: "/etc/nginx/nginx.conf"},
+		{Name: "a.conf", Content: "a.conf", MountPath: "/etc/nginx/conf.d/a.conf"},
+		{Name: "b.conf", Content: "b.conf", MountPath: "/etc/nginx/conf.d/b.conf"},
+	}
+	if len(configFiles) != len(want) {
+		t.Fatalf("expected %d config files, got %#v", len(want), configFiles)
+	}
+	for index := range want {
+		if configFiles[index] != want[index] {
+			t.Fatalf("expected %#v, got %#v", want[index], configFiles[index])
+		}
+	}
+
+	if _, err := buildConfigFiles([]string{filepath.Join(confDir, "a.conf"), filepath.Join(confDir, "a.conf")}, nil); err == nil {
+		t.Fatalf("expected a duplicate config file to fail")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blob.bin"), []byte{0xff, 0xfe}, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := buildConfigFiles([]string{filepath.Join(dir, "blob.bin")}, nil); err == nil || !strings.Contains(err.Error(), "UTF-8") {
+		t.Fatalf("expected binary content to be rejected, got %v", err)
+	}
+}
+
+func TestMergeConfigFiles(t *testing.T) {
+	current := []interface{}{
+		map[string]interface{}{"name": "b.conf", "content": "old"},
+		map[string]interface{}{"name": "a.conf", "content": "kept"},
+	}
+	merged, err := mergeConfigFiles(current, []v1alpha1.ConfigFileSpec{{Name: "b.conf", Content: "new", MountPath: "/etc/b.conf"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(merged) != 2 {
+		t.Fatalf("expected two config files, got %#v", merged)
+	}
+	first := merged[0].(map[string]interface{})
+	second := merged[1].(map[string]interface{})
+	if first["name"] != "a.conf" || first["content"] != "kept" {
+		t.Fatalf("expected a.conf to be kept, got %#v", first)
+	}
+	if second["content"] != "new" || second["mountPath"] != "/etc/b.conf" {
+		t.Fatalf("expected b.conf to be replaced, got %#v", second)
+	}
+}
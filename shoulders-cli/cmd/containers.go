@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// mainContainerName is the container the compositions render from the
+// image and tag of the spec itself.
+const mainContainerName = "app"
+
+var (
+	appInitContainers []string
+	appSidecars       []string
+)
+
+func registerContainerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&appInitContainers, "init", nil, "Init container run before the app (name=image[:tag]), repeatable")
+	cmd.Flags().StringArrayVar(&appSidecars, "sidecar", nil, "Sidecar container run next to the app (name=image[:tag]), repeatable")
+}
+
+// parseContainerFlags turns repeated name=image[:tag] flags into containers.
+func parseContainerFlags(flag string, entries []string) ([]v1alpha1.ContainerSpec, error) {
+	containers := make([]v1alpha1.ContainerSpec, 0, len(entries))
+	for _, entry := range entries {
+		name, ref, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		ref = strings.TrimSpace(ref)
+		if !ok || name == "" || ref == "" {
+			return nil, fmt.Errorf("invalid --%s %q (expected name=image[:tag])", flag, entry)
+		}
+		image, tag := parseImageTag(ref, "")
+		containers = append(containers, v1alpha1.ContainerSpec{Name: name, Image: image, Tag: tag})
+	}
+	return containers, nil
+}
+
+// validateExtraContainers rejects init containers and sidecars that clash
+// with the main container or with each other.
+func validateExtraContainers(initContainers, sidecars []v1alpha1.ContainerSpec) error {
+	seen := map[string]bool{mainContainerName: true}
+	for _, container := range append(append([]v1alpha1.ContainerSpec(nil), initContainers...), sidecars...) {
+		if container.Name == mainContainerName {
+			return fmt.Errorf("container name %q is reserved for the main container", mainContainerName)
+		}
+		if seen[container.Name] {
+			return fmt.Errorf("duplicate container name %q", container.Name)
+		}
+		if container.Image == "" {
+			return fmt.Errorf("container %s has no image", container.Name)
+		}
+		seen[container.Name] = true
+	}
+	return nil
+}
+
+// buildExtraContainers parses the --init and --sidecar flags.
+func buildExtraContainers() ([]v1alpha1.ContainerSpec, []v1alpha1.ContainerSpec, error) {
+	initContainers, err := parseContainerFlags("init", appInitContainers)
+	if err != nil {
+		return nil, nil, err
+	}
+	sidecars, err := parseContainerFlags("sidecar", appSidecars)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateExtraContainers(initContainers, sidecars); err != nil {
+		return nil, nil, err
+	}
+	if len(initContainers) == 0 {
+		initContainers = nil
+	}
+	if len(sidecars) == 0 {
+		sidecars = nil
+	}
+	return initContainers, sidecars, nil
+}
+
+// applyContainerFlagOverrides replaces the init containers and sidecars of an
+// unstructured spec when their flags were passed. Containers already in the
+// spec but not named by a flag are kept, so updating one sidecar does not
+// drop the others.
+func applyContainerFlagOverrides(initChanged, sidecarsChanged bool, spec map[string]interface{}) (bool, error) {
+	if !initChanged && !sidecarsChanged {
+		return false, nil
+	}
+	initContainers, sidecars, err := buildExtraContainers()
+	if err != nil {
+		return false, err
+	}
+	fields := []struct {
+		key        string
+		changed    bool
+		containers []v1alpha1.ContainerSpec
+	}{
+		{"initContainers", initChanged, initContainers},
+		{"sidecars", sidecarsChanged, sidecars},
+	}
+	for _, field := range fields {
+		if !field.changed {
+			continue
+		}
+		merged, err := mergeContainers(spec[field.key], field.containers)
+		if err != nil {
+			return false, err
+		}
+		spec[field.key] = merged
+	}
+
+	var containers struct {
+		InitContainers []v1alpha1.ContainerSpec `json:"initContainers"`
+		Sidecars       []v1alpha1.ContainerSpec `json:"sidecars"`
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &containers); err != nil {
+		return false, err
+	}
+	if err := validateExtraContainers(containers.InitContainers, containers.Sidecars); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// mergeContainers updates the image and tag of existing containers by name
+// and appends the new ones.
+func mergeContainers(existing interface{}, updates []v1alpha1.ContainerSpec) ([]interface{}, error) {
+	items, _ := existing.([]interface{})
+	merged := append([]interface{}(nil), items...)
+	for _, update := range updates {
+		found := false
+		for _, item := range merged {
+			fields, ok := item.(map[string]interface{})
+			if !ok || fields["name"] != update.Name {
+				continue
+			}
+			fields["image"] = update.Image
+			if update.Tag == "" {
+				delete(fields, "tag")
+			} else {
+				fields["tag"] = update.Tag
+			}
+			found = true
+		}
+		if found {
+			continue
+		}
+		fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&update)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, fields)
+	}
+	return merged, nil
+}
+
+type containerStatusRow struct {
+	Pod      string
+	Name     string
+	Kind     string
+	Image    string
+	Ready    bool
+	State    string
+	Restarts int32
+}
+
+// printContainerStatuses prints the status of every container, including
+// init containers and sidecars, of the pods matching selector.
+func printContainerStatuses(ctx context.Context, namespace, selector string) error {
+	clientset, err := kube.NewClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+	rows := containerStatusRows(pods.Items)
+	fmt.Println("Containers:")
+	if len(rows) == 0 {
+		fmt.Println("  no pods")
+		return nil
+	}
+	table := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		table = append(table, []string{row.Pod, row.Name, row.Kind, row.Image, fmt.Sprintf("%t", row.Ready), row.State, fmt.Sprintf("%d", row.Restarts)})
+	}
+	return output.PrintTable([]string{"Pod", "Container", "Kind", "Image", "Ready", "State", "Restarts"}, table)
+}
+
+// containerStatusRows lists the containers of pods in start order: init
+// containers and sidecars first, then the main containers.
+func containerStatusRows(pods []corev1.Pod) []containerStatusRow {
+	var rows []containerStatusRow
+	for _, pod := range pods {
+		statuses := map[string]corev1.ContainerStatus{}
+		for _, status := range append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+			statuses[status.Name] = status
+		}
+		for _, container := range pod.Spec.InitContainers {
+			kind := "init"
+			if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+				kind = "sidecar"
+			}
+			rows = append(rows, containerStatusRowFor(pod.Name, container, kind, statuses))
+		}
+		for _, container := range pod.Spec.Containers {
+			rows = append(rows, containerStatusRowFor(pod.Name, container, "main", statuses))
+		}
+	}
+	return rows
+}
+
+func containerStatusRowFor(pod string, container corev1.Container, kind string, statuses map[string]corev1.ContainerStatus) containerStatusRow {
+	row := containerStatusRow{Pod: pod, Name: container.Name, Kind: kind, Image: container.Image, State: "Pending"}
+	status, ok := statuses[container.Name]
+	if !ok {
+		return row
+	}
+	row.Ready = status.Ready
+	row.Restarts = status.RestartCount
+	row.State = describeContainerState(status.State)
+	return row
+}
+
+func describeContainerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return "Running"
+	case state.Waiting != nil:
+		return "Waiting: " + state.Waiting.Reason
+	case state.Terminated != nil:
+		if state.Terminated.ExitCode == 0 {
+			return "Terminated: " + state.Terminated.Reason
+		}
+		return fmt.Sprintf("Terminated: %s (exit %d)", state.Terminated.Reason, state.Terminated.ExitCode)
+	default:
+		return "Pending"
+	}
+}
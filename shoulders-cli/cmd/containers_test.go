@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseContainerFlags(t *testing.T) {
+	containers, err := parseContainerFlags("sidecar", []string{"proxy=envoyproxy/envoy:v1.31", "shipper=fluent-bit"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(containers) != 2 || containers[0].Name != "proxy" || containers[0].Image != "envoyproxy/envoy" || containers[0].Tag != "v1.31" {
+		t.Fatalf("unexpected containers: %#v", containers)
+	}
+	if containers[1].Tag != "latest" {
+		t.Fatalf("expected latest tag, got %q", containers[1].Tag)
+	}
+
+	if _, err := parseContainerFlags("init", []string{"migrate"}); err == nil {
+		t.Fatalf("expected an entry without an image to fail")
+	}
+}
+
+func TestValidateExtraContainers(t *testing.T) {
+	migrate := v1alpha1.ContainerSpec{Name: "migrate", Image: "migrate"}
+	if err := validateExtraContainers([]v1alpha1.ContainerSpec{migrate}, []v1alpha1.ContainerSpec{{Name: "proxy", Image: "envoy"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := validateExtraContainers(nil, []v1alpha1.ContainerSpec{{Name: "app", Image: "envoy"}}); err == nil {
+		t.Fatalf("expected the main container name to be rejected")
+	}
+	if err := validateExtraContainers([]v1alpha1.ContainerSpec{migrate}, []v1alpha1.ContainerSpec{migrate}); err == nil {
+		t.Fatalf("expected a duplicate name to be rejected")
+	}
+}
+
+func TestMergeContainers(t *testing.T) {
+	existing := []interface{}{
+		map[string]interface{}{"name": "proxy", "image": "envoy", "tag": "v1.30", "args": []interface{}{"--log-level=info"}},
+	}
+	merged, err := mergeContainers(existing, []v1alpha1.ContainerSpec{
+		{Name: "proxy", Image: "envoy", Tag: "v1.31"},
+		{Name: "shipper", Image: "fluent-bit", Tag: "3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 containers, got %#v", merged)
+	}
+	proxy := merged[0].(map[string]interface{})
+	if proxy["tag"] != "v1.31" || proxy["args"] == nil {
+		t.Fatalf("expected proxy to keep its args and take the new tag, got %#v", proxy)
+	}
+	if merged[1].(map[string]interface{})["name"] != "shipper" {
+		t.Fatalf("expected shipper to be appended, got %#v", merged[1])
+	}
+}
+
+func TestContainerStatusRows(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-abc12-xyz"},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{Name: "migrate", Image: "migrate:1"},
+				{Name: "proxy", Image: "envoy:v1.31", RestartPolicy: &always},
+			},
+			Containers: []corev1.Container{{Name: "app", Image: "api:1"}},
+		},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "migrate", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+				{Name: "proxy", Ready: true, RestartCount: 2, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+		},
+	}
+
+	rows := containerStatusRows([]corev1.Pod{pod})
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %#v", rows)
+	}
+	if rows[0].Kind != "init" || rows[0].State != "Terminated: Completed" {
+		t.Fatalf("unexpected init row: %#v", rows[0])
+	}
+	if rows[1].Kind != "sidecar" || !rows[1].Ready || rows[1].Restarts != 2 {
+		t.Fatalf("unexpected sidecar row: %#v", rows[1])
+	}
+	if rows[2].Kind != "main" || rows[2].State != "Pending" {
+		t.Fatalf("unexpected main row: %#v", rows[2])
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/spf13/cobra"
+)
+
+type environmentSummary struct {
+	Name      string `json:"name" yaml:"name"`
+	Current   bool   `json:"current" yaml:"current"`
+	Provider  string `json:"provider" yaml:"provider"`
+	Cluster   string `json:"cluster" yaml:"cluster"`
+	Profile   string `json:"profile" yaml:"profile"`
+	Workspace string `json:"workspace,omitempty" yaml:"workspace,omitempty"`
+}
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage named environments from the config file",
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List environments",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+
+		summaries := []environmentSummary{}
+		for _, name := range currentConfig.EnvironmentNames() {
+			env, err := currentConfig.ForEnvironment(name)
+			if err != nil {
+				return err
+			}
+			cluster := env.ClusterName()
+			if env.Provider() == config.ProviderExisting {
+				cluster = env.Cluster.Context
+			}
+			summaries = append(summaries, environmentSummary{
+				Name:      name,
+				Current:   name == currentConfig.Environment(),
+				Provider:  env.Provider(),
+				Cluster:   cluster,
+				Profile:   env.Profile(),
+				Workspace: env.CurrentWorkspace,
+			})
+		}
+
+		if format == output.Table {
+			rows := [][]string{}
+			for _, summary := range summaries {
+				current := ""
+				if summary.Current {
+					current = "*"
+				}
+				rows = append(rows, []string{current, summary.Name, summary.Provider, summary.Cluster, summary.Profile, summary.Workspace})
+			}
+			return output.PrintTable([]string{"Current", "Name", "Provider", "Cluster", "Profile", "Workspace"}, rows)
+		}
+		payload, err := output.Render(summaries, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
+		return nil
+	},
+}
+
+var envUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Set the active environment",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if _, err := currentConfig.ForEnvironment(name); err != nil {
+			return err
+		}
+
+		current := name
+		if name == config.DefaultEnvironment {
+			current = ""
+		}
+		if err := saveConfigChange(func(cfg *config.Config) { cfg.CurrentEnvironment = current }); err != nil {
+			return err
+		}
+		fmt.Printf("Active environment set to %s\n", name)
+		return nil
+	},
+}
+
+var envCurrentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Show the active environment",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fmt.Println(currentConfig.Environment())
+		return nil
+	},
+}
+
+func init() {
+	envCmd.AddCommand(envListCmd)
+	envCmd.AddCommand(envUseCmd)
+	envCmd.AddCommand(envCurrentCmd)
+}
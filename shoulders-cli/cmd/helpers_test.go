@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
@@ -114,3 +116,39 @@ func hasNamedResource(resources []namedPlatformResource, namespace, name string)
 	}
 	return false
 }
+
+func TestSaveConfigChangeKeepsRuntimeLayersOutOfTheFile(t *testing.T) {
+	originalConfig, originalPath, originalFile, originalOverrides := currentConfig, loadedConfigPath, configFile, configOverrides
+	originalKubeconfig := kubeconfig
+	defer func() {
+		currentConfig, loadedConfigPath, configFile, configOverrides = originalConfig, originalPath, originalFile, originalOverrides
+		kubeconfig = originalKubeconfig
+	}()
+
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configFile, []byte("cluster:\n  name: dev\n"), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("SHOULDERS_KUBECONFIG", "/tmp/kc")
+	configOverrides = []string{"platform.profile=small"}
+	if err := loadRuntimeConfig(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	if err := saveConfigChange(func(cfg *config.Config) { cfg.CurrentWorkspace = "team-a" }); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+	if currentConfig.CurrentWorkspace != "team-a" || currentConfig.Cluster.Kubeconfig != "/tmp/kc" || currentConfig.Profile() != config.ProfileSmall {
+		t.Fatalf("expected the runtime config to keep its layers and the change, got %#v", currentConfig)
+	}
+	saved, err := config.LoadFile("", configFile)
+	if err != nil {
+		t.Fatalf("read saved config: %v", err)
+	}
+	if saved.CurrentWorkspace != "team-a" || saved.Cluster.Name != "dev" {
+		t.Fatalf("expected the change and the file values to be saved, got %#v", saved)
+	}
+	if saved.Cluster.Kubeconfig != "" || saved.Platform.Profile == config.ProfileSmall {
+		t.Fatalf("expected SHOULDERS_KUBECONFIG and --set to stay out of the file, got %#v", saved)
+	}
+}
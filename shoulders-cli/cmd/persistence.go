@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/usage"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// volumeNamePattern matches the DNS labels a pod volume name accepts.
+var volumeNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+var appPVCMounts []string
+
+// buildPersistence parses --pvc-mount name:size:/path entries.
+func buildPersistence(entries []string) ([]v1alpha1.PersistenceSpec, error) {
+	persistence := []v1alpha1.PersistenceSpec{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid PVC mount %q, expected name:size:/path", entry)
+		}
+		name, size, mountPath := parts[0], parts[1], parts[2]
+		if !volumeNamePattern.MatchString(name) || len(name) > 63 {
+			return nil, fmt.Errorf("invalid PVC mount name %q: use lowercase letters, digits and '-'", name)
+		}
+		if _, err := resource.ParseQuantity(size); err != nil {
+			return nil, fmt.Errorf("invalid size %q for PVC mount %s: %w", size, name, err)
+		}
+		if !path.IsAbs(mountPath) {
+			return nil, fmt.Errorf("PVC mount %s: mount path %q must be absolute", name, mountPath)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("PVC mount %s is given more than once", name)
+		}
+		seen[name] = true
+		persistence = append(persistence, v1alpha1.PersistenceSpec{Name: name, Size: size, MountPath: mountPath})
+	}
+	if len(persistence) == 0 {
+		return nil, nil
+	}
+	return persistence, nil
+}
+
+// mergePersistence replaces the entries in current that share a name with
+// updates, keeping their storage class and access mode since the flag cannot
+// set them, and appends the rest sorted by name.
+func mergePersistence(current []interface{}, updates []v1alpha1.PersistenceSpec) ([]interface{}, error) {
+	byName := map[string]map[string]interface{}{}
+	for _, item := range current {
+		entry, _ := item.(map[string]interface{})
+		name, _ := entry["name"].(string)
+		if name != "" {
+			byName[name] = entry
+		}
+	}
+	for _, update := range updates {
+		object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&update)
+		if err != nil {
+			return nil, err
+		}
+		if existing, ok := byName[update.Name]; ok {
+			for _, key := range []string{"storageClass", "accessMode"} {
+				if value, ok := existing[key]; ok {
+					object[key] = value
+				}
+			}
+		}
+		byName[update.Name] = object
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	merged := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		merged = append(merged, byName[name])
+	}
+	return merged, nil
+}
+
+// applyPersistenceFlagOverrides merges --pvc-mount into an unstructured spec,
+// keeping volumes that are not given again.
+func applyPersistenceFlagOverrides(cmd *cobra.Command, spec map[string]interface{}) (bool, error) {
+	if !cmd.Flags().Changed("pvc-mount") {
+		return false, nil
+	}
+	persistence, err := buildPersistence(appPVCMounts)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := spec["canary"]; ok && len(persistence) > 0 {
+		return false, fmt.Errorf("the app has an active canary, which would share its volumes; promote or abort it before adding persistent volumes")
+	}
+	current, _ := spec["persistence"].([]interface{})
+	if err := checkStatefulSetSizes(spec, current, persistence); err != nil {
+		return false, err
+	}
+	merged, err := mergePersistence(current, persistence)
+	if err != nil {
+		return false, err
+	}
+	spec["persistence"] = merged
+	return true, nil
+}
+
+// checkStatefulSetSizes rejects new sizes for the volumes of an app with more
+// than one replica: they come from the StatefulSet's volumeClaimTemplates,
+// which Kubernetes does not allow to change.
+func checkStatefulSetSizes(spec map[string]interface{}, current []interface{}, updates []v1alpha1.PersistenceSpec) error {
+	if replicas, _ := specReplicas(spec); replicas <= 1 {
+		return nil
+	}
+	sizes := map[string]string{}
+	for _, item := range current {
+		entry, _ := item.(map[string]interface{})
+		name, _ := entry["name"].(string)
+		sizes[name], _ = entry["size"].(string)
+	}
+	for _, update := range updates {
+		size, ok := sizes[update.Name]
+		if !ok {
+			continue
+		}
+		before, err := resource.ParseQuantity(size)
+		if err != nil {
+			continue
+		}
+		if after := resource.MustParse(update.Size); after.Cmp(before) != 0 {
+			return fmt.Errorf("PVC mount %s: a StatefulSet cannot change the size of its volumes (%s to %s); resize each %s-<app>-<n> claim with kubectl instead", update.Name, size, update.Size, update.Name)
+		}
+	}
+	return nil
+}
+
+// specReplicas reads the replica count of an unstructured spec, which holds
+// int64 after decoding and int32 after a --replicas override.
+func specReplicas(spec map[string]interface{}) (int64, bool) {
+	switch replicas := spec["replicas"].(type) {
+	case int64:
+		return replicas, true
+	case int32:
+		return int64(replicas), true
+	case float64:
+		return int64(replicas), true
+	}
+	return 0, false
+}
+
+func registerPersistenceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&appPVCMounts, "pvc-mount", nil, "Mount a PersistentVolumeClaim (name:size:/path, for example data:1Gi:/var/lib/data), repeatable")
+}
+
+type persistentVolumeRow struct {
+	Claim        string
+	Status       string
+	Capacity     string
+	Used         string
+	AccessModes  string
+	StorageClass string
+}
+
+// printPersistentVolumes prints the claims matching selector with their used
+// space, which comes from Prometheus when it is installed.
+func printPersistentVolumes(ctx context.Context, namespace, selector string) error {
+	clientset, err := kube.NewClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+	claims, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list persistent volume claims: %w", err)
+	}
+	if len(claims.Items) == 0 {
+		return nil
+	}
+	// Without Prometheus the used space is unknown, not an error.
+	used, _ := usage.Prometheus{Clientset: clientset}.VolumeUsage(ctx, namespace)
+	rows := persistentVolumeRows(claims.Items, used)
+	table := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		table = append(table, []string{row.Claim, row.Status, row.Capacity, row.Used, row.AccessModes, row.StorageClass})
+	}
+	fmt.Println()
+	fmt.Println("Volumes:")
+	return output.PrintTable([]string{"Claim", "Status", "Capacity", "Used", "Access modes", "Storage class"}, table)
+}
+
+// persistentVolumeRows describes claims sorted by name. Used is "-" when the
+// usage of a claim is unknown, for example before its pod mounted it.
+func persistentVolumeRows(claims []corev1.PersistentVolumeClaim, used map[string]float64) []persistentVolumeRow {
+	rows := make([]persistentVolumeRow, 0, len(claims))
+	for _, claim := range claims {
+		capacity, ok := claim.Status.Capacity[corev1.ResourceStorage]
+		if !ok {
+			capacity = claim.Spec.Resources.Requests[corev1.ResourceStorage]
+		}
+		row := persistentVolumeRow{
+			Claim:        claim.Name,
+			Status:       string(claim.Status.Phase),
+			Capacity:     capacity.String(),
+			Used:         "-",
+			StorageClass: "-",
+		}
+		if row.Status == "" {
+			row.Status = string(corev1.ClaimPending)
+		}
+		if bytes, ok := used[claim.Name]; ok {
+			row.Used = usage.DescribeMemory(bytes)
+			if total := capacity.AsApproximateFloat64(); total > 0 {
+				row.Used = fmt.Sprintf("%s (%.0f%%)", row.Used, bytes/total*100)
+			}
+		}
+		modes := make([]string, 0, len(claim.Spec.AccessModes))
+		for _, mode := range claim.Spec.AccessModes {
+			modes = append(modes, string(mode))
+		}
+		row.AccessModes = strings.Join(modes, ",")
+		if claim.Spec.StorageClassName != nil && *claim.Spec.StorageClassName != "" {
+			row.StorageClass = *claim.Spec.StorageClassName
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Claim < rows[j].Claim })
+	return rows
+}
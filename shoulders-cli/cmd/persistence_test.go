@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuildPersistence(t *testing.T) {
+	persistence, err := buildPersistence([]string{"data:1Gi:/var/lib/data", "cache:500Mi:/cache"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []v1alpha1.PersistenceSpec{
+		{Name: "data", Size: "1Gi", MountPath: "/var/lib/data"},
+		{Name: "cache", Size: "500Mi", MountPath: "/cache"},
+	}
+	if !reflect.DeepEqual(persistence, want) {
+		t.Fatalf("expected %#v, got %#v", want, persistence)
+	}
+
+	for _, entries := range [][]string{
+		{"data:1Gi"},
+		{"Data:1Gi:/data"},
+		{"data:lots:/data"},
+		{"data:1Gi:data"},
+		{"data:1Gi:/a", "data:2Gi:/b"},
+	} {
+		if _, err := buildPersistence(entries); err == nil {
+			t.Fatalf("expected %q to be rejected", entries)
+		}
+	}
+}
+
+func TestMergePersistenceKeepsStorageClass(t *testing.T) {
+	current := []interface{}{
+		map[string]interface{}{"name": "data", "size": "1Gi", "mountPath": "/data", "storageClass": "fast", "accessMode": "ReadWriteOncePod"},
+		map[string]interface{}{"name": "uploads", "size": "5Gi", "mountPath": "/uploads"},
+	}
+	merged, err := mergePersistence(current, []v1alpha1.PersistenceSpec{
+		{Name: "data", Size: "2Gi", MountPath: "/var/lib/data"},
+		{Name: "cache", Size: "100Mi", MountPath: "/cache"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 entries, got %#v", merged)
+	}
+	names := []string{}
+	for _, item := range merged {
+		names = append(names, item.(map[string]interface{})["name"].(string))
+	}
+	if !reflect.DeepEqual(names, []string{"cache", "data", "uploads"}) {
+		t.Fatalf("expected entries sorted by name, got %v", names)
+	}
+	data := merged[1].(map[string]interface{})
+	if data["size"] != "2Gi" || data["mountPath"] != "/var/lib/data" || data["storageClass"] != "fast" || data["accessMode"] != "ReadWriteOncePod" {
+		t.Fatalf("unexpected merged entry: %#v", data)
+	}
+}
+
+func TestPersistentVolumeRows(t *testing.T) {
+	storageClass := "standard"
+	claims := []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "data-api-1"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				Resources:   corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "data-api-0"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+				StorageClassName: &storageClass,
+			},
+			Status: corev1.PersistentVolumeClaimStatus{
+				Phase:    corev1.ClaimBound,
+				Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")},
+			},
+		},
+	}
+	rows := persistentVolumeRows(claims, map[string]float64{"data-api-0": 256 * 1024 * 1024})
+	want := []persistentVolumeRow{
+		{Claim: "data-api-0", Status: "Bound", Capacity: "1Gi", Used: "256Mi (25%)", AccessModes: "ReadWriteOnce", StorageClass: "standard"},
+		{Claim: "data-api-1", Status: "Pending", Capacity: "1Gi", Used: "-", AccessModes: "ReadWriteOnce", StorageClass: "-"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("expected %#v, got %#v", want, rows)
+	}
+}
+
+func TestApplyPersistenceFlagOverridesGuardsCanaryAndStatefulSets(t *testing.T) {
+	update := func(spec map[string]interface{}, mount string) error {
+		cmd := &cobra.Command{}
+		registerPersistenceFlags(cmd)
+		if err := cmd.Flags().Set("pvc-mount", mount); err != nil {
+			t.Fatalf("set flag: %v", err)
+		}
+		defer func() { appPVCMounts = nil }()
+		_, err := applyPersistenceFlagOverrides(cmd, spec)
+		return err
+	}
+
+	canary := map[string]interface{}{"replicas": int64(1), "canary": map[string]interface{}{"image": "notes", "tag": "1.1"}}
+	if err := update(canary, "data:1Gi:/data"); err == nil {
+		t.Fatalf("expected volumes next to an active canary to be rejected")
+	}
+
+	stateful := map[string]interface{}{
+		"replicas":    int64(3),
+		"persistence": []interface{}{map[string]interface{}{"name": "data", "size": "1Gi", "mountPath": "/data"}},
+	}
+	if err := update(stateful, "data:2Gi:/data"); err == nil {
+		t.Fatalf("expected a StatefulSet volume resize to be rejected")
+	}
+	if err := update(stateful, "data:1024Mi:/var/data"); err != nil {
+		t.Fatalf("expected an unchanged size to be accepted, got %v", err)
+	}
+	if err := update(stateful, "cache:500Mi:/cache"); err != nil {
+		t.Fatalf("expected a new volume to be accepted, got %v", err)
+	}
+
+	single := map[string]interface{}{
+		"replicas":    int32(1),
+		"persistence": []interface{}{map[string]interface{}{"name": "data", "size": "1Gi", "mountPath": "/data"}},
+	}
+	if err := update(single, "data:2Gi:/data"); err != nil {
+		t.Fatalf("expected a single-replica claim to be resizable, got %v", err)
+	}
+}
@@ -0,0 +1,578 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/bootstrap"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/manifests"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/tui"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	platformComponentCilium = "cilium"
+	platformComponentFlux   = "flux"
+	platformComponentAddons = "addons"
+)
+
+var (
+	platformUpgradeCilium      string
+	platformUpgradeFlux        string
+	platformUpgradeAddonsRef   string
+	platformUpgradeDryRun      bool
+	platformUpgradeGateTimeout time.Duration
+
+	platformProfileYes          bool
+	platformProfileDryRun       bool
+	platformProfileResize       bool
+	platformProfilePruneTimeout time.Duration
+)
+
+var platformCmd = &cobra.Command{
+	Use:   "platform",
+	Short: "Manage the platform components installed on the cluster",
+}
+
+type platformUpgradeTargets struct {
+	CiliumVersion string
+	FluxVersion   string
+	RepoURL       string
+	Branch        string
+}
+
+type platformUpgradeStep struct {
+	Component string   `json:"component" yaml:"component"`
+	Current   string   `json:"current" yaml:"current"`
+	Target    string   `json:"target" yaml:"target"`
+	Upgrade   bool     `json:"upgrade" yaml:"upgrade"`
+	Changes   []string `json:"changes,omitempty" yaml:"changes,omitempty"`
+
+	revision int
+}
+
+var platformUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade Cilium, Flux and the addon source on a running cluster",
+	Long: "Compares the installed Cilium Helm release, Flux controller images and addon Git source against the targets, " +
+		"prints the plan, and upgrades in dependency order (Cilium, Flux, addons) with a platform health gate after each step. " +
+		"Cilium is rolled back to its previous Helm revision if its health gate fails.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+
+		targets := resolvePlatformUpgradeTargets()
+		plan, err := planPlatformUpgrade(cmd.Context(), targets)
+		if err != nil {
+			return err
+		}
+		if err := renderPlatformUpgradePlan(plan, format); err != nil {
+			return err
+		}
+		if platformUpgradeDryRun {
+			return nil
+		}
+		if !platformUpgradePending(plan) {
+			fmt.Println("Platform is already up to date")
+			return nil
+		}
+
+		if err := runPlatformUpgrade(cmd.Context(), plan, targets); err != nil {
+			return err
+		}
+
+		// Only targets given as flags are pinned; the others keep following
+		// the file, the environment and the CLI defaults.
+		return saveConfigChange(func(cfg *config.Config) {
+			if platformUpgradeCilium != "" {
+				cfg.Platform.Cilium.Version = targets.CiliumVersion
+			}
+			if platformUpgradeFlux != "" {
+				cfg.Platform.Flux.Version = targets.FluxVersion
+			}
+			if platformUpgradeAddonsRef != "" {
+				cfg.Platform.Flux.GitRepository.Branch = targets.Branch
+			}
+		})
+	},
+}
+
+func resolvePlatformUpgradeTargets() platformUpgradeTargets {
+	targets := platformUpgradeTargets{
+		CiliumVersion: currentConfig.CiliumVersion(),
+		FluxVersion:   currentConfig.FluxVersion(),
+		RepoURL:       currentConfig.FluxRepositoryURL(),
+		Branch:        currentConfig.FluxRepositoryBranch(),
+	}
+	if platformUpgradeCilium != "" {
+		targets.CiliumVersion = platformUpgradeCilium
+	}
+	if platformUpgradeFlux != "" {
+		targets.FluxVersion = platformUpgradeFlux
+	}
+	if platformUpgradeAddonsRef != "" {
+		targets.Branch = platformUpgradeAddonsRef
+	}
+	targets.CiliumVersion = strings.TrimPrefix(strings.TrimSpace(targets.CiliumVersion), "v")
+	targets.FluxVersion = "v" + strings.TrimPrefix(strings.TrimSpace(targets.FluxVersion), "v")
+	return targets
+}
+
+func planPlatformUpgrade(ctx context.Context, targets platformUpgradeTargets) ([]platformUpgradeStep, error) {
+	plan := []platformUpgradeStep{}
+
+	if currentConfig.CiliumEnabled() {
+		release, installed, err := bootstrap.InstalledCiliumRelease(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		if !installed {
+			return nil, fmt.Errorf("cilium is not installed by the CLI; run 'shoulders up' first")
+		}
+		plan = append(plan, platformUpgradeStep{
+			Component: platformComponentCilium,
+			Current:   release.Version,
+			Target:    targets.CiliumVersion,
+			Upgrade:   release.Version != targets.CiliumVersion,
+			revision:  release.Revision,
+		})
+	}
+
+	installedFlux, err := bootstrap.InstalledFluxInstallation(ctx, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	targetFlux, err := bootstrap.FluxReleaseInstallation(ctx, targets.FluxVersion)
+	if err != nil {
+		return nil, err
+	}
+	changes := bootstrap.FluxControllerChanges(installedFlux, targetFlux)
+	currentFlux := installedFlux.Version
+	if currentFlux == "" {
+		currentFlux = "unknown"
+	}
+	plan = append(plan, platformUpgradeStep{
+		Component: platformComponentFlux,
+		Current:   currentFlux,
+		Target:    targets.FluxVersion,
+		Upgrade:   len(changes) > 0,
+		Changes:   changes,
+	})
+
+	repoURL, branch, err := bootstrap.InstalledFluxSource(ctx, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	addons := platformUpgradeStep{
+		Component: platformComponentAddons,
+		Current:   branch,
+		Target:    targets.Branch,
+		Upgrade:   branch != targets.Branch || repoURL != targets.RepoURL,
+	}
+	if repoURL != targets.RepoURL {
+		addons.Changes = []string{fmt.Sprintf("url: %s -> %s", repoURL, targets.RepoURL)}
+	}
+	plan = append(plan, addons)
+
+	return plan, nil
+}
+
+func platformUpgradePending(plan []platformUpgradeStep) bool {
+	for _, step := range plan {
+		if step.Upgrade {
+			return true
+		}
+	}
+	return false
+}
+
+func renderPlatformUpgradePlan(plan []platformUpgradeStep, format output.Format) error {
+	if format != output.Table {
+		payload, err := output.Render(plan, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
+		return nil
+	}
+
+	rows := make([][]string, 0, len(plan))
+	for _, step := range plan {
+		action := "up to date"
+		if step.Upgrade {
+			action = "upgrade"
+		}
+		rows = append(rows, []string{step.Component, step.Current, step.Target, action, strings.Join(step.Changes, ", ")})
+	}
+	return output.PrintTable([]string{"Component", "Current", "Target", "Action", "Changes"}, rows)
+}
+
+func runPlatformUpgrade(ctx context.Context, plan []platformUpgradeStep, targets platformUpgradeTargets) error {
+	phases := []string{"Check platform health"}
+	for _, step := range plan {
+		if step.Upgrade {
+			phases = append(phases, platformUpgradePhaseName(step.Component))
+		}
+	}
+
+	tracker := tui.NewPhaseTracker(phases, true)
+	defer tracker.Stop()
+
+	// Refuse to start from an unhealthy platform so the gates below only
+	// measure the effect of the upgrade itself.
+	tracker.Start("waiting for shoulders status to report all systems healthy")
+	if err := waitForHealthyStatus(ctx, platformUpgradeGateTimeout); err != nil {
+		tracker.Fail(err.Error())
+		return fmt.Errorf("platform is not healthy before upgrade: %w", err)
+	}
+	tracker.Complete()
+
+	for _, step := range plan {
+		if !step.Upgrade {
+			continue
+		}
+		tracker.Start(fmt.Sprintf("%s %s -> %s", step.Component, step.Current, step.Target))
+		var err error
+		switch step.Component {
+		case platformComponentCilium:
+			err = upgradeCilium(ctx, tracker, step)
+		case platformComponentFlux:
+			err = upgradeFlux(ctx, tracker, targets.FluxVersion)
+		case platformComponentAddons:
+			err = upgradeAddons(ctx, tracker, targets)
+		}
+		if err != nil {
+			tracker.Fail(err.Error())
+			return err
+		}
+		tracker.Complete()
+	}
+
+	fmt.Println()
+	fmt.Println(tracker.Summary())
+	fmt.Println()
+	return nil
+}
+
+func platformUpgradePhaseName(component string) string {
+	switch component {
+	case platformComponentCilium:
+		return "Upgrade Cilium CNI"
+	case platformComponentFlux:
+		return "Upgrade Flux CD"
+	default:
+		return "Update addon source"
+	}
+}
+
+func upgradeCilium(ctx context.Context, tracker *tui.PhaseTracker, step platformUpgradeStep) error {
+	options := bootstrap.CiliumOptionsForProfile(currentConfig.ProfileSpec())
+	if err := bootstrap.EnsureCilium(kubeconfig, step.Target, options); err != nil {
+		return rollbackCiliumUpgrade(tracker, step.revision, err)
+	}
+	tracker.UpdateDetail("waiting for platform health gate")
+	if err := waitForHealthyStatus(ctx, platformUpgradeGateTimeout); err != nil {
+		return rollbackCiliumUpgrade(tracker, step.revision, err)
+	}
+	return nil
+}
+
+func rollbackCiliumUpgrade(tracker *tui.PhaseTracker, revision int, cause error) error {
+	tracker.UpdateDetail(fmt.Sprintf("rolling back cilium to revision %d", revision))
+	if err := bootstrap.RollbackCilium(kubeconfig, revision); err != nil {
+		return fmt.Errorf("cilium upgrade failed (%v) and rollback failed: %w", cause, err)
+	}
+	return fmt.Errorf("cilium upgrade failed and was rolled back to revision %d: %w", revision, cause)
+}
+
+func upgradeFlux(ctx context.Context, tracker *tui.PhaseTracker, version string) error {
+	if err := bootstrap.UpgradeFlux(ctx, kubeconfig, version); err != nil {
+		return fmt.Errorf("upgrade flux: %w", err)
+	}
+	tracker.UpdateDetail("waiting for kustomizations...")
+	if err := waitForFluxTUI(tracker); err != nil {
+		return err
+	}
+	tracker.UpdateDetail("waiting for platform health gate")
+	if err := waitForHealthyStatus(ctx, platformUpgradeGateTimeout); err != nil {
+		return fmt.Errorf("platform unhealthy after flux upgrade: %w", err)
+	}
+	return nil
+}
+
+func upgradeAddons(ctx context.Context, tracker *tui.PhaseTracker, targets platformUpgradeTargets) error {
+	if err := bootstrap.UpdateFluxSource(ctx, kubeconfig, targets.RepoURL, targets.Branch); err != nil {
+		return err
+	}
+	tracker.UpdateDetail("waiting for kustomizations...")
+	if err := waitForFluxTUI(tracker); err != nil {
+		return err
+	}
+	tracker.UpdateDetail("waiting for platform health gate")
+	if err := waitForHealthyStatus(ctx, platformUpgradeGateTimeout); err != nil {
+		return fmt.Errorf("platform unhealthy after addon update: %w", err)
+	}
+	return nil
+}
+
+var platformSetProfileCmd = &cobra.Command{
+	Use:   "set-profile <small|medium|large|custom>",
+	Short: "Switch the platform profile of a running cluster",
+	Long: "Diffs the Flux Kustomizations and components between the profile recorded in the shoulders-platform-config ConfigMap " +
+		"and the target, warns about resources that would break, and after confirmation re-applies the platform config and " +
+		"Kustomizations and waits for Flux to prune removed components. With --resize-nodes it also recreates the vind worker nodes " +
+		"for the target topology.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+
+		targetConfig := *currentConfig
+		targetConfig.Platform.Profile = args[0]
+		if err := targetConfig.Validate(); err != nil {
+			return err
+		}
+		from, err := bootstrap.InstalledProfileSpec(cmd.Context(), kubeconfig)
+		if err != nil {
+			return err
+		}
+		change := bootstrap.PlanProfileChange(currentConfig.FluxPathPrefix(), from, targetConfig.ProfileSpec())
+
+		if err := renderProfileChange(change, format); err != nil {
+			return err
+		}
+		if change.Empty() {
+			fmt.Printf("Cluster already runs the %s profile\n", change.ToProfile)
+			return saveProfile(targetConfig.Platform)
+		}
+		if note := nodeResizeNote(change, currentConfig.Provider(), platformProfileResize); note != "" && format == output.Table {
+			fmt.Println(note)
+		}
+
+		warnings, err := profileChangeWarnings(cmd.Context(), change)
+		if err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			pterm.Warning.Println(warning)
+		}
+		if platformProfileDryRun {
+			return nil
+		}
+		if !platformProfileYes {
+			confirmed, _ := pterm.DefaultInteractiveConfirm.Show(fmt.Sprintf("Switch platform profile from %s to %s?", change.FromProfile, change.ToProfile))
+			if !confirmed {
+				return fmt.Errorf("profile switch cancelled")
+			}
+		}
+
+		clusterName := currentConfig.ClusterName()
+		if err := runProfileChange(cmd.Context(), clusterName, change); err != nil {
+			return err
+		}
+		return saveProfile(targetConfig.Platform)
+	},
+}
+
+// nodeResizeNote tells whether the vind worker nodes follow a profile change
+// that moves to another base topology. Recreating nodes restarts every pod on
+// them, so it only happens with --resize-nodes.
+func nodeResizeNote(change bootstrap.ProfileChange, provider string, resize bool) string {
+	if provider != config.ProviderVind || change.From.Base == change.To.Base {
+		return ""
+	}
+	if resize {
+		return fmt.Sprintf("Nodes: the vind worker nodes will be recreated for the %s topology", change.To.Base)
+	}
+	return fmt.Sprintf("Nodes: the vind worker nodes keep their current topology; add --resize-nodes to recreate them for the %s topology", change.To.Base)
+}
+
+func saveProfile(platform config.PlatformConfig) error {
+	return saveConfigChange(func(cfg *config.Config) {
+		cfg.Platform.Profile = platform.Profile
+		if platform.Profile == config.ProfileCustom {
+			cfg.Platform.Components = platform.Components
+		}
+	})
+}
+
+func renderProfileChange(change bootstrap.ProfileChange, format output.Format) error {
+	if format != output.Table {
+		payload, err := output.Render(change, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
+		return nil
+	}
+
+	rows := [][]string{}
+	for _, name := range change.AddedKustomizations {
+		rows = append(rows, []string{"Kustomization", name, "add"})
+	}
+	for _, name := range change.RemovedKustomizations {
+		rows = append(rows, []string{"Kustomization", name, "remove"})
+	}
+	for _, name := range change.ChangedKustomizations {
+		rows = append(rows, []string{"Kustomization", name, "update"})
+	}
+	for _, name := range change.EnabledComponents {
+		rows = append(rows, []string{"Component", name, "enable"})
+	}
+	for _, name := range change.DisabledComponents {
+		rows = append(rows, []string{"Component", name, "disable"})
+	}
+	for _, name := range change.ChangedSettings {
+		rows = append(rows, []string{"Setting", name, "update"})
+	}
+	for _, name := range change.RemovedResources {
+		rows = append(rows, []string{"Resource", name, "prune"})
+	}
+	fmt.Printf("Profile %s -> %s\n", change.FromProfile, change.ToProfile)
+	if len(rows) == 0 {
+		return nil
+	}
+	return output.PrintTable([]string{"Kind", "Name", "Action"}, rows)
+}
+
+// profileChangeWarnings lists the existing claims whose backing composition
+// the target profile removes.
+func profileChangeWarnings(ctx context.Context, change bootstrap.ProfileChange) ([]string, error) {
+	if !change.From.EventStreams || change.To.EventStreams {
+		return nil, nil
+	}
+	client, err := kube.NewDynamicClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "eventstreams"}
+	list, err := client.Resource(gvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if isMissingAPIResource(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	warnings := []string{}
+	for _, item := range list.Items {
+		warnings = append(warnings, fmt.Sprintf("EventStream %s/%s will break: the %s profile removes Kafka and the EventStream composition", item.GetNamespace(), item.GetName(), change.ToProfile))
+	}
+	return warnings, nil
+}
+
+func runProfileChange(ctx context.Context, clusterName string, change bootstrap.ProfileChange) error {
+	resize := platformProfileResize && currentConfig.Provider() == config.ProviderVind && change.From.Base != change.To.Base
+	vindConfig := manifests.VindConfigForProfile(change.To.Base)
+	scaleUp := false
+	if resize {
+		current, err := bootstrap.VindWorkerCount(ctx, clusterName)
+		if err != nil {
+			return err
+		}
+		target, err := bootstrap.VindConfigWorkerCount(vindConfig)
+		if err != nil {
+			return err
+		}
+		resize = current != target
+		scaleUp = target > current
+	}
+
+	phases := []string{}
+	if resize && scaleUp {
+		phases = append(phases, "Resize vind nodes")
+	}
+	if change.CiliumChanged() && currentConfig.CiliumEnabled() {
+		phases = append(phases, "Update Cilium CNI")
+	}
+	phases = append(phases, "Apply platform profile", "Wait for Flux reconciliation", "Prune removed components")
+	if resize && !scaleUp {
+		phases = append(phases, "Resize vind nodes")
+	}
+
+	tracker := tui.NewPhaseTracker(phases, true)
+	defer tracker.Stop()
+
+	// Grow the cluster before new components are scheduled onto it, and only
+	// shrink it once the components that needed the capacity are gone.
+	if resize && scaleUp {
+		tracker.Start(fmt.Sprintf("recreating vind cluster %q with the %s topology", clusterName, change.To.Base))
+		if err := bootstrap.ResizeVindCluster(ctx, clusterName, vindConfig, currentConfig.DexHost()); err != nil {
+			tracker.Fail(err.Error())
+			return fmt.Errorf("resize vind cluster: %w", err)
+		}
+		tracker.Complete()
+	}
+
+	if change.CiliumChanged() && currentConfig.CiliumEnabled() {
+		tracker.Start("upgrading cilium helm release with the profile values")
+		if err := bootstrap.EnsureCilium(kubeconfig, currentConfig.CiliumVersion(), bootstrap.CiliumOptionsForProfile(change.To)); err != nil {
+			tracker.Fail(err.Error())
+			return fmt.Errorf("update cilium: %w", err)
+		}
+		tracker.Complete()
+	}
+
+	tracker.Start("patching shoulders-platform-config and applying kustomizations")
+	if err := bootstrap.ApplyProfileChange(ctx, kubeconfig, change); err != nil {
+		tracker.Fail(err.Error())
+		return err
+	}
+	tracker.Complete()
+
+	tracker.Start("waiting for kustomizations...")
+	if err := waitForFluxTUI(tracker); err != nil {
+		tracker.Fail(err.Error())
+		return err
+	}
+	tracker.Complete()
+
+	tracker.Start(fmt.Sprintf("waiting for %d resources to be pruned", len(change.RemovedResources)))
+	if err := bootstrap.WaitForProfilePruned(ctx, kubeconfig, change, platformProfilePruneTimeout); err != nil {
+		tracker.Fail(err.Error())
+		return fmt.Errorf("wait for pruned components: %w", err)
+	}
+	tracker.Complete()
+
+	if resize && !scaleUp {
+		tracker.Start(fmt.Sprintf("recreating vind cluster %q with the %s topology", clusterName, change.To.Base))
+		if err := bootstrap.ResizeVindCluster(ctx, clusterName, vindConfig, currentConfig.DexHost()); err != nil {
+			tracker.Fail(err.Error())
+			return fmt.Errorf("resize vind cluster: %w", err)
+		}
+		tracker.Complete()
+	}
+
+	fmt.Println()
+	fmt.Println(tracker.Summary())
+	fmt.Println()
+	return nil
+}
+
+func init() {
+	platformUpgradeCmd.Flags().StringVar(&platformUpgradeCilium, "cilium", "", "Target Cilium chart version (defaults to platform.cilium.version)")
+	platformUpgradeCmd.Flags().StringVar(&platformUpgradeFlux, "flux", "", "Target Flux version (defaults to platform.flux.version)")
+	platformUpgradeCmd.Flags().StringVar(&platformUpgradeAddonsRef, "addons-ref", "", "Target addon Git branch (defaults to platform.flux.gitRepository.branch)")
+	platformUpgradeCmd.Flags().BoolVar(&platformUpgradeDryRun, "dry-run", false, "Print the upgrade plan without applying it")
+	platformUpgradeCmd.Flags().DurationVar(&platformUpgradeGateTimeout, "gate-timeout", 5*time.Minute, "How long each health gate waits for the platform to report healthy")
+
+	platformSetProfileCmd.Flags().BoolVarP(&platformProfileYes, "yes", "y", false, "Skip the confirmation prompt")
+	platformSetProfileCmd.Flags().BoolVar(&platformProfileDryRun, "dry-run", false, "Print the profile diff without applying it")
+	platformSetProfileCmd.Flags().BoolVar(&platformProfileResize, "resize-nodes", false, "Also recreate the vind worker nodes for the target profile topology")
+	platformSetProfileCmd.Flags().DurationVar(&platformProfilePruneTimeout, "prune-timeout", 10*time.Minute, "How long to wait for Flux to prune removed components")
+
+	platformCmd.AddCommand(platformUpgradeCmd)
+	platformCmd.AddCommand(platformSetProfileCmd)
+}
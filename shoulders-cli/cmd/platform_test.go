@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/bootstrap"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+)
+
+func TestNodeResizeNoteIsOptIn(t *testing.T) {
+	change := bootstrap.ProfileChange{
+		From: config.ProfileSpecFor(config.ProfileMedium),
+		To:   config.ProfileSpecFor(config.ProfileSmall),
+	}
+	if flag := platformSetProfileCmd.Flags().Lookup("resize-nodes"); flag == nil || flag.DefValue != "false" {
+		t.Fatalf("expected --resize-nodes to default to false, got %#v", flag)
+	}
+	if note := nodeResizeNote(change, config.ProviderVind, false); !strings.Contains(note, "--resize-nodes") {
+		t.Fatalf("expected the plan to offer --resize-nodes, got %q", note)
+	}
+	if note := nodeResizeNote(change, config.ProviderVind, true); !strings.Contains(note, "recreated") {
+		t.Fatalf("expected the plan to announce the resize, got %q", note)
+	}
+	if note := nodeResizeNote(change, config.ProviderExisting, false); note != "" {
+		t.Fatalf("expected no note for existing clusters, got %q", note)
+	}
+	change.To = change.From
+	if note := nodeResizeNote(change, config.ProviderVind, false); note != "" {
+		t.Fatalf("expected no note without a topology change, got %q", note)
+	}
+}
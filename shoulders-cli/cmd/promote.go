@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	promoteFrom          string
+	promoteTo            string
+	promoteTag           string
+	promoteFromNamespace string
+	promoteToNamespace   string
+	promoteYes           bool
+	promoteDryRun        bool
+)
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Promote resources between environments",
+}
+
+var promoteAppCmd = &cobra.Command{
+	Use:   "app <name>",
+	Short: "Copy a WebApplication spec from one environment to another",
+	Long: "Reads the WebApplication from the source environment's current workspace, optionally overrides its image tag, " +
+		"shows a diff against the target environment and applies it there after confirmation.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if promoteFrom == promoteTo {
+			return fmt.Errorf("--from and --to must name different environments")
+		}
+		source, err := newPromoteTarget(promoteFrom, promoteFromNamespace)
+		if err != nil {
+			return err
+		}
+		target, err := newPromoteTarget(promoteTo, promoteToNamespace)
+		if err != nil {
+			return err
+		}
+
+		gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "webapplications"}
+		sourceApp, err := source.client.Resource(gvr).Namespace(source.namespace).Get(cmd.Context(), name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("get WebApplication %s in %s: %w", name, source.label(), err)
+		}
+		spec, _, err := unstructured.NestedMap(sourceApp.Object, "spec")
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			spec = map[string]interface{}{}
+		}
+		if promoteTag != "" {
+			spec["tag"] = promoteTag
+		}
+
+		var current map[string]interface{}
+		targetApp, err := target.client.Resource(gvr).Namespace(target.namespace).Get(cmd.Context(), name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			targetApp = nil
+		case err != nil:
+			return fmt.Errorf("get WebApplication %s in %s: %w", name, target.label(), err)
+		default:
+			current, _, err = unstructured.NestedMap(targetApp.Object, "spec")
+			if err != nil {
+				return err
+			}
+		}
+
+		diff, err := webApplicationSpecDiff(current, spec, target.label()+"/"+name, source.label()+"/"+name)
+		if err != nil {
+			return err
+		}
+		if diff == "" {
+			fmt.Printf("WebApplication %s in %s already matches %s\n", name, target.label(), source.label())
+			return nil
+		}
+		fmt.Print(diff)
+		if promoteDryRun {
+			return nil
+		}
+		if !promoteYes {
+			confirmed, _ := pterm.DefaultInteractiveConfirm.Show(fmt.Sprintf("Promote %s to %s?", name, target.label()))
+			if !confirmed {
+				return fmt.Errorf("promotion cancelled")
+			}
+		}
+
+		if targetApp == nil {
+			targetApp = &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": v1alpha1.Group + "/" + v1alpha1.Version,
+				"kind":       "WebApplication",
+				"metadata": map[string]interface{}{
+					"name":      name,
+					"namespace": target.namespace,
+				},
+			}}
+		}
+		if err := unstructured.SetNestedMap(targetApp.Object, spec, "spec"); err != nil {
+			return err
+		}
+		if err := kube.Apply(cmd.Context(), target.client, gvr, target.namespace, targetApp); err != nil {
+			return err
+		}
+		fmt.Printf("WebApplication %s promoted from %s to %s\n", name, source.label(), target.label())
+		return nil
+	},
+}
+
+type promoteTarget struct {
+	environment string
+	namespace   string
+	client      dynamic.Interface
+}
+
+func (target promoteTarget) label() string {
+	return target.environment + "/" + target.namespace
+}
+
+func newPromoteTarget(environment, namespace string) (promoteTarget, error) {
+	env, err := currentConfig.ForEnvironment(environment)
+	if err != nil {
+		return promoteTarget{}, err
+	}
+	if namespace == "" {
+		namespace = env.CurrentWorkspace
+	}
+	if namespace == "" {
+		return promoteTarget{}, fmt.Errorf("environment %s has no active workspace; pass a namespace flag", env.Environment())
+	}
+	client, err := kube.NewDynamicClientForContext(environmentKubeconfig(env), environmentContext(env))
+	if err != nil {
+		return promoteTarget{}, fmt.Errorf("connect to environment %s: %w", env.Environment(), err)
+	}
+	return promoteTarget{environment: env.Environment(), namespace: namespace, client: client}, nil
+}
+
+// webApplicationSpecDiff returns a unified diff between the current and the
+// promoted spec, or an empty string when they match. A nil current spec
+// renders as an empty document.
+func webApplicationSpecDiff(current, promoted map[string]interface{}, currentLabel, promotedLabel string) (string, error) {
+	render := func(spec map[string]interface{}) (string, error) {
+		if spec == nil {
+			return "", nil
+		}
+		payload, err := yaml.Marshal(spec)
+		if err != nil {
+			return "", err
+		}
+		return string(payload), nil
+	}
+	before, err := render(current)
+	if err != nil {
+		return "", err
+	}
+	after, err := render(promoted)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(before, after, currentLabel, promotedLabel)
+}
+
+// unifiedDiff returns a unified diff between two documents, or an empty
+// string when they match.
+func unifiedDiff(before, after, beforeLabel, afterLabel string) (string, error) {
+	if before == after {
+		return "", nil
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(before),
+		B:        difflib.SplitLines(after),
+		FromFile: beforeLabel,
+		ToFile:   afterLabel,
+		Context:  3,
+	})
+}
+
+func init() {
+	promoteAppCmd.Flags().StringVar(&promoteFrom, "from", "", "Environment to promote from")
+	promoteAppCmd.Flags().StringVar(&promoteTo, "to", "", "Environment to promote to")
+	promoteAppCmd.Flags().StringVar(&promoteTag, "tag", "", "Override the image tag in the target environment")
+	promoteAppCmd.Flags().StringVar(&promoteFromNamespace, "from-namespace", "", "Workspace namespace in the source environment (defaults to its current workspace)")
+	promoteAppCmd.Flags().StringVar(&promoteToNamespace, "to-namespace", "", "Workspace namespace in the target environment (defaults to its current workspace)")
+	promoteAppCmd.Flags().BoolVarP(&promoteYes, "yes", "y", false, "Skip the confirmation prompt")
+	promoteAppCmd.Flags().BoolVar(&promoteDryRun, "dry-run", false, "Print the diff without applying it")
+	_ = promoteAppCmd.MarkFlagRequired("from")
+	_ = promoteAppCmd.MarkFlagRequired("to")
+
+	promoteCmd.AddCommand(promoteAppCmd)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWebApplicationSpecDiff(t *testing.T) {
+	current := map[string]interface{}{"image": "ghcr.io/acme/api", "tag": "1.0.0", "replicas": 2}
+	promoted := map[string]interface{}{"image": "ghcr.io/acme/api", "tag": "1.1.0", "replicas": 2}
+
+	diff, err := webApplicationSpecDiff(current, promoted, "staging/team/api", "dev/team/api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"--- staging/team/api", "+++ dev/team/api", "-tag: 1.0.0", "+tag: 1.1.0"} {
+		if !strings.Contains(diff, want) {
+			t.Fatalf("expected diff to contain %q\n%s", want, diff)
+		}
+	}
+
+	diff, err = webApplicationSpecDiff(promoted, promoted, "a", "b")
+	if err != nil || diff != "" {
+		t.Fatalf("expected no diff for identical specs, got %q (%v)", diff, err)
+	}
+
+	diff, err = webApplicationSpecDiff(nil, promoted, "a", "b")
+	if err != nil || !strings.Contains(diff, "+image: ghcr.io/acme/api") {
+		t.Fatalf("expected a new app to render as additions, got %q (%v)", diff, err)
+	}
+}
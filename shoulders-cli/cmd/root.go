@@ -3,7 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/jherreros/shoulders/shoulders-cli/internal/bootstrap"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
@@ -15,7 +17,10 @@ var Version = "dev"
 
 // Commands that do not require a shoulders cluster context.
 var skipClusterCheck = map[string]bool{
+	"config":  true,
 	"down":    true,
+	"env":     true,
+	"promote": true,
 	"init":    true,
 	"up":      true,
 	"update":  true,
@@ -25,6 +30,9 @@ var skipClusterCheck = map[string]bool{
 	"skill":   true,
 	"help":    true,
 	"version": true,
+
+	"workspace template": true,
+	"certs export-ca":    true,
 }
 
 var (
@@ -45,9 +53,11 @@ var (
 	}
 	currentConfig    *config.Config
 	kubeconfig       string
+	kubeconfigFlag   string
 	outputFormat     string
 	configFile       string
 	configOverrides  []string
+	environmentName  string
 	loadedConfigPath string
 )
 
@@ -60,19 +70,28 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "Path to kubeconfig file")
+	rootCmd.PersistentFlags().StringVar(&kubeconfigFlag, "kubeconfig", "", "Path to kubeconfig file")
 	rootCmd.PersistentFlags().StringVar(&configFile, "config", defaultConfigPath(), "Path to config file")
 	rootCmd.PersistentFlags().StringArrayVar(&configOverrides, "set", nil, "Set a config value override (key=value), repeatable")
+	rootCmd.PersistentFlags().StringVar(&environmentName, "env", "", "Named environment from the config file to use (defaults to current_environment)")
+	// app and workload commands use --env for container variables, so the
+	// environment can also be selected with --environment or -E.
+	rootCmd.PersistentFlags().StringVarP(&environmentName, "environment", "E", "", "Alias for --env")
 	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", string(output.Table), "Output format: table|json|yaml")
 
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(upCmd)
 	rootCmd.AddCommand(downCmd)
 	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(platformCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(envCmd)
+	rootCmd.AddCommand(promoteCmd)
 	rootCmd.AddCommand(workspaceCmd)
 	rootCmd.AddCommand(appCmd)
 	rootCmd.AddCommand(workloadCmd)
 	rootCmd.AddCommand(infraCmd)
+	rootCmd.AddCommand(secretCmd)
 	rootCmd.AddCommand(clusterCmd)
 	rootCmd.AddCommand(dashboardCmd)
 	rootCmd.AddCommand(portalCmd)
@@ -82,6 +101,7 @@ func init() {
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(stopCmd)
 	rootCmd.AddCommand(skillCmd)
+	rootCmd.AddCommand(certsCmd)
 }
 
 func outputOption() (output.Format, error) {
@@ -95,22 +115,35 @@ func loadRuntimeConfig() error {
 	}
 	loadedConfigPath = path
 
-	cfg, err := config.LoadWithOverrides(configOverrides, path)
+	cfg, err := config.LoadEnvironment(environmentName, configOverrides, path)
 	if err != nil {
 		return err
 	}
 	currentConfig = cfg
 
-	if kubeconfig == "" {
-		if envKubeconfig := os.Getenv("SHOULDERS_KUBECONFIG"); envKubeconfig != "" {
-			kubeconfig = envKubeconfig
-		} else if cfg.Cluster.Kubeconfig != "" {
-			kubeconfig = cfg.Cluster.Kubeconfig
-		}
+	kubeconfig = environmentKubeconfig(cfg)
+	kube.SetContextOverride(environmentContext(cfg))
+	return nil
+}
+
+// environmentKubeconfig resolves the kubeconfig path for cfg. The --kubeconfig
+// flag takes precedence over cluster.kubeconfig, which SHOULDERS_KUBECONFIG
+// overrides like the other SHOULDERS_* variables.
+func environmentKubeconfig(cfg *config.Config) string {
+	if kubeconfigFlag != "" {
+		return kubeconfigFlag
 	}
+	return cfg.Cluster.Kubeconfig
+}
 
-	kube.SetContextOverride(cfg.Cluster.Context)
-	return nil
+// environmentContext resolves the kube context for cfg. The default
+// environment keeps using the kubeconfig's current context for vind clusters,
+// while named environments always target their own cluster.
+func environmentContext(cfg *config.Config) string {
+	if cfg.Cluster.Context != "" || cfg.Environment() == config.DefaultEnvironment || cfg.Provider() != config.ProviderVind {
+		return cfg.Cluster.Context
+	}
+	return bootstrap.ContextPrefix + cfg.ClusterName()
 }
 
 func defaultConfigPath() string {
@@ -124,9 +157,7 @@ func defaultConfigPath() string {
 // ensureShouldersCluster verifies the current kubeconfig context belongs to
 // a compatible cluster. Commands in skipClusterCheck are exempt.
 func ensureShouldersCluster(cmd *cobra.Command) error {
-	// Walk up to find the top-level subcommand name.
-	name := rootCmdName(cmd)
-	if skipClusterCheck[name] {
+	if clusterCheckSkipped(cmd) {
 		return nil
 	}
 	if currentConfig != nil && currentConfig.Provider() == config.ProviderExisting {
@@ -150,11 +181,15 @@ func ensureShouldersCluster(cmd *cobra.Command) error {
 	return nil
 }
 
-func rootCmdName(cmd *cobra.Command) string {
-	for cmd.HasParent() && cmd.Parent().HasParent() {
-		cmd = cmd.Parent()
+// clusterCheckSkipped reports whether cmd or one of its parents is listed in
+// skipClusterCheck by its path below the root command.
+func clusterCheckSkipped(cmd *cobra.Command) bool {
+	for current := cmd; current.HasParent(); current = current.Parent() {
+		if skipClusterCheck[strings.TrimPrefix(current.CommandPath(), current.Root().Name()+" ")] {
+			return true
+		}
 	}
-	return cmd.Name()
+	return false
 }
 
 func configuredClusterName(cmd *cobra.Command, flagName, flagValue string) string {
@@ -167,9 +202,17 @@ func configuredClusterName(cmd *cobra.Command, flagName, flagValue string) strin
 	return currentConfig.ClusterName()
 }
 
-func saveCurrentConfig() error {
-	if currentConfig == nil {
-		return nil
+// saveConfigChange applies edit to the runtime config and to the config file
+// as stored, then saves the file. SHOULDERS_* variables and --set overrides
+// only live in the runtime config, so they are never written to the file.
+func saveConfigChange(edit func(cfg *config.Config)) error {
+	if currentConfig != nil {
+		edit(currentConfig)
+	}
+	cfg, err := config.LoadFile(environmentName, loadedConfigPath)
+	if err != nil {
+		return err
 	}
-	return config.Save(currentConfig, loadedConfigPath)
+	edit(cfg)
+	return config.Save(cfg, loadedConfigPath)
 }
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+)
+
+// gatewayDurationPattern is the duration format HTTPRoute timeouts accept.
+var gatewayDurationPattern = regexp.MustCompile(`^([0-9]{1,5}(h|m|s|ms)){1,4}$`)
+
+var (
+	appRoutePath    string
+	appRouteRewrite string
+	appExtraHosts   []string
+	appRouteTimeout string
+	appRouteTLS     bool
+)
+
+func registerRouteFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&appRoutePath, "path", "", "Route only requests under this path prefix to the app")
+	cmd.Flags().StringVar(&appRouteRewrite, "rewrite", "", "Replace the --path prefix with this path before forwarding, for example /")
+	cmd.Flags().StringArrayVar(&appExtraHosts, "extra-host", nil, "Additional hostname routed to the app, repeatable")
+	cmd.Flags().StringVar(&appRouteTimeout, "route-timeout", "", "Gateway request timeout, for example 30s")
+	cmd.Flags().BoolVar(&appRouteTLS, "tls", false, "Serve the route over HTTPS with a certificate from the local CA")
+}
+
+// buildRouteRules turns --path and --rewrite into route rules. No path means
+// the default catch-all rule.
+func buildRouteRules(path, rewrite string) ([]v1alpha1.RouteRule, error) {
+	path = strings.TrimSpace(path)
+	rewrite = strings.TrimSpace(rewrite)
+	if path == "" {
+		if rewrite != "" {
+			return nil, fmt.Errorf("--rewrite requires --path")
+		}
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("--path must start with /, got %q", path)
+	}
+	rule := v1alpha1.RouteRule{Path: &v1alpha1.RoutePathMatch{Type: "PathPrefix", Value: path}}
+	if rewrite != "" {
+		if !strings.HasPrefix(rewrite, "/") {
+			return nil, fmt.Errorf("--rewrite must start with /, got %q", rewrite)
+		}
+		rule.Rewrite = &v1alpha1.RouteRewrite{ReplacePrefixMatch: rewrite}
+	}
+	return []v1alpha1.RouteRule{rule}, nil
+}
+
+func buildRouteTimeouts(timeout string) (*v1alpha1.RouteTimeouts, error) {
+	timeout = strings.TrimSpace(timeout)
+	if timeout == "" {
+		return nil, nil
+	}
+	if !gatewayDurationPattern.MatchString(timeout) {
+		return nil, fmt.Errorf("invalid --route-timeout %q (expected a duration such as 30s, 1m or 500ms)", timeout)
+	}
+	return &v1alpha1.RouteTimeouts{Request: timeout}, nil
+}
+
+func buildExtraHosts(entries []string) []string {
+	hosts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if host := strings.TrimSpace(entry); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	return hosts
+}
+
+// appProtocol is the spec.protocol selected by --grpc. Plain HTTP is left
+// out of new specs as it is the default.
+func appProtocol() string {
+	if appGRPC {
+		return "grpc"
+	}
+	return ""
+}
+
+// buildRouteSpec builds the route of a new WebApplication from the route
+// flags, or returns nil when they keep the defaults.
+func buildRouteSpec() (*v1alpha1.RouteSpec, error) {
+	rules, err := buildRouteRules(appRoutePath, appRouteRewrite)
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := buildRouteTimeouts(appRouteTimeout)
+	if err != nil {
+		return nil, err
+	}
+	hosts := buildExtraHosts(appExtraHosts)
+	if appGRPC && (rules != nil || timeouts != nil) {
+		return nil, fmt.Errorf("--grpc cannot be combined with --path, --rewrite or --route-timeout; match gRPC methods in spec.route.rules instead")
+	}
+	if appInternal {
+		if rules != nil || timeouts != nil || hosts != nil || appRouteTLS {
+			return nil, fmt.Errorf("--internal cannot be combined with --path, --rewrite, --extra-host, --route-timeout or --tls")
+		}
+		return &v1alpha1.RouteSpec{Enabled: boolPtr(false)}, nil
+	}
+	if rules == nil && timeouts == nil && hosts == nil && !appRouteTLS {
+		return nil, nil
+	}
+	return &v1alpha1.RouteSpec{Hosts: hosts, TLS: appRouteTLS, Rules: rules, Timeouts: timeouts}, nil
+}
+
+// applyRouteFlagOverrides updates the route of an unstructured spec in place,
+// keeping the route fields no flag was passed for.
+func applyRouteFlagOverrides(cmd *cobra.Command, spec map[string]interface{}) (bool, error) {
+	if !anyFlagChanged(cmd, "path", "rewrite", "extra-host", "route-timeout", "tls") {
+		return false, nil
+	}
+	route, _ := spec["route"].(map[string]interface{})
+	if route == nil {
+		route = map[string]interface{}{}
+	}
+	if anyFlagChanged(cmd, "path", "rewrite") {
+		if err := mergeRouteRuleFlags(cmd, route); err != nil {
+			return false, err
+		}
+	}
+	if cmd.Flags().Changed("extra-host") {
+		hosts := buildExtraHosts(appExtraHosts)
+		if hosts == nil {
+			delete(route, "hosts")
+		} else {
+			converted := make([]interface{}, 0, len(hosts))
+			for _, host := range hosts {
+				converted = append(converted, host)
+			}
+			route["hosts"] = converted
+		}
+	}
+	if cmd.Flags().Changed("route-timeout") {
+		timeouts, err := buildRouteTimeouts(appRouteTimeout)
+		if err != nil {
+			return false, err
+		}
+		if timeouts == nil {
+			delete(route, "timeouts")
+		} else {
+			route["timeouts"] = map[string]interface{}{"request": timeouts.Request}
+		}
+	}
+	if cmd.Flags().Changed("tls") {
+		route["tls"] = appRouteTLS
+	}
+	spec["route"] = route
+	return true, nil
+}
+
+// mergeRouteRuleFlags applies --path and --rewrite to the first route rule,
+// keeping its header matches, modifiers and the other rules. --rewrite can
+// reuse the path prefix the rule already has. Clearing the path of a rule
+// that has nothing else left restores the default catch-all rule.
+func mergeRouteRuleFlags(cmd *cobra.Command, route map[string]interface{}) error {
+	rules, _ := route["rules"].([]interface{})
+	rule := map[string]interface{}{}
+	if len(rules) > 0 {
+		if first, ok := rules[0].(map[string]interface{}); ok {
+			rule = first
+		}
+	}
+
+	if cmd.Flags().Changed("path") {
+		path := strings.TrimSpace(appRoutePath)
+		switch {
+		case path == "":
+			delete(rule, "path")
+			clearPrefixRewrite(rule)
+		case !strings.HasPrefix(path, "/"):
+			return fmt.Errorf("--path must start with /, got %q", path)
+		default:
+			rule["path"] = map[string]interface{}{"type": "PathPrefix", "value": path}
+		}
+	}
+	if cmd.Flags().Changed("rewrite") {
+		rewrite := strings.TrimSpace(appRouteRewrite)
+		if rewrite == "" {
+			clearPrefixRewrite(rule)
+		} else {
+			if !strings.HasPrefix(rewrite, "/") {
+				return fmt.Errorf("--rewrite must start with /, got %q", rewrite)
+			}
+			path, _ := rule["path"].(map[string]interface{})
+			if path == nil {
+				return fmt.Errorf("--rewrite requires --path")
+			}
+			if pathType, _ := path["type"].(string); pathType != "" && pathType != "PathPrefix" {
+				return fmt.Errorf("--rewrite replaces a path prefix, but the first route rule matches an %s path; pass --path too", pathType)
+			}
+			if _, ok := rule["redirect"]; ok {
+				return fmt.Errorf("--rewrite cannot be added to a redirect rule")
+			}
+			filter, _ := rule["rewrite"].(map[string]interface{})
+			if filter == nil {
+				filter = map[string]interface{}{}
+			}
+			delete(filter, "replaceFullPath")
+			filter["replacePrefixMatch"] = rewrite
+			rule["rewrite"] = filter
+		}
+	}
+
+	switch {
+	case len(rule) > 0 && len(rules) > 0:
+		rules[0] = rule
+		route["rules"] = rules
+	case len(rule) > 0:
+		route["rules"] = []interface{}{rule}
+	case len(rules) > 1:
+		route["rules"] = rules[1:]
+	default:
+		delete(route, "rules")
+	}
+	return nil
+}
+
+// clearPrefixRewrite drops the prefix replacement of a rule, which only works
+// together with a path prefix match.
+func clearPrefixRewrite(rule map[string]interface{}) {
+	filter, _ := rule["rewrite"].(map[string]interface{})
+	if filter == nil {
+		return
+	}
+	delete(filter, "replacePrefixMatch")
+	if len(filter) == 0 {
+		delete(rule, "rewrite")
+	}
+}
+
+// validateGRPCRoute rejects the HTTP-only route settings a GRPCRoute cannot
+// carry, which the composition would otherwise drop. The XRD enforces the
+// same for app apply.
+func validateGRPCRoute(spec map[string]interface{}) error {
+	if protocol, _ := spec["protocol"].(string); protocol != "grpc" {
+		return nil
+	}
+	route, _ := spec["route"].(map[string]interface{})
+	if _, ok := route["timeouts"]; ok {
+		return fmt.Errorf("gRPC routes do not support timeouts; remove them with --route-timeout \"\"")
+	}
+	rules, _ := route["rules"].([]interface{})
+	for i, item := range rules {
+		rule, _ := item.(map[string]interface{})
+		for _, field := range []string{"path", "rewrite", "redirect"} {
+			if _, ok := rule[field]; ok {
+				return fmt.Errorf("gRPC routes match methods, so route rule %d cannot set %s", i+1, field)
+			}
+		}
+	}
+	return nil
+}
+
+// routeUsesTLS reports whether an unstructured WebApplication spec asks for
+// an HTTPS route.
+func routeUsesTLS(spec map[string]interface{}) bool {
+	route, _ := spec["route"].(map[string]interface{})
+	tls, _ := route["tls"].(bool)
+	return tls
+}
+
+// setRouteEnabled switches the route on or off without dropping its hosts,
+// rules or timeouts.
+func setRouteEnabled(spec map[string]interface{}, enabled bool) {
+	route, _ := spec["route"].(map[string]interface{})
+	if route == nil {
+		route = map[string]interface{}{}
+	}
+	route["enabled"] = enabled
+	spec["route"] = route
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestBuildRouteRules(t *testing.T) {
+	rules, err := buildRouteRules("/api", "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Path.Type != "PathPrefix" || rules[0].Path.Value != "/api" {
+		t.Fatalf("unexpected rules: %#v", rules)
+	}
+	if rules[0].Rewrite == nil || rules[0].Rewrite.ReplacePrefixMatch != "/" {
+		t.Fatalf("expected a prefix rewrite to /, got %#v", rules[0].Rewrite)
+	}
+
+	if rules, err := buildRouteRules("", ""); err != nil || rules != nil {
+		t.Fatalf("expected no rules without a path, got %#v, %v", rules, err)
+	}
+	if _, err := buildRouteRules("", "/"); err == nil {
+		t.Fatalf("expected --rewrite without --path to fail")
+	}
+	if _, err := buildRouteRules("api", ""); err == nil {
+		t.Fatalf("expected a relative path to fail")
+	}
+}
+
+func TestBuildRouteTimeouts(t *testing.T) {
+	timeouts, err := buildRouteTimeouts("1m30s")
+	if err != nil || timeouts.Request != "1m30s" {
+		t.Fatalf("expected 1m30s, got %#v, %v", timeouts, err)
+	}
+	if _, err := buildRouteTimeouts("1.5s"); err == nil {
+		t.Fatalf("expected a fractional duration to fail")
+	}
+}
+
+func TestApplyRouteFlagOverridesKeepsRouteFields(t *testing.T) {
+	cmd := &cobra.Command{}
+	registerRouteFlags(cmd)
+	if err := cmd.Flags().Set("path", "/api"); err != nil {
+		t.Fatalf("set flag: %v", err)
+	}
+	defer func() { appRoutePath = "" }()
+
+	spec := map[string]interface{}{
+		"route": map[string]interface{}{"enabled": true, "gatewayName": "internal-gateway", "hosts": []interface{}{"b.local"}},
+	}
+	changed, err := applyRouteFlagOverrides(cmd, spec)
+	if err != nil || !changed {
+		t.Fatalf("expected a change, got %t, %v", changed, err)
+	}
+	route := spec["route"].(map[string]interface{})
+	if route["gatewayName"] != "internal-gateway" || route["hosts"] == nil {
+		t.Fatalf("expected existing route fields to be kept, got %#v", route)
+	}
+	rules := route["rules"].([]interface{})
+	path := rules[0].(map[string]interface{})["path"].(map[string]interface{})
+	if path["value"] != "/api" {
+		t.Fatalf("unexpected rules: %#v", rules)
+	}
+
+	setRouteEnabled(spec, false)
+	if route := spec["route"].(map[string]interface{}); route["enabled"] != false || route["rules"] == nil {
+		t.Fatalf("expected disabling the route to keep its rules, got %#v", route)
+	}
+}
+
+func TestBuildRouteSpecRejectsPathsForGRPC(t *testing.T) {
+	appGRPC, appRoutePath = true, "/api"
+	defer func() { appGRPC, appRoutePath = false, "" }()
+	if _, err := buildRouteSpec(); err == nil {
+		t.Fatalf("expected --grpc with --path to fail")
+	}
+}
+
+func TestApplyRouteFlagOverridesMergesIntoFirstRule(t *testing.T) {
+	cmd := &cobra.Command{}
+	registerRouteFlags(cmd)
+	if err := cmd.Flags().Set("rewrite", "/"); err != nil {
+		t.Fatalf("set flag: %v", err)
+	}
+	defer func() { appRouteRewrite = "" }()
+
+	headers := []interface{}{map[string]interface{}{"name": "x-canary", "value": "true"}}
+	second := map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/static"}}
+	spec := map[string]interface{}{
+		"route": map[string]interface{}{"enabled": true, "rules": []interface{}{
+			map[string]interface{}{
+				"path":    map[string]interface{}{"type": "PathPrefix", "value": "/api"},
+				"headers": headers,
+				"rewrite": map[string]interface{}{"hostname": "api.internal", "replaceFullPath": "/v1"},
+			},
+			second,
+		}},
+	}
+	if _, err := applyRouteFlagOverrides(cmd, spec); err != nil {
+		t.Fatalf("expected --rewrite to reuse the stored path, got %v", err)
+	}
+	rules := spec["route"].(map[string]interface{})["rules"].([]interface{})
+	if len(rules) != 2 {
+		t.Fatalf("expected the second rule to be kept, got %#v", rules)
+	}
+	first := rules[0].(map[string]interface{})
+	if first["headers"] == nil || first["path"].(map[string]interface{})["value"] != "/api" {
+		t.Fatalf("expected the header match and path to be kept, got %#v", first)
+	}
+	rewrite := first["rewrite"].(map[string]interface{})
+	if rewrite["replacePrefixMatch"] != "/" || rewrite["hostname"] != "api.internal" || rewrite["replaceFullPath"] != nil {
+		t.Fatalf("unexpected rewrite: %#v", rewrite)
+	}
+
+	cmd = &cobra.Command{}
+	registerRouteFlags(cmd)
+	if err := cmd.Flags().Set("rewrite", "/"); err != nil {
+		t.Fatalf("set flag: %v", err)
+	}
+	if _, err := applyRouteFlagOverrides(cmd, map[string]interface{}{"route": map[string]interface{}{"enabled": true}}); err == nil {
+		t.Fatalf("expected --rewrite without any path to fail")
+	}
+}
+
+func TestValidateGRPCRoute(t *testing.T) {
+	spec := map[string]interface{}{
+		"protocol": "grpc",
+		"route": map[string]interface{}{"rules": []interface{}{
+			map[string]interface{}{"method": map[string]interface{}{"service": "greet.v1.Greeter"}},
+		}},
+	}
+	if err := validateGRPCRoute(spec); err != nil {
+		t.Fatalf("expected method rules to be accepted, got %v", err)
+	}
+
+	route := spec["route"].(map[string]interface{})
+	route["timeouts"] = map[string]interface{}{"request": "30s"}
+	if err := validateGRPCRoute(spec); err == nil {
+		t.Fatalf("expected timeouts to be rejected for grpc")
+	}
+	delete(route, "timeouts")
+	route["rules"] = append(route["rules"].([]interface{}), map[string]interface{}{"redirect": map[string]interface{}{"scheme": "https"}})
+	if err := validateGRPCRoute(spec); err == nil {
+		t.Fatalf("expected a redirect to be rejected for grpc")
+	}
+
+	spec["protocol"] = "http"
+	if err := validateGRPCRoute(spec); err != nil {
+		t.Fatalf("expected http routes to be left alone, got %v", err)
+	}
+}
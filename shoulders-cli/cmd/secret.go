@@ -0,0 +1,464 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/sops"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// sealedSecretsDir is where Flux's user-secrets Kustomization reads sealed
+// Secrets from, relative to the repository root.
+const sealedSecretsDir = "3-user-space/secrets"
+
+var (
+	secretFromFiles []string
+	secretReveal    bool
+	secretSealFile  string
+	secretRecipient string
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage Secrets in a workspace and seal them for GitOps",
+	Long: "Creates and reads Secrets in the active workspace, and seals them into SOPS files encrypted with the " +
+		"cluster's age key so they can be committed to " + sealedSecretsDir + " and applied by Flux.",
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set <name> [KEY=VALUE...]",
+	Short: "Create a Secret or set keys on an existing one",
+	Long:  "Sets the given keys on the Secret, creating it when it does not exist. Keys that are not given are kept.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		data, err := parseSecretData(args[1:], secretFromFiles)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("no keys given: pass KEY=VALUE arguments or --from-file")
+		}
+		namespace, err := currentNamespace()
+		if err != nil {
+			return err
+		}
+		clientset, err := kube.NewClientset(kubeconfig)
+		if err != nil {
+			return err
+		}
+		created, err := setSecretData(cmd.Context(), clientset, namespace, name, data)
+		if err != nil {
+			return err
+		}
+		action := "updated"
+		if created {
+			action = "created"
+		}
+		fmt.Printf("Secret %s %s in namespace %s (%s)\n", name, action, namespace, strings.Join(sortedKeys(data), ", "))
+		return nil
+	},
+}
+
+var secretGetCmd = &cobra.Command{
+	Use:   "get <name> [key]",
+	Short: "Show the keys of a Secret, or print the value of one key",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespace, err := currentNamespace()
+		if err != nil {
+			return err
+		}
+		clientset, err := kube.NewClientset(kubeconfig)
+		if err != nil {
+			return err
+		}
+		secret, err := clientset.CoreV1().Secrets(namespace).Get(cmd.Context(), args[0], metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if len(args) == 2 {
+			value, ok := secret.Data[args[1]]
+			if !ok {
+				return fmt.Errorf("secret %s has no key %s", args[0], args[1])
+			}
+			_, err := os.Stdout.Write(value)
+			return err
+		}
+
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+		keys := sortedKeys(secret.Data)
+		if format == output.Table {
+			headers := []string{"Key", "Bytes"}
+			if secretReveal {
+				headers = append(headers, "Value")
+			}
+			rows := make([][]string, 0, len(keys))
+			for _, key := range keys {
+				row := []string{key, fmt.Sprintf("%d", len(secret.Data[key]))}
+				if secretReveal {
+					row = append(row, string(secret.Data[key]))
+				}
+				rows = append(rows, row)
+			}
+			return output.PrintTable(headers, rows)
+		}
+		values := map[string]string{}
+		for _, key := range keys {
+			values[key] = fmt.Sprintf("(%d bytes)", len(secret.Data[key]))
+			if secretReveal {
+				values[key] = string(secret.Data[key])
+			}
+		}
+		payload, err := output.Render(values, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
+		return nil
+	},
+}
+
+var secretListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the Secrets in a workspace",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespace, err := currentNamespace()
+		if err != nil {
+			return err
+		}
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+		clientset, err := kube.NewClientset(kubeconfig)
+		if err != nil {
+			return err
+		}
+		list, err := clientset.CoreV1().Secrets(namespace).List(cmd.Context(), metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		secrets := listedSecrets(list.Items)
+		if format == output.Table {
+			rows := make([][]string, 0, len(secrets))
+			for _, secret := range secrets {
+				rows = append(rows, []string{secret.Name, string(secret.Type), strings.Join(sortedKeys(secret.Data), ", ")})
+			}
+			return output.PrintTable([]string{"Name", "Type", "Keys"}, rows)
+		}
+		names := make([]map[string]interface{}, 0, len(secrets))
+		for _, secret := range secrets {
+			names = append(names, map[string]interface{}{"name": secret.Name, "type": string(secret.Type), "keys": sortedKeys(secret.Data)})
+		}
+		payload, err := output.Render(names, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
+		return nil
+	},
+}
+
+var secretDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a Secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespace, err := currentNamespace()
+		if err != nil {
+			return err
+		}
+		clientset, err := kube.NewClientset(kubeconfig)
+		if err != nil {
+			return err
+		}
+		if err := clientset.CoreV1().Secrets(namespace).Delete(cmd.Context(), args[0], metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		fmt.Printf("Secret %s deleted in namespace %s\n", args[0], namespace)
+		return nil
+	},
+}
+
+var secretSealCmd = &cobra.Command{
+	Use:   "seal <name> [KEY=VALUE...]",
+	Short: "Write a Secret as a SOPS file that Flux decrypts in the cluster",
+	Long: "Encrypts the Secret's data with the cluster's age key and writes it to " + sealedSecretsDir + "/<namespace>/<name>.yaml " +
+		"under the Flux path prefix of the current git repository, " +
+		"ready to commit. Without KEY=VALUE arguments or --from-file, the Secret is read from the cluster. " +
+		"The age recipient comes from --recipient, the flux-system/sops-age Secret, or ~/.shoulders/age, in that order.",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		namespace, err := currentNamespace()
+		if err != nil {
+			return err
+		}
+		data, err := parseSecretData(args[1:], secretFromFiles)
+		if err != nil {
+			return err
+		}
+		var clientset kubernetes.Interface
+		secretType := corev1.SecretTypeOpaque
+		if len(data) == 0 || secretRecipient == "" {
+			clientset, err = kube.NewClientset(kubeconfig)
+			if err != nil {
+				return err
+			}
+		}
+		if len(data) == 0 {
+			secret, err := clientset.CoreV1().Secrets(namespace).Get(cmd.Context(), name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			data = secret.Data
+			secretType = secret.Type
+		}
+		recipient := secretRecipient
+		if recipient == "" {
+			recipient, err = sealRecipient(cmd.Context(), clientset)
+			if err != nil {
+				return err
+			}
+		}
+
+		content, err := sops.Encrypt(sealedSecretDocument(namespace, name, secretType, data), recipient, time.Now())
+		if err != nil {
+			return fmt.Errorf("seal secret %s: %w", name, err)
+		}
+		path := secretSealFile
+		if path == "" {
+			dir, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			path, err = sealedSecretPath(dir, currentConfig.FluxPathPrefix(), namespace, name)
+			if err != nil {
+				return err
+			}
+		}
+		if path == "-" {
+			fmt.Print(string(content))
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Sealed Secret %s in namespace %s to %s for %s\n", name, namespace, path, recipient)
+		return nil
+	},
+}
+
+// sealedSecretPath is where seal writes a Secret by default: the
+// user-secrets directory under the Flux path prefix, from the root of the git
+// repository dir is in, so the file lands where Flux reads it from any
+// subdirectory.
+func sealedSecretPath(dir, pathPrefix, namespace, name string) (string, error) {
+	root, err := gitRoot(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, pathPrefix, sealedSecretsDir, namespace, name+".yaml"), nil
+}
+
+// gitRoot returns the closest directory from dir upwards with a .git entry,
+// a directory in clones and a file in worktrees.
+func gitRoot(dir string) (string, error) {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current, nil
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", fmt.Errorf("%s is not inside a git repository; pass -f to choose where to write the sealed Secret", dir)
+		}
+		current = parent
+	}
+}
+
+// parseSecretData reads KEY=VALUE arguments and --from-file entries, which
+// are [key=]path with the key defaulting to the file name.
+func parseSecretData(pairs, files []string) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	add := func(key string, value []byte) error {
+		if !configKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid secret key %q: use letters, digits, '-', '_' or '.'", key)
+		}
+		if _, ok := data[key]; ok {
+			return fmt.Errorf("secret key %s is given more than once", key)
+		}
+		data[key] = value
+		return nil
+	}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid secret entry %q, expected KEY=VALUE", pair)
+		}
+		if err := add(strings.TrimSpace(key), []byte(value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range files {
+		key, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			key, path = filepath.Base(entry), entry
+		}
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read secret file: %w", err)
+		}
+		if err := add(strings.TrimSpace(key), value); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// setSecretData merges data into the named Secret, creating an Opaque
+// Secret when it does not exist. The boolean reports whether it was created.
+func setSecretData(ctx context.Context, clientset kubernetes.Interface, namespace, name string, data map[string][]byte) (bool, error) {
+	secrets := clientset.CoreV1().Secrets(namespace)
+	current, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       data,
+		}
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return false, fmt.Errorf("create secret %s: %w", name, err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if current.Data == nil {
+		current.Data = map[string][]byte{}
+	}
+	for key, value := range data {
+		current.Data[key] = value
+	}
+	if _, err := secrets.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+		return false, fmt.Errorf("update secret %s: %w", name, err)
+	}
+	return false, nil
+}
+
+// listedSecrets drops the Secrets the platform manages for itself, such as
+// service account tokens and Helm release state, sorted by name.
+func listedSecrets(items []corev1.Secret) []corev1.Secret {
+	secrets := make([]corev1.Secret, 0, len(items))
+	for _, secret := range items {
+		if secret.Type == corev1.SecretTypeServiceAccountToken || secret.Type == "helm.sh/release.v1" {
+			continue
+		}
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets
+}
+
+// sealedSecretDocument is the manifest sealed for Flux, with the data kept
+// base64-encoded so binary values survive.
+func sealedSecretDocument(namespace, name string, secretType corev1.SecretType, data map[string][]byte) map[string]interface{} {
+	encoded := map[string]interface{}{}
+	for key, value := range data {
+		encoded[key] = base64.StdEncoding.EncodeToString(value)
+	}
+	if secretType == "" {
+		secretType = corev1.SecretTypeOpaque
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"type":       string(secretType),
+		"data":       encoded,
+	}
+}
+
+// sealRecipient returns the age recipient of the cluster's Flux decryption
+// key, falling back to the key in ~/.shoulders/age for users who may not
+// read Secrets in flux-system.
+func sealRecipient(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+	secret, err := clientset.CoreV1().Secrets(sops.SecretNamespace).Get(ctx, sops.SecretName, metav1.GetOptions{})
+	if err == nil {
+		identity, err := sops.ParseIdentity(secret.Data[sops.KeyFile])
+		if err != nil {
+			return "", fmt.Errorf("read %s/%s: %w", sops.SecretNamespace, sops.SecretName, err)
+		}
+		return identity.Recipient().String(), nil
+	}
+	if !apierrors.IsNotFound(err) && !apierrors.IsForbidden(err) {
+		return "", err
+	}
+	dir, err := sops.Dir()
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(filepath.Join(dir, sops.KeyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no age key found in the cluster or %s; run shoulders up or pass --recipient", dir)
+	}
+	if err != nil {
+		return "", err
+	}
+	identity, err := sops.ParseIdentity(content)
+	if err != nil {
+		return "", fmt.Errorf("read age key from %s: %w", dir, err)
+	}
+	return identity.Recipient().String(), nil
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func init() {
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretGetCmd)
+	secretCmd.AddCommand(secretListCmd)
+	secretCmd.AddCommand(secretDeleteCmd)
+	secretCmd.AddCommand(secretSealCmd)
+
+	secretSetCmd.Flags().StringArrayVar(&secretFromFiles, "from-file", nil, "Set a key from a file ([key=]path, key defaults to the file name), repeatable")
+	secretGetCmd.Flags().BoolVar(&secretReveal, "reveal", false, "Show values instead of their sizes")
+	secretSealCmd.Flags().StringArrayVar(&secretFromFiles, "from-file", nil, "Seal a key from a file ([key=]path) instead of reading the Secret from the cluster, repeatable")
+	secretSealCmd.Flags().StringVarP(&secretSealFile, "file", "f", "", "Write the sealed Secret here instead of "+sealedSecretsDir+"/<namespace>/<name>.yaml in the git repository; - for stdout")
+	secretSealCmd.Flags().StringVar(&secretRecipient, "recipient", "", "Seal for this age recipient (age1...) instead of the cluster's key")
+
+	registerNamespaceFlag(secretSetCmd)
+	registerNamespaceFlag(secretGetCmd)
+	registerNamespaceFlag(secretListCmd)
+	registerNamespaceFlag(secretDeleteCmd)
+	registerNamespaceFlag(secretSealCmd)
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/sops"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseSecretData(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(keyPath, []byte("key"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	data, err := parseSecretData([]string{"API_KEY=a=b", "EMPTY="}, []string{keyPath, "ca.crt=" + keyPath})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data["API_KEY"]) != "a=b" || string(data["EMPTY"]) != "" || string(data["tls.key"]) != "key" || string(data["ca.crt"]) != "key" {
+		t.Fatalf("unexpected data: %#v", data)
+	}
+	for _, pairs := range [][]string{{"NOVALUE"}, {"bad key=x"}, {"A=1", "A=2"}} {
+		if _, err := parseSecretData(pairs, nil); err == nil {
+			t.Fatalf("expected %q to be rejected", pairs)
+		}
+	}
+}
+
+func TestSetSecretDataMergesKeys(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	created, err := setSecretData(ctx, clientset, "team-a", "api", map[string][]byte{"A": []byte("1"), "B": []byte("2")})
+	if err != nil || !created {
+		t.Fatalf("expected the secret to be created, got %t, %v", created, err)
+	}
+	created, err = setSecretData(ctx, clientset, "team-a", "api", map[string][]byte{"B": []byte("3")})
+	if err != nil || created {
+		t.Fatalf("expected the secret to be updated, got %t, %v", created, err)
+	}
+	secret, err := clientset.CoreV1().Secrets("team-a").Get(ctx, "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if string(secret.Data["A"]) != "1" || string(secret.Data["B"]) != "3" || secret.Type != corev1.SecretTypeOpaque {
+		t.Fatalf("unexpected secret: %#v", secret)
+	}
+}
+
+func TestListedSecretsSkipsPlatformSecrets(t *testing.T) {
+	secrets := listedSecrets([]corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Name: "orders-db-app-secret"}, Type: corev1.SecretTypeBasicAuth},
+		{ObjectMeta: metav1.ObjectMeta{Name: "sh.helm.release.v1.api.v1"}, Type: "helm.sh/release.v1"},
+		{ObjectMeta: metav1.ObjectMeta{Name: "api"}, Type: corev1.SecretTypeOpaque},
+	})
+	if len(secrets) != 2 || secrets[0].Name != "api" || secrets[1].Name != "orders-db-app-secret" {
+		t.Fatalf("unexpected secrets: %#v", secrets)
+	}
+}
+
+func TestSealRecipientReadsClusterKey(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: sops.SecretName, Namespace: sops.SecretNamespace},
+		Data:       map[string][]byte{sops.KeyFile: sops.KeyFileContent(identity, time.Now())},
+	})
+	recipient, err := sealRecipient(context.Background(), clientset)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recipient != identity.Recipient().String() {
+		t.Fatalf("expected %s, got %s", identity.Recipient(), recipient)
+	}
+}
+
+func TestSealedSecretDocument(t *testing.T) {
+	document := sealedSecretDocument("team-a", "api", "", map[string][]byte{"A": {0xff}})
+	data := document["data"].(map[string]interface{})
+	if document["type"] != "Opaque" || data["A"] != "/w==" {
+		t.Fatalf("unexpected document: %#v", document)
+	}
+	metadata := document["metadata"].(map[string]interface{})
+	if metadata["namespace"] != "team-a" || metadata["name"] != "api" {
+		t.Fatalf("unexpected metadata: %#v", metadata)
+	}
+}
+
+func TestSealedSecretPathResolvesFromGitRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	dir := filepath.Join(root, "apps", "api")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	path, err := sealedSecretPath(dir, "platform", "team-a", "api-keys")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := filepath.Join(root, "platform", sealedSecretsDir, "team-a", "api-keys.yaml"); path != want {
+		t.Fatalf("expected %s, got %s", want, path)
+	}
+
+	if _, err := sealedSecretPath(t.TempDir(), ".", "team-a", "api-keys"); err == nil {
+		t.Fatalf("expected a directory outside git to require -f")
+	}
+}
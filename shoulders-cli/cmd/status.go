@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jherreros/shoulders/shoulders-cli/internal/bootstrap"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/crossplane"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/flux"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
@@ -32,6 +33,14 @@ type statusSummary struct {
 	XPlaneBroken []string `json:"crossplaneBroken" yaml:"crossplaneBroken"`
 	GatewayReady bool     `json:"gatewayReady" yaml:"gatewayReady"`
 	GatewayAddr  string   `json:"gatewayAddress" yaml:"gatewayAddress"`
+	AddonsReady  bool     `json:"addonsReady" yaml:"addonsReady"`
+	AddonsBroken []string `json:"addonsBroken,omitempty" yaml:"addonsBroken,omitempty"`
+	AddonCount   int      `json:"addonCount" yaml:"addonCount"`
+}
+
+func (s statusSummary) healthy() bool {
+	podsHealthy := s.TotalPods > 0 && s.HealthyPods == s.TotalPods
+	return s.NodesReady && podsHealthy && s.FluxReady && s.XPlaneReady && s.GatewayReady && s.AddonsReady
 }
 
 var statusWait bool
@@ -100,7 +109,22 @@ func gatherStatus(ctx context.Context) (statusSummary, error) {
 		xpUnhealthy = []string{err.Error()}
 	}
 
-	// 5. Pods
+	// 5. Third-party addons
+	addonsReady := true
+	addonsBroken := []string{}
+	addonStatuses, err := bootstrap.AddonStatuses(ctx, kubeconfig, currentConfig.Addons())
+	if err != nil {
+		addonsReady = false
+		addonsBroken = []string{err.Error()}
+	}
+	for _, addon := range addonStatuses {
+		if !addon.Ready {
+			addonsReady = false
+			addonsBroken = append(addonsBroken, addon.Name)
+		}
+	}
+
+	// 6. Pods
 	podList, err := clientset.CoreV1().Pods("").List(ctx, v1.ListOptions{})
 	if err != nil {
 		return statusSummary{}, err
@@ -117,7 +141,7 @@ func gatherStatus(ctx context.Context) (statusSummary, error) {
 		}
 	}
 
-	// 6. Gateway
+	// 7. Gateway
 	gwReady := true
 	gwAddr := "Externally managed"
 	if gatewayChecksRequired() {
@@ -170,6 +194,9 @@ func gatherStatus(ctx context.Context) (statusSummary, error) {
 		XPlaneBroken: xpUnhealthy,
 		GatewayReady: gwReady,
 		GatewayAddr:  gwAddr,
+		AddonsReady:  addonsReady,
+		AddonsBroken: addonsBroken,
+		AddonCount:   len(currentConfig.Addons()),
 	}, nil
 }
 
@@ -198,11 +225,9 @@ func statusWaitLoop(ctx context.Context, format output.Format) error {
 		if err != nil {
 			return err
 		}
-		podsHealthy := summary.TotalPods > 0 && summary.HealthyPods == summary.TotalPods
-
 		area.Update(renderStatusTUI(summary))
 
-		if summary.NodesReady && podsHealthy && summary.FluxReady && summary.XPlaneReady && summary.GatewayReady {
+		if summary.healthy() {
 			return nil
 		}
 
@@ -256,8 +281,15 @@ func renderStatusTUI(s statusSummary) string {
 	b.WriteString(tui.StatusLine("Flux CD", s.FluxReady, formatDetail(s.FluxBroken)) + "\n")
 	b.WriteString(tui.StatusLine("Crossplane", s.XPlaneReady, formatDetail(s.XPlaneBroken)) + "\n")
 	b.WriteString(tui.StatusLine("Gateway", s.GatewayReady, s.GatewayAddr) + "\n")
+	if s.AddonCount > 0 {
+		detail := fmt.Sprintf("%d/%d ready", s.AddonCount-len(s.AddonsBroken), s.AddonCount)
+		if len(s.AddonsBroken) > 0 {
+			detail += " • " + formatDetail(s.AddonsBroken)
+		}
+		b.WriteString(tui.StatusLine("Addons", s.AddonsReady, detail) + "\n")
+	}
 
-	if s.NodesReady && podsHealthy && s.FluxReady && s.XPlaneReady && s.GatewayReady {
+	if s.healthy() {
 		b.WriteString("\n  " + pterm.NewStyle(pterm.FgGreen, pterm.Bold).Sprint("All systems healthy") + "\n")
 	} else {
 		b.WriteString("\n  " + pterm.NewStyle(pterm.FgYellow).Sprint("Waiting for components to become healthy...") + "\n")
@@ -61,7 +61,7 @@ var upCmd = &cobra.Command{
 			}
 		} else {
 			tracker.Start(verboseDetail("creating vind cluster %q using %s profile", clusterName, profileSpec.Name))
-			if err := bootstrap.EnsureVindCluster(cmd.Context(), clusterName, manifests.VindConfigForProfile(profileSpec.Name), authConfig, publicConfig.DexHost); err != nil {
+			if err := bootstrap.EnsureVindCluster(cmd.Context(), clusterName, manifests.VindConfigForProfile(profileSpec.Base), authConfig, publicConfig.DexHost); err != nil {
 				tracker.Fail(err.Error())
 				return fmt.Errorf("failed to create vind cluster: %w", err)
 			}
@@ -81,7 +81,7 @@ var upCmd = &cobra.Command{
 			return fmt.Errorf("failed to install gateway api crds: %w", err)
 		}
 		if currentConfig.CiliumEnabled() {
-			if err := bootstrap.EnsureCilium(kubeconfig, currentConfig.CiliumVersion(), bootstrap.CiliumOptionsForProfile(profileSpec.Name)); err != nil {
+			if err := bootstrap.EnsureCilium(kubeconfig, currentConfig.CiliumVersion(), bootstrap.CiliumOptionsForProfile(profileSpec)); err != nil {
 				tracker.Fail(err.Error())
 				return fmt.Errorf("failed to install cilium: %w", err)
 			}
@@ -95,11 +95,13 @@ var upCmd = &cobra.Command{
 		// Phase 3: Flux install
 		tracker.Start(verboseDetail("downloading Flux install manifest and applying GitRepository + Kustomizations"))
 		if err := bootstrap.EnsureFlux(context.Background(), kubeconfig,
+			currentConfig.FluxVersion(),
 			currentConfig.FluxRepositoryURL(),
 			currentConfig.FluxRepositoryBranch(),
 			currentConfig.FluxPathPrefix(),
-			profileSpec.Name,
+			profileSpec,
 			publicConfig,
+			currentConfig.Addons(),
 		); err != nil {
 			tracker.Fail(err.Error())
 			return fmt.Errorf("failed to install flux: %w", err)
@@ -317,8 +319,7 @@ func waitForHealthyStatus(ctx context.Context, timeout time.Duration) error {
 		if err != nil {
 			lastErr = err
 		} else {
-			podsHealthy := summary.TotalPods > 0 && summary.HealthyPods == summary.TotalPods
-			if summary.NodesReady && podsHealthy && summary.FluxReady && summary.XPlaneReady && summary.GatewayReady {
+			if summary.healthy() {
 				return nil
 			}
 		}
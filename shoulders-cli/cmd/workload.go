@@ -138,7 +138,11 @@ var workloadDescribeCmd = &cobra.Command{
 			return err
 		}
 		fmt.Println(string(payload))
-		return nil
+		selector := "shoulders.io/workload=" + name
+		if err := printContainerStatuses(cmd.Context(), namespace, selector); err != nil {
+			return err
+		}
+		return printPersistentVolumes(cmd.Context(), namespace, selector)
 	},
 }
 
@@ -209,6 +213,18 @@ func buildWorkload(name, namespace, workloadType string) (v1alpha1.Workload, err
 	if err != nil {
 		return v1alpha1.Workload{}, err
 	}
+	initContainers, sidecars, err := buildExtraContainers()
+	if err != nil {
+		return v1alpha1.Workload{}, err
+	}
+	configFiles, err := buildConfigFiles(appConfigFiles, appConfigDirs)
+	if err != nil {
+		return v1alpha1.Workload{}, err
+	}
+	persistence, err := buildPersistence(appPVCMounts)
+	if err != nil {
+		return v1alpha1.Workload{}, err
+	}
 
 	spec := v1alpha1.WorkloadSpec{
 		Type:              workloadType,
@@ -225,6 +241,10 @@ func buildWorkload(name, namespace, workloadType string) (v1alpha1.Workload, err
 		EnvFrom:           buildEnvFrom(appEnvFromConfigMaps, appEnvFromSecrets),
 		Resources:         resources,
 		SecurityContext:   securityContext,
+		InitContainers:    initContainers,
+		Sidecars:          sidecars,
+		ConfigFiles:       configFiles,
+		Persistence:       persistence,
 	}
 
 	return v1alpha1.Workload{
@@ -267,6 +287,8 @@ func registerWorkloadCreateFlags(cmd *cobra.Command) {
 	cmd.Flags().StringArrayVar(&appEnv, "env", nil, "Environment variable (KEY=VALUE), repeatable")
 	cmd.Flags().StringArrayVar(&appEnvFromConfigMaps, "env-from-configmap", nil, "ConfigMap to expose through envFrom, repeatable")
 	cmd.Flags().StringArrayVar(&appEnvFromSecrets, "env-from-secret", nil, "Secret to expose through envFrom, repeatable")
+	registerConfigFileFlags(cmd)
+	registerPersistenceFlags(cmd)
 	cmd.Flags().StringVar(&appCPURequest, "cpu-request", "", "CPU request, for example 100m")
 	cmd.Flags().StringVar(&appMemoryRequest, "memory-request", "", "Memory request, for example 128Mi")
 	cmd.Flags().StringVar(&appCPULimit, "cpu-limit", "", "CPU limit, for example 500m")
@@ -274,6 +296,7 @@ func registerWorkloadCreateFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&appReadOnlyRootFS, "read-only-root-filesystem", false, "Set container securityContext.readOnlyRootFilesystem")
 	cmd.Flags().BoolVar(&appRunAsNonRoot, "run-as-non-root", false, "Set container securityContext.runAsNonRoot")
 	cmd.Flags().Int64Var(&appRunAsUser, "run-as-user", -1, "Set container securityContext.runAsUser")
+	registerContainerFlags(cmd)
 	cmd.Flags().BoolVar(&workloadDryRun, "dry-run", false, "Print YAML instead of applying")
 	if err := cmd.MarkFlagRequired("image"); err != nil {
 		panic(err)
@@ -3,18 +3,68 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
 	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/yaml"
 )
 
+// Names of the objects the workspace composition renders from spec.quota and
+// spec.defaults.
+const (
+	workspaceQuotaName      = "workspace-quota"
+	workspaceLimitRangeName = "workspace-defaults"
+)
+
+var (
+	workspaceCPU                  string
+	workspaceMemory               string
+	workspaceStorage              string
+	workspacePods                 int32
+	workspaceDefaultCPURequest    string
+	workspaceDefaultMemoryRequest string
+	workspaceDefaultCPULimit      string
+	workspaceDefaultMemoryLimit   string
+	workspaceMemberRole           string
+	workspaceMemberGroup          bool
+	workspaceGrantTo              string
+	workspaceGrantApp             string
+	workspaceGrantPorts           []int32
+)
+
+type workspaceQuotaUsage struct {
+	Resource string `json:"resource" yaml:"resource"`
+	Used     string `json:"used" yaml:"used"`
+	Hard     string `json:"hard" yaml:"hard"`
+}
+
+type workspaceGrantRow struct {
+	From  string  `json:"from" yaml:"from"`
+	To    string  `json:"to" yaml:"to"`
+	App   string  `json:"app,omitempty" yaml:"app,omitempty"`
+	Ports []int32 `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+type workspaceDescription struct {
+	Name            string                `json:"name" yaml:"name"`
+	Quota           []workspaceQuotaUsage `json:"quota,omitempty" yaml:"quota,omitempty"`
+	DefaultRequests map[string]string     `json:"defaultRequests,omitempty" yaml:"defaultRequests,omitempty"`
+	DefaultLimits   map[string]string     `json:"defaultLimits,omitempty" yaml:"defaultLimits,omitempty"`
+}
+
 var workspaceCmd = &cobra.Command{
 	Use:   "workspace",
 	Short: "Manage workspace contexts",
@@ -23,12 +73,24 @@ var workspaceCmd = &cobra.Command{
 var workspaceCreateCmd = &cobra.Command{
 	Use:   "create <name>",
 	Short: "Create a Workspace",
-	Args:  cobra.ExactArgs(1),
+	Long: "Creates a Workspace and, with --template, applies the rendered manifests of a workspace template to its namespace. " +
+		"See 'shoulders workspace template list' for the available templates.",
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
+		spec, err := buildWorkspaceSpec(cmd)
+		if err != nil {
+			return err
+		}
+		// Render before creating anything so a bad parameter fails early.
+		rendered, err := renderWorkspaceTemplate(name)
+		if err != nil {
+			return err
+		}
 		workspace := v1alpha1.Workspace{
 			TypeMeta:   v1alpha1.TypeMeta("Workspace"),
 			ObjectMeta: v1alpha1.ObjectMeta(name, ""),
+			Spec:       spec,
 		}
 
 		content, err := yaml.Marshal(workspace)
@@ -51,6 +113,16 @@ var workspaceCreateCmd = &cobra.Command{
 		}
 
 		fmt.Printf("Workspace %s created\n", name)
+		if rendered == nil {
+			return nil
+		}
+		if err := waitForWorkspaceNamespace(cmd.Context(), name, workspaceNamespaceTimeout); err != nil {
+			return err
+		}
+		if err := kube.ApplyManifest(cmd.Context(), kubeconfig, rendered, name); err != nil {
+			return fmt.Errorf("apply template %s: %w", workspaceTemplateName, err)
+		}
+		fmt.Printf("Template %s applied to workspace %s\n", workspaceTemplateName, name)
 		return nil
 	},
 }
@@ -70,8 +142,7 @@ var workspaceUseCmd = &cobra.Command{
 			return err
 		}
 
-		currentConfig.CurrentWorkspace = name
-		if err := config.Save(currentConfig, loadedConfigPath); err != nil {
+		if err := saveConfigChange(func(cfg *config.Config) { cfg.CurrentWorkspace = name }); err != nil {
 			return err
 		}
 		fmt.Printf("Active workspace set to %s\n", name)
@@ -113,21 +184,266 @@ var workspaceListCmd = &cobra.Command{
 	},
 }
 
-var workspaceDeleteCmd = &cobra.Command{
-	Use:   "delete <name>",
-	Short: "Delete a Workspace",
+var workspaceDescribeCmd = &cobra.Command{
+	Use:   "describe <name>",
+	Short: "Show a Workspace's quota usage and container defaults",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+		dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+		if err != nil {
+			return err
+		}
+		gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "workspaces"}
+		if _, err := dynamicClient.Resource(gvr).Get(cmd.Context(), name, metav1.GetOptions{}); err != nil {
+			return err
+		}
+
+		clientset, err := kube.NewClientset(kubeconfig)
+		if err != nil {
+			return err
+		}
+		description := workspaceDescription{Name: name}
+		quota, err := clientset.CoreV1().ResourceQuotas(name).Get(cmd.Context(), workspaceQuotaName, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return fmt.Errorf("get quota for workspace %s: %w", name, err)
+		default:
+			description.Quota = workspaceQuotaUsages(quota)
+		}
+		limitRange, err := clientset.CoreV1().LimitRanges(name).Get(cmd.Context(), workspaceLimitRangeName, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return fmt.Errorf("get defaults for workspace %s: %w", name, err)
+		default:
+			description.DefaultRequests, description.DefaultLimits = workspaceContainerDefaults(limitRange)
+		}
+
+		if format != output.Table {
+			payload, err := output.Render(description, format)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(payload))
+			return nil
+		}
+
+		fmt.Printf("Workspace: %s\n", name)
+		if len(description.Quota) == 0 {
+			fmt.Println("Quota: none")
+		} else {
+			rows := make([][]string, 0, len(description.Quota))
+			for _, usage := range description.Quota {
+				rows = append(rows, []string{usage.Resource, usage.Used, usage.Hard})
+			}
+			if err := output.PrintTable([]string{"Resource", "Used", "Hard"}, rows); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Default requests: %s\n", formatResourceMap(description.DefaultRequests))
+		fmt.Printf("Default limits: %s\n", formatResourceMap(description.DefaultLimits))
+		return nil
+	},
+}
+
+var workspaceAddMemberCmd = &cobra.Command{
+	Use:   "add-member <workspace> <user-or-group>",
+	Short: "Grant a Dex user or group a role in a Workspace",
+	Long:  "Users are matched by the email Dex puts in their token. Roles map to the built-in admin, edit and view ClusterRoles in the workspace namespace.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		member := v1alpha1.WorkspaceMember{Kind: workspaceMemberKind(workspaceMemberGroup), Name: args[1], Role: workspaceMemberRole}
+		if err := validateWorkspaceRole(member.Role); err != nil {
+			return err
+		}
+		changed, err := updateWorkspaceSpec(cmd.Context(), args[0], func(spec *v1alpha1.WorkspaceSpec) (string, bool) {
+			var changed bool
+			spec.Members, changed = upsertWorkspaceMember(spec.Members, member)
+			return "members", changed
+		})
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Printf("%s %s is already a %s of workspace %s\n", member.Kind, member.Name, member.Role, args[0])
+			return nil
+		}
+		fmt.Printf("%s %s added to workspace %s as %s\n", member.Kind, member.Name, args[0], member.Role)
+		return nil
+	},
+}
+
+var workspaceRemoveMemberCmd = &cobra.Command{
+	Use:   "remove-member <workspace> <user-or-group>",
+	Short: "Revoke a Dex user's or group's access to a Workspace",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kind := workspaceMemberKind(workspaceMemberGroup)
+		changed, err := updateWorkspaceSpec(cmd.Context(), args[0], func(spec *v1alpha1.WorkspaceSpec) (string, bool) {
+			var changed bool
+			spec.Members, changed = removeWorkspaceMember(spec.Members, kind, args[1])
+			return "members", changed
+		})
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return fmt.Errorf("%s %s is not a member of workspace %s", kind, args[1], args[0])
+		}
+		fmt.Printf("%s %s removed from workspace %s\n", kind, args[1], args[0])
+		return nil
+	},
+}
+
+var workspaceMembersCmd = &cobra.Command{
+	Use:   "members <workspace>",
+	Short: "List the members of a Workspace",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
 		dynamicClient, err := kube.NewDynamicClient(kubeconfig)
 		if err != nil {
 			return err
 		}
 		gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "workspaces"}
-		if err := dynamicClient.Resource(gvr).Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+		obj, err := dynamicClient.Resource(gvr).Get(cmd.Context(), args[0], metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		workspace, err := decodeWorkspace(obj)
+		if err != nil {
+			return err
+		}
+		members := workspace.Spec.Members
+
+		if format == output.Table {
+			rows := make([][]string, 0, len(members))
+			for _, member := range members {
+				rows = append(rows, []string{workspaceMemberKind(member.Kind == v1alpha1.WorkspaceMemberGroup), member.Name, member.Role})
+			}
+			return output.PrintTable([]string{"Kind", "Name", "Role"}, rows)
+		}
+		payload, err := output.Render(members, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
+		return nil
+	},
+}
+
+var workspaceAllowCmd = &cobra.Command{
+	Use:   "allow <from-workspace> --to <workspace>",
+	Short: "Let pods of one Workspace reach another",
+	Long: "Adds a spec.allowFrom grant to the target Workspace. Its default-deny policy then admits traffic from the other workspace, " +
+		"optionally only to the pods of one application (--app) and its container ports (--port).",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		grant := v1alpha1.WorkspaceGrant{Workspace: args[0], App: workspaceGrantApp, Ports: workspaceGrantPorts}
+		if err := validateWorkspaceGrant(workspaceGrantTo, grant); err != nil {
+			return err
+		}
+		changed, err := updateWorkspaceSpec(cmd.Context(), workspaceGrantTo, func(spec *v1alpha1.WorkspaceSpec) (string, bool) {
+			var changed bool
+			spec.AllowFrom, changed = upsertWorkspaceGrant(spec.AllowFrom, grant)
+			return "allowFrom", changed
+		})
+		if err != nil {
 			return err
 		}
-		fmt.Printf("Workspace %s deleted\n", name)
+		target := describeWorkspaceGrantTarget(workspaceGrantTo, grant)
+		if !changed {
+			fmt.Printf("Workspace %s can already reach %s\n", grant.Workspace, target)
+			return nil
+		}
+		fmt.Printf("Workspace %s can now reach %s\n", grant.Workspace, target)
+		return nil
+	},
+}
+
+var workspaceRevokeCmd = &cobra.Command{
+	Use:   "revoke <from-workspace> --to <workspace>",
+	Short: "Remove a grant added with workspace allow",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		grant := v1alpha1.WorkspaceGrant{Workspace: args[0], App: workspaceGrantApp}
+		changed, err := updateWorkspaceSpec(cmd.Context(), workspaceGrantTo, func(spec *v1alpha1.WorkspaceSpec) (string, bool) {
+			var changed bool
+			spec.AllowFrom, changed = removeWorkspaceGrant(spec.AllowFrom, grant.Workspace, grant.App)
+			return "allowFrom", changed
+		})
+		if err != nil {
+			return err
+		}
+		target := describeWorkspaceGrantTarget(workspaceGrantTo, grant)
+		if !changed {
+			return fmt.Errorf("workspace %s has no grant to %s", grant.Workspace, target)
+		}
+		fmt.Printf("Workspace %s can no longer reach %s\n", grant.Workspace, target)
+		return nil
+	},
+}
+
+var workspaceGrantsCmd = &cobra.Command{
+	Use:   "grants [workspace]",
+	Short: "List the network grants between Workspaces",
+	Long: "Lists the allowFrom grants of Workspaces and the exposeTo entries of WebApplications. " +
+		"Without an argument every grant is listed. With a workspace, only the grants it gives or receives.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+		dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+		if err != nil {
+			return err
+		}
+		gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "workspaces"}
+		list, err := dynamicClient.Resource(gvr).List(cmd.Context(), metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		workspaces := make([]v1alpha1.Workspace, 0, len(list.Items))
+		for index := range list.Items {
+			workspace, err := decodeWorkspace(&list.Items[index])
+			if err != nil {
+				return err
+			}
+			workspaces = append(workspaces, workspace)
+		}
+		appGVR := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "webapplications"}
+		apps, err := dynamicClient.Resource(appGVR).List(cmd.Context(), metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("list webapplications: %w", err)
+		}
+		filter := ""
+		if len(args) == 1 {
+			filter = args[0]
+		}
+		grants := workspaceGrantRows(workspaces, apps.Items, filter)
+
+		if format == output.Table {
+			rows := make([][]string, 0, len(grants))
+			for _, grant := range grants {
+				rows = append(rows, []string{grant.From, grant.To, grant.App, formatWorkspaceGrantPorts(grant.Ports)})
+			}
+			return output.PrintTable([]string{"From", "To", "App", "Ports"}, rows)
+		}
+		payload, err := output.Render(grants, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
 		return nil
 	},
 }
@@ -145,10 +461,352 @@ var workspaceCurrentCmd = &cobra.Command{
 	},
 }
 
+// buildWorkspaceSpec turns the quota and default flags of workspace create
+// into spec.quota and spec.defaults.
+func buildWorkspaceSpec(cmd *cobra.Command) (v1alpha1.WorkspaceSpec, error) {
+	quantities := map[string]string{
+		"cpu":                    workspaceCPU,
+		"memory":                 workspaceMemory,
+		"storage":                workspaceStorage,
+		"default-cpu-request":    workspaceDefaultCPURequest,
+		"default-memory-request": workspaceDefaultMemoryRequest,
+		"default-cpu-limit":      workspaceDefaultCPULimit,
+		"default-memory-limit":   workspaceDefaultMemoryLimit,
+	}
+	for flag, value := range quantities {
+		if value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return v1alpha1.WorkspaceSpec{}, fmt.Errorf("invalid --%s %q: %w", flag, value, err)
+		}
+	}
+
+	spec := v1alpha1.WorkspaceSpec{}
+	quota := v1alpha1.WorkspaceQuota{CPU: workspaceCPU, Memory: workspaceMemory, Storage: workspaceStorage}
+	if cmd.Flags().Changed("pods") {
+		if workspacePods < 0 {
+			return v1alpha1.WorkspaceSpec{}, fmt.Errorf("--pods must not be negative")
+		}
+		pods := workspacePods
+		quota.Pods = &pods
+	}
+	if quota != (v1alpha1.WorkspaceQuota{}) {
+		spec.Quota = &quota
+	}
+
+	requests := v1alpha1.WorkspaceResources{CPU: workspaceDefaultCPURequest, Memory: workspaceDefaultMemoryRequest}
+	limits := v1alpha1.WorkspaceResources{CPU: workspaceDefaultCPULimit, Memory: workspaceDefaultMemoryLimit}
+	if requests != (v1alpha1.WorkspaceResources{}) || limits != (v1alpha1.WorkspaceResources{}) {
+		spec.Defaults = &v1alpha1.WorkspaceDefaults{}
+		if requests != (v1alpha1.WorkspaceResources{}) {
+			spec.Defaults.Requests = &requests
+		}
+		if limits != (v1alpha1.WorkspaceResources{}) {
+			spec.Defaults.Limits = &limits
+		}
+	}
+	return spec, nil
+}
+
+// workspaceQuotaUsages lists the used and hard amounts of every resource in
+// a ResourceQuota, sorted by resource name.
+func workspaceQuotaUsages(quota *corev1.ResourceQuota) []workspaceQuotaUsage {
+	names := make([]string, 0, len(quota.Spec.Hard))
+	for name := range quota.Spec.Hard {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	usages := make([]workspaceQuotaUsage, 0, len(names))
+	for _, name := range names {
+		hard := quota.Spec.Hard[corev1.ResourceName(name)]
+		used := "0"
+		if quantity, ok := quota.Status.Used[corev1.ResourceName(name)]; ok {
+			used = quantity.String()
+		}
+		usages = append(usages, workspaceQuotaUsage{Resource: name, Used: used, Hard: hard.String()})
+	}
+	return usages
+}
+
+// workspaceContainerDefaults returns the default container requests and
+// limits of a LimitRange.
+func workspaceContainerDefaults(limitRange *corev1.LimitRange) (map[string]string, map[string]string) {
+	requests := map[string]string{}
+	limits := map[string]string{}
+	for _, item := range limitRange.Spec.Limits {
+		if item.Type != corev1.LimitTypeContainer {
+			continue
+		}
+		for name, quantity := range item.DefaultRequest {
+			requests[string(name)] = quantity.String()
+		}
+		for name, quantity := range item.Default {
+			limits[string(name)] = quantity.String()
+		}
+	}
+	return requests, limits
+}
+
+func workspaceMemberKind(group bool) string {
+	if group {
+		return v1alpha1.WorkspaceMemberGroup
+	}
+	return v1alpha1.WorkspaceMemberUser
+}
+
+func validateWorkspaceRole(role string) error {
+	switch role {
+	case v1alpha1.WorkspaceRoleAdmin, v1alpha1.WorkspaceRoleDeveloper, v1alpha1.WorkspaceRoleViewer:
+		return nil
+	default:
+		return fmt.Errorf("unsupported workspace role %q (supported: admin, developer, viewer)", role)
+	}
+}
+
+func sameWorkspaceMember(member v1alpha1.WorkspaceMember, kind, name string) bool {
+	return workspaceMemberKind(member.Kind == v1alpha1.WorkspaceMemberGroup) == kind && member.Name == name
+}
+
+// upsertWorkspaceMember adds member or updates the role of an existing entry
+// for the same user or group.
+func upsertWorkspaceMember(members []v1alpha1.WorkspaceMember, member v1alpha1.WorkspaceMember) ([]v1alpha1.WorkspaceMember, bool) {
+	for index, existing := range members {
+		if !sameWorkspaceMember(existing, member.Kind, member.Name) {
+			continue
+		}
+		if existing.Role == member.Role {
+			return members, false
+		}
+		members[index].Role = member.Role
+		return members, true
+	}
+	return append(members, member), true
+}
+
+func removeWorkspaceMember(members []v1alpha1.WorkspaceMember, kind, name string) ([]v1alpha1.WorkspaceMember, bool) {
+	kept := make([]v1alpha1.WorkspaceMember, 0, len(members))
+	for _, member := range members {
+		if !sameWorkspaceMember(member, kind, name) {
+			kept = append(kept, member)
+		}
+	}
+	return kept, len(kept) != len(members)
+}
+
+func validateWorkspaceGrant(to string, grant v1alpha1.WorkspaceGrant) error {
+	if grant.Workspace == to {
+		return fmt.Errorf("workspace %s can already reach itself", to)
+	}
+	for _, port := range grant.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+	return nil
+}
+
+// upsertWorkspaceGrant adds grant or replaces the ports of an existing grant
+// for the same workspace and app.
+func upsertWorkspaceGrant(grants []v1alpha1.WorkspaceGrant, grant v1alpha1.WorkspaceGrant) ([]v1alpha1.WorkspaceGrant, bool) {
+	for index, existing := range grants {
+		if existing.Workspace != grant.Workspace || existing.App != grant.App {
+			continue
+		}
+		if equalPorts(existing.Ports, grant.Ports) {
+			return grants, false
+		}
+		grants[index].Ports = grant.Ports
+		return grants, true
+	}
+	return append(grants, grant), true
+}
+
+func removeWorkspaceGrant(grants []v1alpha1.WorkspaceGrant, workspace, app string) ([]v1alpha1.WorkspaceGrant, bool) {
+	kept := make([]v1alpha1.WorkspaceGrant, 0, len(grants))
+	for _, grant := range grants {
+		if grant.Workspace != workspace || grant.App != app {
+			kept = append(kept, grant)
+		}
+	}
+	return kept, len(kept) != len(grants)
+}
+
+func equalPorts(left, right []int32) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for index := range left {
+		if left[index] != right[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// workspaceGrantRows flattens the allowFrom grants of workspaces and the
+// exposeTo entries of apps, keeping only the ones given or received by filter
+// when it is set.
+func workspaceGrantRows(workspaces []v1alpha1.Workspace, apps []unstructured.Unstructured, filter string) []workspaceGrantRow {
+	rows := []workspaceGrantRow{}
+	for _, workspace := range workspaces {
+		for _, grant := range workspace.Spec.AllowFrom {
+			if filter != "" && filter != workspace.Name && filter != grant.Workspace {
+				continue
+			}
+			rows = append(rows, workspaceGrantRow{From: grant.Workspace, To: workspace.Name, App: grant.App, Ports: grant.Ports})
+		}
+	}
+	for _, app := range apps {
+		exposeTo, _, _ := unstructured.NestedStringSlice(app.Object, "spec", "exposeTo")
+		port, ok, _ := unstructured.NestedInt64(app.Object, "spec", "port")
+		if !ok {
+			port = 80
+		}
+		for _, workspace := range exposeTo {
+			if filter != "" && filter != app.GetNamespace() && filter != workspace {
+				continue
+			}
+			rows = append(rows, workspaceGrantRow{From: workspace, To: app.GetNamespace(), App: app.GetName(), Ports: []int32{int32(port)}})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].To != rows[j].To {
+			return rows[i].To < rows[j].To
+		}
+		return rows[i].From < rows[j].From
+	})
+	return rows
+}
+
+func describeWorkspaceGrantTarget(to string, grant v1alpha1.WorkspaceGrant) string {
+	target := "workspace " + to
+	if grant.App != "" {
+		target = fmt.Sprintf("app %s in workspace %s", grant.App, to)
+	}
+	if len(grant.Ports) > 0 {
+		target += " on port " + formatWorkspaceGrantPorts(grant.Ports)
+	}
+	return target
+}
+
+func formatWorkspaceGrantPorts(ports []int32) string {
+	if len(ports) == 0 {
+		return "all"
+	}
+	parts := make([]string, 0, len(ports))
+	for _, port := range ports {
+		parts = append(parts, fmt.Sprint(port))
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeWorkspace(obj *unstructured.Unstructured) (v1alpha1.Workspace, error) {
+	var workspace v1alpha1.Workspace
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &workspace); err != nil {
+		return v1alpha1.Workspace{}, fmt.Errorf("decode workspace %s: %w", obj.GetName(), err)
+	}
+	return workspace, nil
+}
+
+// updateWorkspaceSpec decodes the spec of the named Workspace, applies edit
+// and, when edit reports a change, writes back the spec field it names.
+// Other spec fields, including the ones Crossplane manages, are untouched.
+func updateWorkspaceSpec(ctx context.Context, name string, edit func(*v1alpha1.WorkspaceSpec) (string, bool)) (bool, error) {
+	dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+	if err != nil {
+		return false, err
+	}
+	gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "workspaces"}
+	obj, err := dynamicClient.Resource(gvr).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	workspace, err := decodeWorkspace(obj)
+	if err != nil {
+		return false, err
+	}
+	field, changed := edit(&workspace.Spec)
+	if !changed {
+		return false, nil
+	}
+
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&workspace.Spec)
+	if err != nil {
+		return false, err
+	}
+	if value, ok := spec[field]; ok {
+		if err := unstructured.SetNestedField(obj.Object, value, "spec", field); err != nil {
+			return false, err
+		}
+	} else {
+		unstructured.RemoveNestedField(obj.Object, "spec", field)
+	}
+	if _, err := dynamicClient.Resource(gvr).Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		return false, fmt.Errorf("update workspace %s: %w", name, err)
+	}
+	return true, nil
+}
+
+func formatResourceMap(values map[string]string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+"="+values[key])
+	}
+	return strings.Join(parts, ", ")
+}
+
+func registerWorkspaceQuotaFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&workspaceCPU, "cpu", "", "Total CPU requests allowed in the workspace, for example 4")
+	cmd.Flags().StringVar(&workspaceMemory, "memory", "", "Total memory requests allowed in the workspace, for example 8Gi")
+	cmd.Flags().StringVar(&workspaceStorage, "storage", "", "Total storage requests allowed in the workspace, for example 50Gi")
+	cmd.Flags().Int32Var(&workspacePods, "pods", 0, "Maximum number of pods in the workspace")
+	cmd.Flags().StringVar(&workspaceDefaultCPURequest, "default-cpu-request", "", "CPU request for containers that set none, for example 100m")
+	cmd.Flags().StringVar(&workspaceDefaultMemoryRequest, "default-memory-request", "", "Memory request for containers that set none, for example 128Mi")
+	cmd.Flags().StringVar(&workspaceDefaultCPULimit, "default-cpu-limit", "", "CPU limit for containers that set none, for example 500m")
+	cmd.Flags().StringVar(&workspaceDefaultMemoryLimit, "default-memory-limit", "", "Memory limit for containers that set none, for example 512Mi")
+}
+
 func init() {
+	registerWorkspaceQuotaFlags(workspaceCreateCmd)
+	workspaceCreateCmd.Flags().StringVar(&workspaceTemplateName, "template", "", "Workspace template to apply after creating the workspace")
+	workspaceCreateCmd.Flags().StringArrayVar(&workspaceTemplateParams, "param", nil, "Template parameter (key=value), repeatable")
+	workspaceUsageCmd.Flags().DurationVar(&workspaceUsageWindow, "window", 24*time.Hour, "Period to average usage over (Prometheus only)")
+	workspaceUsageCmd.Flags().StringVar(&workspaceUsageSource, "source", "auto", "Metrics source: auto, prometheus or metrics-server")
+	workspaceDeleteCmd.Flags().BoolVarP(&workspaceDeleteYes, "yes", "y", false, "Skip the confirmation prompt")
+	workspaceDeleteCmd.Flags().DurationVar(&workspaceDeleteTimeout, "timeout", 10*time.Minute, "How long each deletion step waits for finalizers to complete")
+	workspaceAddMemberCmd.Flags().StringVar(&workspaceMemberRole, "role", v1alpha1.WorkspaceRoleDeveloper, "Role to grant: admin, developer or viewer")
+	workspaceAddMemberCmd.Flags().BoolVar(&workspaceMemberGroup, "group", false, "Treat the name as a Dex group instead of a user email")
+	workspaceRemoveMemberCmd.Flags().BoolVar(&workspaceMemberGroup, "group", false, "Treat the name as a Dex group instead of a user email")
+	workspaceAllowCmd.Flags().StringVar(&workspaceGrantTo, "to", "", "Workspace that receives the traffic")
+	workspaceAllowCmd.Flags().StringVar(&workspaceGrantApp, "app", "", "Only allow traffic to the pods of this application")
+	workspaceAllowCmd.Flags().Int32SliceVar(&workspaceGrantPorts, "port", nil, "Only allow these container ports (repeatable)")
+	workspaceRevokeCmd.Flags().StringVar(&workspaceGrantTo, "to", "", "Workspace that receives the traffic")
+	workspaceRevokeCmd.Flags().StringVar(&workspaceGrantApp, "app", "", "Application the grant is limited to, if any")
+	_ = workspaceAllowCmd.MarkFlagRequired("to")
+	_ = workspaceRevokeCmd.MarkFlagRequired("to")
+
 	workspaceCmd.AddCommand(workspaceCreateCmd)
 	workspaceCmd.AddCommand(workspaceUseCmd)
 	workspaceCmd.AddCommand(workspaceListCmd)
 	workspaceCmd.AddCommand(workspaceDeleteCmd)
+	workspaceCmd.AddCommand(workspaceDescribeCmd)
+	workspaceCmd.AddCommand(workspaceAddMemberCmd)
+	workspaceCmd.AddCommand(workspaceRemoveMemberCmd)
+	workspaceCmd.AddCommand(workspaceMembersCmd)
+	workspaceCmd.AddCommand(workspaceAllowCmd)
+	workspaceCmd.AddCommand(workspaceRevokeCmd)
+	workspaceCmd.AddCommand(workspaceGrantsCmd)
 	workspaceCmd.AddCommand(workspaceCurrentCmd)
+	workspaceCmd.AddCommand(workspaceTemplateCmd)
+	workspaceCmd.AddCommand(workspaceUsageCmd)
 }
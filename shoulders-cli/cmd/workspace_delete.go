@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/tui"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	workspaceDeleteYes     bool
+	workspaceDeleteTimeout time.Duration
+)
+
+// workspaceResourceKind is a kind listed in the inventory of a workspace.
+// Tenant XRs are deleted by stage, lowest first, so consumers go before the
+// state stores and event streams they use. Kinds without a stage go with the
+// namespace once the Workspace itself is deleted.
+type workspaceResourceKind struct {
+	Kind  string
+	GVR   schema.GroupVersionResource
+	Stage int
+}
+
+// workspaceResource is one object found in a workspace namespace.
+type workspaceResource struct {
+	Kind        string   `json:"kind" yaml:"kind"`
+	Name        string   `json:"name" yaml:"name"`
+	Terminating bool     `json:"terminating,omitempty" yaml:"terminating,omitempty"`
+	Finalizers  []string `json:"finalizers,omitempty" yaml:"finalizers,omitempty"`
+}
+
+var workspaceInventoryKinds = []workspaceResourceKind{
+	{Kind: "WebApplication", GVR: schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "webapplications"}, Stage: 1},
+	{Kind: "Workload", GVR: schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "workloads"}, Stage: 1},
+	{Kind: "EventStream", GVR: schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "eventstreams"}, Stage: 2},
+	{Kind: "StateStore", GVR: schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "statestores"}, Stage: 3},
+	{Kind: "Cluster.postgresql.cnpg.io", GVR: schema.GroupVersionResource{Group: "postgresql.cnpg.io", Version: "v1", Resource: "clusters"}},
+	{Kind: "Kafka", GVR: schema.GroupVersionResource{Group: "kafka.strimzi.io", Version: "v1", Resource: "kafkas"}},
+	{Kind: "KafkaNodePool", GVR: schema.GroupVersionResource{Group: "kafka.strimzi.io", Version: "v1", Resource: "kafkanodepools"}},
+	{Kind: "KafkaTopic", GVR: schema.GroupVersionResource{Group: "kafka.strimzi.io", Version: "v1", Resource: "kafkatopics"}},
+	{Kind: "PersistentVolumeClaim", GVR: schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}},
+}
+
+var workspaceDeleteStages = []struct {
+	Name  string
+	Stage int
+}{
+	{Name: "Delete applications and workloads", Stage: 1},
+	{Name: "Delete event streams", Stage: 2},
+	{Name: "Delete state stores", Stage: 3},
+}
+
+var workspaceDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a Workspace and everything in it",
+	Long: "Lists the Shoulders resources and PersistentVolumeClaims in the workspace and asks for confirmation. " +
+		"Applications and workloads are deleted first, then event streams and state stores, and finally the Workspace and its namespace. " +
+		"Resources still terminating when --timeout expires are reported with the finalizers that block them.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		ctx := cmd.Context()
+		dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+		if err != nil {
+			return err
+		}
+		gvr := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "workspaces"}
+		if _, err := dynamicClient.Resource(gvr).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			return err
+		}
+
+		inventory, err := workspaceInventory(ctx, dynamicClient, name, workspaceInventoryKinds)
+		if err != nil {
+			return err
+		}
+		if len(inventory) == 0 {
+			fmt.Printf("Workspace %s is empty\n", name)
+		} else {
+			fmt.Printf("Workspace %s contains:\n", name)
+			rows := make([][]string, 0, len(inventory))
+			for _, resource := range inventory {
+				rows = append(rows, []string{resource.Kind, resource.Name})
+			}
+			if err := output.PrintTable([]string{"Kind", "Name"}, rows); err != nil {
+				return err
+			}
+		}
+		if !workspaceDeleteYes {
+			confirmed, _ := pterm.DefaultInteractiveConfirm.Show(fmt.Sprintf("Delete workspace %s and all %d resources in it?", name, len(inventory)))
+			if !confirmed {
+				return fmt.Errorf("workspace deletion cancelled")
+			}
+		}
+
+		phases := []string{}
+		for _, stage := range workspaceDeleteStages {
+			phases = append(phases, stage.Name)
+		}
+		phases = append(phases, "Delete workspace and namespace")
+		tracker := tui.NewPhaseTracker(phases, true)
+
+		var stuck []workspaceResource
+		for _, stage := range workspaceDeleteStages {
+			kinds := workspaceStageKinds(stage.Stage)
+			tracker.Start("deleting")
+			if stuck, err = deleteWorkspaceStage(ctx, dynamicClient, name, kinds, tracker); err != nil {
+				tracker.Fail(err.Error())
+				break
+			}
+			tracker.Complete()
+		}
+		if err == nil {
+			tracker.Start("deleting workspace " + name)
+			if stuck, err = deleteWorkspaceNamespace(ctx, dynamicClient, name, tracker); err != nil {
+				tracker.Fail(err.Error())
+			} else {
+				tracker.Complete()
+			}
+		}
+		tracker.Stop()
+
+		if err != nil {
+			for _, resource := range stuck {
+				pterm.Warning.Println(describeStuckWorkspaceResource(resource))
+			}
+			return err
+		}
+		fmt.Printf("\nWorkspace %s deleted in %s\n", name, tui.FormatDuration(tracker.Elapsed()))
+		return nil
+	},
+}
+
+// workspaceInventory lists the objects of kinds in the workspace namespace.
+// Kinds whose API is not installed, such as Kafka on the small profile, are
+// skipped.
+func workspaceInventory(ctx context.Context, client dynamic.Interface, namespace string, kinds []workspaceResourceKind) ([]workspaceResource, error) {
+	resources := []workspaceResource{}
+	for _, kind := range kinds {
+		list, err := client.Resource(kind.GVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			if isMissingAPIResource(err) {
+				continue
+			}
+			return nil, fmt.Errorf("list %s in %s: %w", kind.GVR.Resource, namespace, err)
+		}
+		for index := range list.Items {
+			resources = append(resources, workspaceResourceFromObject(kind.Kind, &list.Items[index]))
+		}
+	}
+	return resources, nil
+}
+
+func workspaceResourceFromObject(kind string, obj *unstructured.Unstructured) workspaceResource {
+	return workspaceResource{
+		Kind:        kind,
+		Name:        obj.GetName(),
+		Terminating: obj.GetDeletionTimestamp() != nil,
+		Finalizers:  obj.GetFinalizers(),
+	}
+}
+
+func workspaceStageKinds(stage int) []workspaceResourceKind {
+	kinds := []workspaceResourceKind{}
+	for _, kind := range workspaceInventoryKinds {
+		if kind.Stage == stage {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// deleteWorkspaceStage deletes every object of kinds in the namespace and
+// waits for them to disappear. On timeout it returns what is left.
+func deleteWorkspaceStage(ctx context.Context, client dynamic.Interface, namespace string, kinds []workspaceResourceKind, tracker *tui.PhaseTracker) ([]workspaceResource, error) {
+	resources, err := workspaceInventory(ctx, client, namespace, kinds)
+	if err != nil {
+		return nil, err
+	}
+	for _, kind := range kinds {
+		for _, resource := range resources {
+			if resource.Kind != kind.Kind || resource.Terminating {
+				continue
+			}
+			err := client.Resource(kind.GVR).Namespace(namespace).Delete(ctx, resource.Name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return nil, fmt.Errorf("delete %s %s: %w", resource.Kind, resource.Name, err)
+			}
+		}
+	}
+	return waitForWorkspaceResources(ctx, tracker, func(ctx context.Context) ([]workspaceResource, error) {
+		return workspaceInventory(ctx, client, namespace, kinds)
+	})
+}
+
+// deleteWorkspaceNamespace deletes the Workspace XR and waits until it and
+// its namespace are gone, which also removes the kinds without a stage.
+func deleteWorkspaceNamespace(ctx context.Context, client dynamic.Interface, name string, tracker *tui.PhaseTracker) ([]workspaceResource, error) {
+	workspaceGVR := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "workspaces"}
+	namespaceGVR := schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	if err := client.Resource(workspaceGVR).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("delete workspace %s: %w", name, err)
+	}
+	return waitForWorkspaceResources(ctx, tracker, func(ctx context.Context) ([]workspaceResource, error) {
+		remaining := []workspaceResource{}
+		for _, owner := range []struct {
+			kind string
+			gvr  schema.GroupVersionResource
+		}{{"Workspace", workspaceGVR}, {"Namespace", namespaceGVR}} {
+			obj, err := client.Resource(owner.gvr).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			remaining = append(remaining, workspaceResourceFromObject(owner.kind, obj))
+		}
+		if len(remaining) == 0 {
+			return remaining, nil
+		}
+		contents, err := workspaceInventory(ctx, client, name, workspaceInventoryKinds)
+		if err != nil {
+			return nil, err
+		}
+		return append(remaining, contents...), nil
+	})
+}
+
+// waitForWorkspaceResources polls list until it returns nothing, showing the
+// remaining objects as progress. On timeout it returns the last list.
+func waitForWorkspaceResources(ctx context.Context, tracker *tui.PhaseTracker, list func(context.Context) ([]workspaceResource, error)) ([]workspaceResource, error) {
+	deadline := time.Now().Add(workspaceDeleteTimeout)
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		remaining, err := list(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(remaining) == 0 {
+			return nil, nil
+		}
+		tracker.UpdateDetail(summarizeWorkspaceResources(remaining))
+		if time.Now().After(deadline) {
+			return remaining, fmt.Errorf("%d resources still present after %s", len(remaining), workspaceDeleteTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return remaining, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func summarizeWorkspaceResources(resources []workspaceResource) string {
+	names := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		names = append(names, resource.Kind+"/"+resource.Name)
+	}
+	sort.Strings(names)
+	if len(names) > 3 {
+		names = append(names[:3], fmt.Sprintf("%d more", len(names)-3))
+	}
+	return "waiting for " + strings.Join(names, ", ")
+}
+
+func describeStuckWorkspaceResource(resource workspaceResource) string {
+	if !resource.Terminating {
+		return fmt.Sprintf("%s %s has not started terminating", resource.Kind, resource.Name)
+	}
+	if len(resource.Finalizers) == 0 {
+		return fmt.Sprintf("%s %s is stuck in Terminating", resource.Kind, resource.Name)
+	}
+	return fmt.Sprintf("%s %s is stuck in Terminating, blocked by finalizer %s", resource.Kind, resource.Name, strings.Join(resource.Finalizers, ", "))
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestWorkspaceDeleteStagesCoverTenantKinds(t *testing.T) {
+	seen := map[string]int{}
+	for _, stage := range workspaceDeleteStages {
+		for _, kind := range workspaceStageKinds(stage.Stage) {
+			seen[kind.Kind] = stage.Stage
+		}
+	}
+	if seen["WebApplication"] >= seen["StateStore"] || seen["Workload"] >= seen["EventStream"] {
+		t.Fatalf("expected consumers to be deleted before their dependencies, got %v", seen)
+	}
+	if _, ok := seen["PersistentVolumeClaim"]; ok {
+		t.Fatalf("expected PVCs to be left to the namespace deletion")
+	}
+}
+
+func TestDescribeStuckWorkspaceResource(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetName("orders-db")
+	now := metav1.Now()
+	obj.SetDeletionTimestamp(&now)
+	obj.SetFinalizers([]string{"cnpg.io/cluster"})
+
+	resource := workspaceResourceFromObject("Cluster.postgresql.cnpg.io", obj)
+	message := describeStuckWorkspaceResource(resource)
+	if !strings.Contains(message, "stuck in Terminating") || !strings.Contains(message, "cnpg.io/cluster") {
+		t.Fatalf("unexpected message: %s", message)
+	}
+	if message := describeStuckWorkspaceResource(workspaceResource{Kind: "StateStore", Name: "orders"}); !strings.Contains(message, "not started") {
+		t.Fatalf("unexpected message: %s", message)
+	}
+	summary := summarizeWorkspaceResources([]workspaceResource{{Kind: "A", Name: "1"}, {Kind: "B", Name: "2"}, {Kind: "C", Name: "3"}, {Kind: "D", Name: "4"}, {Kind: "E", Name: "5"}})
+	if !strings.HasSuffix(summary, "2 more") {
+		t.Fatalf("unexpected summary: %s", summary)
+	}
+}
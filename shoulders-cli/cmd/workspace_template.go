@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/templates"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// workspaceNamespaceTimeout bounds how long workspace create waits for the
+// composition to create the namespace before applying a template.
+const workspaceNamespaceTimeout = 2 * time.Minute
+
+var (
+	workspaceTemplateName   string
+	workspaceTemplateParams []string
+)
+
+var workspaceTemplateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "List and inspect workspace templates",
+	Long: "Templates are directories of Go-templated Shoulders manifests applied by 'workspace create --template'. " +
+		"They are discovered from ~/.shoulders/templates and a built-in set; a user template replaces a built-in one of the same name.",
+}
+
+var workspaceTemplateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available workspace templates",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+		userDir, err := templates.UserDir()
+		if err != nil {
+			return err
+		}
+		found, err := templates.Discover(userDir)
+		if err != nil {
+			return err
+		}
+
+		if format == output.Table {
+			rows := make([][]string, 0, len(found))
+			for _, tmpl := range found {
+				rows = append(rows, []string{tmpl.Name, tmpl.Source, tmpl.Description})
+			}
+			return output.PrintTable([]string{"Name", "Source", "Description"}, rows)
+		}
+		payload, err := output.Render(found, format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(payload))
+		return nil
+	},
+}
+
+var workspaceTemplateShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show the parameters and manifests of a workspace template",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+		userDir, err := templates.UserDir()
+		if err != nil {
+			return err
+		}
+		tmpl, err := templates.Find(userDir, args[0])
+		if err != nil {
+			return err
+		}
+
+		if format != output.Table {
+			payload, err := output.Render(tmpl, format)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(payload))
+			return nil
+		}
+		fmt.Printf("Template: %s (%s)\n", tmpl.Name, tmpl.Source)
+		if tmpl.Description != "" {
+			fmt.Printf("Description: %s\n", tmpl.Description)
+		}
+		if len(tmpl.Parameters) > 0 {
+			fmt.Println()
+			rows := make([][]string, 0, len(tmpl.Parameters))
+			for _, parameter := range tmpl.Parameters {
+				value := parameter.Default
+				if parameter.Required {
+					value = "(required)"
+				}
+				rows = append(rows, []string{parameter.Name, value, parameter.Description})
+			}
+			if err := output.PrintTable([]string{"Parameter", "Default", "Description"}, rows); err != nil {
+				return err
+			}
+		}
+		for _, file := range tmpl.Files {
+			fmt.Printf("\n# %s\n%s\n", file.Name, strings.TrimRight(file.Content, "\n"))
+		}
+		return nil
+	},
+}
+
+// renderWorkspaceTemplate renders the template selected with --template for
+// workspace, or returns nil when none was selected.
+func renderWorkspaceTemplate(workspace string) ([]byte, error) {
+	if workspaceTemplateName == "" {
+		if len(workspaceTemplateParams) > 0 {
+			return nil, fmt.Errorf("--param requires --template")
+		}
+		return nil, nil
+	}
+	params, err := templates.ParseParams(workspaceTemplateParams)
+	if err != nil {
+		return nil, err
+	}
+	userDir, err := templates.UserDir()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := templates.Find(userDir, workspaceTemplateName)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Render(workspace, params)
+}
+
+// waitForWorkspaceNamespace waits for the composition to create the
+// namespace of a new workspace.
+func waitForWorkspaceNamespace(ctx context.Context, name string, timeout time.Duration) error {
+	clientset, err := kube.NewClientset(kubeconfig)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			return nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("namespace %s was not created within %s", name, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func init() {
+	workspaceTemplateCmd.AddCommand(workspaceTemplateListCmd)
+	workspaceTemplateCmd.AddCommand(workspaceTemplateShowCmd)
+}
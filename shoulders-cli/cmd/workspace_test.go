@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newWorkspaceCreateTestCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	workspaceCPU, workspaceMemory, workspaceStorage, workspacePods = "", "", "", 0
+	workspaceDefaultCPURequest, workspaceDefaultMemoryRequest = "", ""
+	workspaceDefaultCPULimit, workspaceDefaultMemoryLimit = "", ""
+	cmd := &cobra.Command{Use: "create"}
+	registerWorkspaceQuotaFlags(cmd)
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	return cmd
+}
+
+func TestBuildWorkspaceSpec(t *testing.T) {
+	cmd := newWorkspaceCreateTestCommand(t, "--cpu", "4", "--memory", "8Gi", "--pods", "0", "--default-memory-limit", "512Mi")
+	spec, err := buildWorkspaceSpec(cmd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if spec.Quota == nil || spec.Quota.CPU != "4" || spec.Quota.Memory != "8Gi" {
+		t.Fatalf("expected cpu and memory quota, got %#v", spec.Quota)
+	}
+	if spec.Quota.Pods == nil || *spec.Quota.Pods != 0 {
+		t.Fatalf("expected an explicit zero pod quota, got %#v", spec.Quota.Pods)
+	}
+	if spec.Defaults == nil || spec.Defaults.Requests != nil || spec.Defaults.Limits == nil || spec.Defaults.Limits.Memory != "512Mi" {
+		t.Fatalf("expected only a default memory limit, got %#v", spec.Defaults)
+	}
+
+	empty, err := buildWorkspaceSpec(newWorkspaceCreateTestCommand(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if empty.Quota != nil || empty.Defaults != nil {
+		t.Fatalf("expected an empty spec without flags, got %#v", empty)
+	}
+
+	if _, err := buildWorkspaceSpec(newWorkspaceCreateTestCommand(t, "--memory", "8 gigs")); err == nil {
+		t.Fatalf("expected an invalid quantity to fail")
+	}
+}
+
+func TestWorkspaceQuotaUsages(t *testing.T) {
+	quota := &corev1.ResourceQuota{
+		Spec: corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{
+			corev1.ResourcePods:           resource.MustParse("10"),
+			corev1.ResourceRequestsCPU:    resource.MustParse("4"),
+			corev1.ResourceRequestsMemory: resource.MustParse("8Gi"),
+		}},
+		Status: corev1.ResourceQuotaStatus{Used: corev1.ResourceList{
+			corev1.ResourceRequestsCPU: resource.MustParse("1500m"),
+		}},
+	}
+	usages := workspaceQuotaUsages(quota)
+	if len(usages) != 3 || usages[0].Resource != "pods" || usages[0].Used != "0" {
+		t.Fatalf("unexpected usages: %#v", usages)
+	}
+	if usages[1].Resource != "requests.cpu" || usages[1].Used != "1500m" || usages[1].Hard != "4" {
+		t.Fatalf("unexpected cpu usage: %#v", usages[1])
+	}
+}
+
+func TestWorkspaceMemberEdits(t *testing.T) {
+	members := []v1alpha1.WorkspaceMember{{Name: "dev@example.com", Role: "viewer"}}
+
+	members, changed := upsertWorkspaceMember(members, v1alpha1.WorkspaceMember{Kind: "User", Name: "dev@example.com", Role: "developer"})
+	if !changed || len(members) != 1 || members[0].Role != "developer" {
+		t.Fatalf("expected role update for an existing user, got %#v", members)
+	}
+	members, changed = upsertWorkspaceMember(members, v1alpha1.WorkspaceMember{Kind: "Group", Name: "dev@example.com", Role: "admin"})
+	if !changed || len(members) != 2 {
+		t.Fatalf("expected a group with the same name to be a separate member, got %#v", members)
+	}
+	if _, changed = upsertWorkspaceMember(members, v1alpha1.WorkspaceMember{Kind: "User", Name: "dev@example.com", Role: "developer"}); changed {
+		t.Fatalf("expected an identical member to be a no-op")
+	}
+
+	members, changed = removeWorkspaceMember(members, "User", "dev@example.com")
+	if !changed || len(members) != 1 || members[0].Kind != "Group" {
+		t.Fatalf("expected only the user entry to be removed, got %#v", members)
+	}
+	if _, changed = removeWorkspaceMember(members, "User", "nobody@example.com"); changed {
+		t.Fatalf("expected removing an unknown member to be a no-op")
+	}
+
+	if err := validateWorkspaceRole("owner"); err == nil {
+		t.Fatalf("expected unknown role to fail")
+	}
+}
+
+func TestWorkspaceMembersDecode(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "team-a"},
+		"spec": map[string]interface{}{
+			"members": []interface{}{
+				map[string]interface{}{"name": "dev@example.com", "role": "developer"},
+				map[string]interface{}{"kind": "Group", "name": "ops", "role": "admin"},
+			},
+		},
+	}}
+	workspace, err := decodeWorkspace(obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	members := workspace.Spec.Members
+	if len(members) != 2 || members[1].Kind != "Group" || members[0].Role != "developer" {
+		t.Fatalf("unexpected members: %#v", members)
+	}
+}
+
+func TestWorkspaceGrantEdits(t *testing.T) {
+	grants := []v1alpha1.WorkspaceGrant{{Workspace: "team-b"}}
+
+	grants, changed := upsertWorkspaceGrant(grants, v1alpha1.WorkspaceGrant{Workspace: "team-b", App: "api", Ports: []int32{8080}})
+	if !changed || len(grants) != 2 {
+		t.Fatalf("expected an app grant to be separate from the workspace grant, got %#v", grants)
+	}
+	grants, changed = upsertWorkspaceGrant(grants, v1alpha1.WorkspaceGrant{Workspace: "team-b", App: "api", Ports: []int32{8080, 9090}})
+	if !changed || len(grants) != 2 || len(grants[1].Ports) != 2 {
+		t.Fatalf("expected the ports of the app grant to be replaced, got %#v", grants)
+	}
+	if _, changed = upsertWorkspaceGrant(grants, v1alpha1.WorkspaceGrant{Workspace: "team-b"}); changed {
+		t.Fatalf("expected an identical grant to be a no-op")
+	}
+
+	grants, changed = removeWorkspaceGrant(grants, "team-b", "")
+	if !changed || len(grants) != 1 || grants[0].App != "api" {
+		t.Fatalf("expected only the workspace grant to be removed, got %#v", grants)
+	}
+
+	if err := validateWorkspaceGrant("team-a", v1alpha1.WorkspaceGrant{Workspace: "team-a"}); err == nil {
+		t.Fatalf("expected a grant to the same workspace to fail")
+	}
+	if err := validateWorkspaceGrant("team-a", v1alpha1.WorkspaceGrant{Workspace: "team-b", Ports: []int32{70000}}); err == nil {
+		t.Fatalf("expected an out of range port to fail")
+	}
+}
+
+func TestWorkspaceGrantRows(t *testing.T) {
+	workspaces := []v1alpha1.Workspace{
+		{ObjectMeta: v1alpha1.ObjectMeta("team-c", ""), Spec: v1alpha1.WorkspaceSpec{AllowFrom: []v1alpha1.WorkspaceGrant{{Workspace: "team-a"}}}},
+		{ObjectMeta: v1alpha1.ObjectMeta("team-a", ""), Spec: v1alpha1.WorkspaceSpec{AllowFrom: []v1alpha1.WorkspaceGrant{{Workspace: "team-b", App: "api", Ports: []int32{8080}}}}},
+	}
+
+	apps := []unstructured.Unstructured{{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "namespace": "team-c"},
+		"spec":     map[string]interface{}{"port": int64(3000), "exposeTo": []interface{}{"team-b"}},
+	}}}
+
+	rows := workspaceGrantRows(workspaces, nil, "")
+	if len(rows) != 2 || rows[0].To != "team-a" || rows[0].From != "team-b" {
+		t.Fatalf("expected grants sorted by target workspace, got %#v", rows)
+	}
+	rows = workspaceGrantRows(workspaces, nil, "team-b")
+	if len(rows) != 1 || rows[0].App != "api" {
+		t.Fatalf("expected only the grants involving team-b, got %#v", rows)
+	}
+	rows = workspaceGrantRows(workspaces, apps, "team-b")
+	if len(rows) != 2 || rows[1].To != "team-c" || rows[1].App != "web" || len(rows[1].Ports) != 1 || rows[1].Ports[0] != 3000 {
+		t.Fatalf("expected the app exposure to team-b on its container port, got %#v", rows)
+	}
+	if ports := formatWorkspaceGrantPorts(nil); ports != "all" {
+		t.Fatalf("expected all ports, got %q", ports)
+	}
+}
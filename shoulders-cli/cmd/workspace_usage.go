@@ -0,0 +1,450 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/output"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/usage"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// cnpgClusterLabel marks the PVCs CloudNativePG creates for a cluster.
+const cnpgClusterLabel = "cnpg.io/cluster"
+
+var (
+	workspaceUsageWindow time.Duration
+	workspaceUsageSource string
+)
+
+type workspaceUsageRow struct {
+	Kind          string            `json:"kind" yaml:"kind"`
+	Name          string            `json:"name" yaml:"name"`
+	Container     string            `json:"container" yaml:"container"`
+	Pods          int               `json:"pods" yaml:"pods"`
+	CPURequest    string            `json:"cpuRequest,omitempty" yaml:"cpuRequest,omitempty"`
+	CPULimit      string            `json:"cpuLimit,omitempty" yaml:"cpuLimit,omitempty"`
+	CPUAvg        string            `json:"cpuAvg,omitempty" yaml:"cpuAvg,omitempty"`
+	CPUPeak       string            `json:"cpuPeak,omitempty" yaml:"cpuPeak,omitempty"`
+	MemoryRequest string            `json:"memoryRequest,omitempty" yaml:"memoryRequest,omitempty"`
+	MemoryLimit   string            `json:"memoryLimit,omitempty" yaml:"memoryLimit,omitempty"`
+	MemoryAvg     string            `json:"memoryAvg,omitempty" yaml:"memoryAvg,omitempty"`
+	MemoryPeak    string            `json:"memoryPeak,omitempty" yaml:"memoryPeak,omitempty"`
+	Status        string            `json:"status" yaml:"status"`
+	Reasons       []string          `json:"reasons,omitempty" yaml:"reasons,omitempty"`
+	Suggested     map[string]string `json:"suggested,omitempty" yaml:"suggested,omitempty"`
+	Command       string            `json:"command,omitempty" yaml:"command,omitempty"`
+}
+
+type workspaceVolumeUsage struct {
+	Cluster     string  `json:"cluster" yaml:"cluster"`
+	Claim       string  `json:"claim" yaml:"claim"`
+	Capacity    string  `json:"capacity" yaml:"capacity"`
+	Used        string  `json:"used,omitempty" yaml:"used,omitempty"`
+	UsedPercent float64 `json:"usedPercent,omitempty" yaml:"usedPercent,omitempty"`
+}
+
+type workspaceUsageReport struct {
+	Workspace string                 `json:"workspace" yaml:"workspace"`
+	Source    string                 `json:"source" yaml:"source"`
+	Window    string                 `json:"window" yaml:"window"`
+	Workloads []workspaceUsageRow    `json:"workloads" yaml:"workloads"`
+	Volumes   []workspaceVolumeUsage `json:"volumes" yaml:"volumes"`
+}
+
+// workspaceUsageTarget is an app or workload with the containers whose
+// resources its spec sets.
+type workspaceUsageTarget struct {
+	Kind       string
+	Name       string
+	Containers []workspaceUsageContainer
+}
+
+// workspaceUsageContainer is the main container or a sidecar. Sidecar is the
+// index in spec.sidecars, or -1 for the main container.
+type workspaceUsageContainer struct {
+	Name      string
+	Sidecar   int
+	Resources map[string]interface{}
+}
+
+func workspaceUsageContainers(resources map[string]interface{}, sidecars []v1alpha1.ContainerSpec) []workspaceUsageContainer {
+	containers := []workspaceUsageContainer{{Name: mainContainerName, Sidecar: -1, Resources: resources}}
+	for index, sidecar := range sidecars {
+		containers = append(containers, workspaceUsageContainer{Name: sidecar.Name, Sidecar: index, Resources: sidecar.Resources})
+	}
+	return containers
+}
+
+var workspaceUsageCmd = &cobra.Command{
+	Use:   "usage [name]",
+	Short: "Compare requested resources with actual usage and suggest right-sizing",
+	Long: "Reads the requests and limits of every container of the WebApplications and Workloads in the workspace, sidecars included, " +
+		"and compares each with the average and peak usage of that container over --window, from Prometheus or, without it, the current usage from metrics-server. " +
+		"Containers using less than half their request are over-provisioned; an average above the request or a peak within 10% " +
+		"of the limit is under-provisioned. Suggested values leave 20% headroom over the peak for requests and 50% for limits.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputOption()
+		if err != nil {
+			return err
+		}
+		namespace := ""
+		if len(args) == 1 {
+			namespace = args[0]
+		} else if namespace, err = currentNamespace(); err != nil {
+			return err
+		}
+
+		report, err := buildWorkspaceUsageReport(cmd.Context(), namespace)
+		if err != nil {
+			return err
+		}
+		if format != output.Table {
+			payload, err := output.Render(report, format)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(payload))
+			return nil
+		}
+		return printWorkspaceUsageReport(report)
+	},
+}
+
+func buildWorkspaceUsageReport(ctx context.Context, namespace string) (workspaceUsageReport, error) {
+	source, err := workspaceUsageMetricsSource(ctx)
+	if err != nil {
+		return workspaceUsageReport{}, err
+	}
+	targets, err := workspaceUsageTargets(ctx, namespace)
+	if err != nil {
+		return workspaceUsageReport{}, err
+	}
+	pods, err := source.ContainerSamples(ctx, namespace, workspaceUsageWindow)
+	if err != nil {
+		return workspaceUsageReport{}, err
+	}
+
+	report := workspaceUsageReport{Workspace: namespace, Source: source.Name(), Window: workspaceUsageWindow.String()}
+	if source.Name() == usage.SourceMetricsServer {
+		report.Window = "current"
+	}
+	owners := make([]string, 0, len(targets))
+	for _, target := range targets {
+		owners = append(owners, target.Name)
+	}
+	report.Workloads = []workspaceUsageRow{}
+	for _, target := range targets {
+		samples := usage.Aggregate(pods, target.Name, owners)
+		for _, container := range target.Containers {
+			row, err := workspaceUsageRowFor(target, container, namespace, samples[container.Name])
+			if err != nil {
+				return workspaceUsageReport{}, err
+			}
+			report.Workloads = append(report.Workloads, row)
+		}
+	}
+
+	report.Volumes, err = workspaceVolumeUsages(ctx, namespace, source)
+	if err != nil {
+		return workspaceUsageReport{}, err
+	}
+	return report, nil
+}
+
+// workspaceUsageMetricsSource picks --source, or Prometheus when it answers
+// and metrics-server otherwise.
+func workspaceUsageMetricsSource(ctx context.Context) (usage.Source, error) {
+	clientset, err := kube.NewClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	prometheus := usage.Prometheus{Clientset: clientset}
+	metricsServer := usage.MetricsServer{Client: dynamicClient}
+
+	switch workspaceUsageSource {
+	case usage.SourcePrometheus:
+		return prometheus, nil
+	case usage.SourceMetricsServer:
+		return metricsServer, nil
+	case "auto":
+		if prometheus.Available(ctx) {
+			return prometheus, nil
+		}
+		if metricsServer.Available(ctx) {
+			return metricsServer, nil
+		}
+		return nil, fmt.Errorf("no metrics source found: enable the observability component (Prometheus) or install metrics-server")
+	default:
+		return nil, fmt.Errorf("unsupported metrics source %q (supported: auto, prometheus, metrics-server)", workspaceUsageSource)
+	}
+}
+
+func workspaceUsageTargets(ctx context.Context, namespace string) ([]workspaceUsageTarget, error) {
+	dynamicClient, err := kube.NewDynamicClient(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	targets := []workspaceUsageTarget{}
+
+	appGVR := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "webapplications"}
+	apps, err := dynamicClient.Resource(appGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !isMissingAPIResource(err) {
+		return nil, err
+	}
+	if err == nil {
+		for _, item := range apps.Items {
+			var app v1alpha1.WebApplication
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &app); err != nil {
+				return nil, fmt.Errorf("decode app %s: %w", item.GetName(), err)
+			}
+			targets = append(targets, workspaceUsageTarget{Kind: "WebApplication", Name: app.Name, Containers: workspaceUsageContainers(app.Spec.Resources, app.Spec.Sidecars)})
+		}
+	}
+
+	workloadGVR := schema.GroupVersionResource{Group: v1alpha1.Group, Version: v1alpha1.Version, Resource: "workloads"}
+	workloads, err := dynamicClient.Resource(workloadGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil && !isMissingAPIResource(err) {
+		return nil, err
+	}
+	if err == nil {
+		for _, item := range workloads.Items {
+			var workload v1alpha1.Workload
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &workload); err != nil {
+				return nil, fmt.Errorf("decode workload %s: %w", item.GetName(), err)
+			}
+			targets = append(targets, workspaceUsageTarget{Kind: "Workload", Name: workload.Name, Containers: workspaceUsageContainers(workload.Spec.Resources, workload.Spec.Sidecars)})
+		}
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		if targets[i].Kind != targets[j].Kind {
+			return targets[i].Kind < targets[j].Kind
+		}
+		return targets[i].Name < targets[j].Name
+	})
+	return targets, nil
+}
+
+func workspaceUsageRowFor(target workspaceUsageTarget, container workspaceUsageContainer, namespace string, sample usage.Sample) (workspaceUsageRow, error) {
+	resources, err := usage.ParseResources(container.Resources)
+	if err != nil {
+		return workspaceUsageRow{}, fmt.Errorf("%s %s container %s: %w", target.Kind, target.Name, container.Name, err)
+	}
+	assessment := usage.Assess(resources, sample)
+	row := workspaceUsageRow{
+		Kind:          target.Kind,
+		Name:          target.Name,
+		Container:     container.Name,
+		Pods:          sample.Pods,
+		CPURequest:    specResourceValue(container.Resources, "requests", "cpu"),
+		CPULimit:      specResourceValue(container.Resources, "limits", "cpu"),
+		MemoryRequest: specResourceValue(container.Resources, "requests", "memory"),
+		MemoryLimit:   specResourceValue(container.Resources, "limits", "memory"),
+		Status:        assessment.Status,
+		Reasons:       assessment.Reasons,
+	}
+	if sample.Pods > 0 {
+		row.CPUAvg = usage.DescribeCPU(sample.CPUAvg)
+		row.CPUPeak = usage.DescribeCPU(sample.CPUPeak)
+		row.MemoryAvg = usage.DescribeMemory(sample.MemoryAvg)
+		row.MemoryPeak = usage.DescribeMemory(sample.MemoryPeak)
+	}
+	if len(assessment.Suggested) > 0 {
+		row.Suggested = assessment.Suggested
+		row.Command = workspaceUsageCommand(target.Kind, target.Name, namespace, container, assessment.Suggested)
+	}
+	return row, nil
+}
+
+// workspaceUsageCommand renders the command that applies suggested. Apps
+// have app update; workloads are patched because re-running workload worker
+// would reset every field that is not passed again. Sidecars have no update
+// flags, so their resources are replaced with a JSON patch.
+func workspaceUsageCommand(kind, name, namespace string, container workspaceUsageContainer, suggested map[string]string) string {
+	flags := make([]string, 0, len(suggested))
+	for flag := range suggested {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+
+	if container.Sidecar >= 0 {
+		return workspaceUsageSidecarCommand(kind, name, namespace, container, suggested)
+	}
+	if kind == "WebApplication" {
+		parts := []string{"shoulders app update", name, "-n", namespace}
+		for _, flag := range flags {
+			parts = append(parts, "--"+flag, suggested[flag])
+		}
+		return strings.Join(parts, " ")
+	}
+
+	sections := map[string][]string{}
+	for _, flag := range flags {
+		name, kind, _ := strings.Cut(flag, "-")
+		section := "requests"
+		if kind == "limit" {
+			section = "limits"
+		}
+		sections[section] = append(sections[section], fmt.Sprintf("%q:%q", name, suggested[flag]))
+	}
+	patch := []string{}
+	for _, section := range []string{"requests", "limits"} {
+		if values := sections[section]; len(values) > 0 {
+			patch = append(patch, fmt.Sprintf("%q:{%s}", section, strings.Join(values, ",")))
+		}
+	}
+	return fmt.Sprintf(`kubectl patch workloads.shoulders.io %s -n %s --type merge -p '{"spec":{"resources":{%s}}}'`, name, namespace, strings.Join(patch, ","))
+}
+
+// workspaceUsageSidecarCommand patches spec.sidecars[i].resources with the
+// current requests and limits of the sidecar updated by suggested.
+func workspaceUsageSidecarCommand(kind, name, namespace string, container workspaceUsageContainer, suggested map[string]string) string {
+	resources := map[string]map[string]interface{}{}
+	for _, section := range []string{"requests", "limits"} {
+		values, _ := container.Resources[section].(map[string]interface{})
+		for key, value := range values {
+			if resources[section] == nil {
+				resources[section] = map[string]interface{}{}
+			}
+			resources[section][key] = value
+		}
+	}
+	for flag, value := range suggested {
+		resourceName, bound, _ := strings.Cut(flag, "-")
+		section := "requests"
+		if bound == "limit" {
+			section = "limits"
+		}
+		if resources[section] == nil {
+			resources[section] = map[string]interface{}{}
+		}
+		resources[section][resourceName] = value
+	}
+	patch, _ := json.Marshal([]map[string]interface{}{{
+		"op":    "add",
+		"path":  fmt.Sprintf("/spec/sidecars/%d/resources", container.Sidecar),
+		"value": resources,
+	}})
+	resource := "webapplications.shoulders.io"
+	if kind == "Workload" {
+		resource = "workloads.shoulders.io"
+	}
+	return fmt.Sprintf(`kubectl patch %s %s -n %s --type json -p '%s'`, resource, name, namespace, patch)
+}
+
+func workspaceVolumeUsages(ctx context.Context, namespace string, source usage.Source) ([]workspaceVolumeUsage, error) {
+	clientset, err := kube.NewClientset(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: cnpgClusterLabel})
+	if err != nil {
+		return nil, err
+	}
+	used, err := source.VolumeUsage(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := []workspaceVolumeUsage{}
+	for _, claim := range claims.Items {
+		volume := workspaceVolumeUsage{Cluster: claim.Labels[cnpgClusterLabel], Claim: claim.Name}
+		capacity, ok := claim.Status.Capacity["storage"]
+		if !ok {
+			capacity = claim.Spec.Resources.Requests["storage"]
+		}
+		volume.Capacity = capacity.String()
+		if bytes, ok := used[claim.Name]; ok {
+			volume.Used = usage.DescribeMemory(bytes)
+			if total := capacity.AsApproximateFloat64(); total > 0 {
+				volume.UsedPercent = float64(int(bytes/total*1000)) / 10
+			}
+		}
+		volumes = append(volumes, volume)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Claim < volumes[j].Claim })
+	return volumes, nil
+}
+
+func printWorkspaceUsageReport(report workspaceUsageReport) error {
+	fmt.Printf("Workspace: %s (source: %s, window: %s)\n\n", report.Workspace, report.Source, report.Window)
+	rows := make([][]string, 0, len(report.Workloads))
+	for _, row := range report.Workloads {
+		rows = append(rows, []string{
+			row.Kind,
+			row.Name,
+			row.Container,
+			fmt.Sprint(row.Pods),
+			usagePair(row.CPURequest, row.CPULimit),
+			usagePair(row.CPUAvg, row.CPUPeak),
+			usagePair(row.MemoryRequest, row.MemoryLimit),
+			usagePair(row.MemoryAvg, row.MemoryPeak),
+			row.Status,
+		})
+	}
+	if err := output.PrintTable([]string{"Kind", "Name", "Container", "Pods", "CPU req/limit", "CPU avg/peak", "Memory req/limit", "Memory avg/peak", "Status"}, rows); err != nil {
+		return err
+	}
+
+	if len(report.Volumes) > 0 {
+		fmt.Println()
+		volumeRows := make([][]string, 0, len(report.Volumes))
+		for _, volume := range report.Volumes {
+			used := "unknown"
+			if volume.Used != "" {
+				used = fmt.Sprintf("%s (%.1f%%)", volume.Used, volume.UsedPercent)
+			}
+			volumeRows = append(volumeRows, []string{volume.Cluster, volume.Claim, volume.Capacity, used})
+		}
+		if err := output.PrintTable([]string{"Database", "PVC", "Capacity", "Used"}, volumeRows); err != nil {
+			return err
+		}
+	}
+
+	suggestions := []string{}
+	for _, row := range report.Workloads {
+		if row.Command != "" {
+			suggestions = append(suggestions, fmt.Sprintf("# %s %s, container %s: %s\n%s", row.Kind, row.Name, row.Container, strings.Join(row.Reasons, "; "), row.Command))
+		}
+	}
+	if len(suggestions) > 0 {
+		fmt.Println()
+		pterm.Info.Println("Suggested changes:")
+		fmt.Println(strings.Join(suggestions, "\n"))
+	}
+	return nil
+}
+
+func specResourceValue(resources map[string]interface{}, section, name string) string {
+	values, _ := resources[section].(map[string]interface{})
+	if value, ok := values[name]; ok {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+func usagePair(first, second string) string {
+	if first == "" {
+		first = "-"
+	}
+	if second == "" {
+		second = "-"
+	}
+	return first + "/" + second
+}
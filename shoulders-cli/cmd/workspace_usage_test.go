@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/usage"
+	"github.com/jherreros/shoulders/shoulders-cli/pkg/api/v1alpha1"
+)
+
+func TestWorkspaceUsageCommand(t *testing.T) {
+	suggested := map[string]string{"cpu-request": "120m", "memory-limit": "448Mi"}
+
+	main := workspaceUsageContainer{Name: mainContainerName, Sidecar: -1}
+	app := workspaceUsageCommand("WebApplication", "team-a-web", "team-a", main, suggested)
+	if app != "shoulders app update team-a-web -n team-a --cpu-request 120m --memory-limit 448Mi" {
+		t.Fatalf("unexpected app command: %s", app)
+	}
+	workload := workspaceUsageCommand("Workload", "team-a-worker", "team-a", main, suggested)
+	expected := `kubectl patch workloads.shoulders.io team-a-worker -n team-a --type merge -p '{"spec":{"resources":{"requests":{"cpu":"120m"},"limits":{"memory":"448Mi"}}}}'`
+	if workload != expected {
+		t.Fatalf("unexpected workload command:\n%s\nexpected:\n%s", workload, expected)
+	}
+
+	sidecar := workspaceUsageContainer{
+		Name:      "proxy",
+		Sidecar:   1,
+		Resources: map[string]interface{}{"requests": map[string]interface{}{"cpu": "1", "memory": "64Mi"}},
+	}
+	patch := workspaceUsageCommand("WebApplication", "team-a-web", "team-a", sidecar, suggested)
+	expected = `kubectl patch webapplications.shoulders.io team-a-web -n team-a --type json -p '[{"op":"add","path":"/spec/sidecars/1/resources","value":{"limits":{"memory":"448Mi"},"requests":{"cpu":"120m","memory":"64Mi"}}}]'`
+	if patch != expected {
+		t.Fatalf("unexpected sidecar command:\n%s\nexpected:\n%s", patch, expected)
+	}
+}
+
+func TestWorkspaceUsageRowsAssessEachContainer(t *testing.T) {
+	target := workspaceUsageTarget{
+		Kind: "WebApplication",
+		Name: "team-a-web",
+		Containers: workspaceUsageContainers(
+			map[string]interface{}{"requests": map[string]interface{}{"cpu": "100m", "memory": "128Mi"}},
+			[]v1alpha1.ContainerSpec{{Name: "proxy", Resources: map[string]interface{}{"requests": map[string]interface{}{"cpu": "1", "memory": "64Mi"}}}},
+		),
+	}
+	samples := map[string]usage.Sample{
+		"app":   {CPUAvg: 0.15, CPUPeak: 0.2, MemoryAvg: 100 << 20, MemoryPeak: 110 << 20, Pods: 1},
+		"proxy": {CPUAvg: 0.05, CPUPeak: 0.1, MemoryAvg: 50 << 20, MemoryPeak: 60 << 20, Pods: 1},
+	}
+	statuses := map[string]string{}
+	for _, container := range target.Containers {
+		row, err := workspaceUsageRowFor(target, container, "team-a", samples[container.Name])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		statuses[row.Container] = row.Status
+	}
+	// Summed per pod, the app's shortfall would hide behind the idle proxy.
+	if statuses["app"] != usage.StatusUnderProvisioned || statuses["proxy"] != usage.StatusOverProvisioned {
+		t.Fatalf("expected each container to be assessed against its own request, got %v", statuses)
+	}
+}
@@ -0,0 +1,310 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// AddonLabel marks the Flux objects rendered for a platform.addons entry so
+// they can be found again when the addon is removed from the config.
+const AddonLabel = "shoulders.io/addon"
+
+var fluxOCIRepositoryGVR = schema.GroupVersionResource{
+	Group:    "source.toolkit.fluxcd.io",
+	Version:  "v1",
+	Resource: "ocirepositories",
+}
+
+var fluxHelmRepositoryGVR = schema.GroupVersionResource{
+	Group:    "source.toolkit.fluxcd.io",
+	Version:  "v1",
+	Resource: "helmrepositories",
+}
+
+var configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// addonHelmReleasePath holds the HelmRelease template that the Kustomization
+// of a helm addon renders, relative to the platform repo.
+const addonHelmReleasePath = "2-addons/manifests/addon-helm-release"
+
+// addonGVRs lists every kind an addon can render, consumers before sources.
+var addonGVRs = []schema.GroupVersionResource{
+	fluxKustomizationGVR,
+	kube.HelmReleaseGVR(),
+	configMapGVR,
+	fluxGitRepositoryGVR,
+	fluxOCIRepositoryGVR,
+	fluxHelmRepositoryGVR,
+}
+
+// AddonStatus reports the Ready condition of a configured addon.
+type AddonStatus struct {
+	Name    string `json:"name" yaml:"name"`
+	Kind    string `json:"kind" yaml:"kind"`
+	Ready   bool   `json:"ready" yaml:"ready"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// ApplyAddons applies the Flux sources and Kustomizations for addons and
+// deletes the objects of addons that are no longer configured. pathPrefix
+// locates the platform repo files, as for the built-in Kustomizations.
+func ApplyAddons(ctx context.Context, kubeconfigPath, pathPrefix string, addons []config.AddonConfig) error {
+	if err := config.ValidateAddons(addons); err != nil {
+		return err
+	}
+	if len(addons) > 0 {
+		manifest, err := fluxAddonsManifest(pathPrefix, addons)
+		if err != nil {
+			return err
+		}
+		if err := kube.ApplyManifest(ctx, kubeconfigPath, manifest, "flux-system"); err != nil {
+			return fmt.Errorf("apply flux addons: %w", err)
+		}
+	}
+
+	keep := map[string]bool{}
+	for _, addon := range addons {
+		keep[addon.Name] = true
+	}
+	return deleteAddons(ctx, kubeconfigPath, keep)
+}
+
+// AddonStatuses reads the readiness of each configured addon.
+func AddonStatuses(ctx context.Context, kubeconfigPath string, addons []config.AddonConfig) ([]AddonStatus, error) {
+	if len(addons) == 0 {
+		return nil, nil
+	}
+	client, err := kube.NewDynamicClient(kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+
+	statuses := make([]AddonStatus, 0, len(addons))
+	for _, addon := range addons {
+		status := AddonStatus{Name: addon.Name, Kind: "Kustomization"}
+		item, err := client.Resource(fluxKustomizationGVR).Namespace("flux-system").Get(ctx, addon.Name, metav1.GetOptions{})
+		if err != nil {
+			status.Message = err.Error()
+			statuses = append(statuses, status)
+			continue
+		}
+		status.Ready, _ = kube.HasCondition(*item, "Ready", "True")
+		if !status.Ready {
+			status.Message = readyConditionMessage(item.Object)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func deleteAddons(ctx context.Context, kubeconfigPath string, keep map[string]bool) error {
+	client, err := kube.NewDynamicClient(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("create dynamic client: %w", err)
+	}
+	for _, gvr := range addonGVRs {
+		list, err := client.Resource(gvr).Namespace("flux-system").List(ctx, metav1.ListOptions{LabelSelector: AddonLabel})
+		if err != nil {
+			if apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+				continue
+			}
+			return fmt.Errorf("list addon %s: %w", gvr.Resource, err)
+		}
+		for _, item := range list.Items {
+			if keep[item.GetLabels()[AddonLabel]] {
+				continue
+			}
+			if err := kube.Delete(ctx, client, gvr, "flux-system", item.GetName()); err != nil {
+				return fmt.Errorf("delete addon %s %s: %w", gvr.Resource, item.GetName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func fluxAddonsManifest(pathPrefix string, addons []config.AddonConfig) ([]byte, error) {
+	documents := []string{}
+	for _, addon := range addons {
+		objects := []map[string]interface{}{addonSource(addon)}
+		if addon.Source.Type == config.AddonSourceHelm {
+			values, err := addonHelmValues(addon)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, values, addonHelmKustomization(pathPrefix, addon))
+		} else {
+			objects = append(objects, addonKustomization(addon))
+		}
+		for _, object := range objects {
+			payload, err := yaml.Marshal(object)
+			if err != nil {
+				return nil, fmt.Errorf("render addon %s: %w", addon.Name, err)
+			}
+			documents = append(documents, string(payload))
+		}
+	}
+	return []byte(strings.Join(documents, "---\n")), nil
+}
+
+func addonMetadata(addon config.AddonConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      addon.Name,
+		"namespace": "flux-system",
+		"labels": map[string]interface{}{
+			"app.kubernetes.io/managed-by": "shoulders",
+			AddonLabel:                     addon.Name,
+		},
+	}
+}
+
+func addonSource(addon config.AddonConfig) map[string]interface{} {
+	spec := map[string]interface{}{
+		"interval": "10m",
+		"url":      addon.Source.URL,
+	}
+	source := map[string]interface{}{
+		"apiVersion": "source.toolkit.fluxcd.io/v1",
+		"metadata":   addonMetadata(addon),
+		"spec":       spec,
+	}
+	switch addon.Source.Type {
+	case config.AddonSourceGit:
+		source["kind"] = "GitRepository"
+		spec["interval"] = "1m"
+		spec["ref"] = map[string]interface{}{"branch": defaultString(addon.Source.Ref, "main")}
+	case config.AddonSourceOCI:
+		source["kind"] = "OCIRepository"
+		spec["ref"] = map[string]interface{}{"tag": defaultString(addon.Source.Ref, "latest")}
+	default:
+		source["kind"] = "HelmRepository"
+		if strings.HasPrefix(addon.Source.URL, "oci://") {
+			spec["type"] = "oci"
+		}
+	}
+	return source
+}
+
+func addonKustomization(addon config.AddonConfig) map[string]interface{} {
+	sourceKind := "GitRepository"
+	if addon.Source.Type == config.AddonSourceOCI {
+		sourceKind = "OCIRepository"
+	}
+	spec := map[string]interface{}{
+		"interval":  "10m",
+		"path":      defaultString(addon.Path, "./"),
+		"prune":     true,
+		"wait":      true,
+		"sourceRef": map[string]interface{}{"kind": sourceKind, "name": addon.Name},
+	}
+	if addon.Namespace != "" {
+		spec["targetNamespace"] = addon.Namespace
+	}
+	if len(addon.DependsOn) > 0 {
+		spec["dependsOn"] = addonDependencies(addon.DependsOn)
+	}
+	if len(addon.Values) > 0 {
+		substitute := map[string]interface{}{}
+		for key, value := range addon.Values {
+			substitute[key] = fmt.Sprint(value)
+		}
+		spec["postBuild"] = map[string]interface{}{"substitute": substitute}
+	}
+	return map[string]interface{}{
+		"apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+		"kind":       "Kustomization",
+		"metadata":   addonMetadata(addon),
+		"spec":       spec,
+	}
+}
+
+// addonHelmValues renders the ConfigMap that the HelmRelease of a helm addon
+// reads its values from.
+func addonHelmValues(addon config.AddonConfig) (map[string]interface{}, error) {
+	values := addon.Values
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	payload, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("render addon %s values: %w", addon.Name, err)
+	}
+	metadata := addonMetadata(addon)
+	metadata["name"] = addon.Name + "-values"
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   metadata,
+		"data":       map[string]interface{}{"values.yaml": string(payload)},
+	}, nil
+}
+
+// addonHelmKustomization renders the Kustomization that installs a helm addon
+// from the HelmRelease template in the platform repo. HelmReleases can only
+// depend on other HelmReleases, while the Kustomization can also wait on the
+// built-in Kustomizations.
+func addonHelmKustomization(pathPrefix string, addon config.AddonConfig) map[string]interface{} {
+	substitute := map[string]interface{}{
+		"ADDON_NAME":      addon.Name,
+		"ADDON_NAMESPACE": defaultString(addon.Namespace, addon.Name),
+		"ADDON_CHART":     addon.Chart,
+	}
+	if addon.Version != "" {
+		substitute["ADDON_VERSION"] = addon.Version
+	}
+	spec := map[string]interface{}{
+		"interval":  "10m",
+		"path":      fluxRepoPath(pathPrefix, addonHelmReleasePath),
+		"prune":     true,
+		"wait":      true,
+		"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": "flux-system"},
+		"postBuild": map[string]interface{}{"substitute": substitute},
+	}
+	if len(addon.DependsOn) > 0 {
+		spec["dependsOn"] = addonDependencies(addon.DependsOn)
+	}
+	return map[string]interface{}{
+		"apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+		"kind":       "Kustomization",
+		"metadata":   addonMetadata(addon),
+		"spec":       spec,
+	}
+}
+
+func addonDependencies(names []string) []interface{} {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	dependencies := make([]interface{}, 0, len(sorted))
+	for _, name := range sorted {
+		dependencies = append(dependencies, map[string]interface{}{"name": name})
+	}
+	return dependencies
+}
+
+func readyConditionMessage(object map[string]interface{}) string {
+	status, _ := object["status"].(map[string]interface{})
+	conditions, _ := status["conditions"].([]interface{})
+	for _, entry := range conditions {
+		condition, ok := entry.(map[string]interface{})
+		if ok && condition["type"] == "Ready" {
+			return fmt.Sprint(condition["message"])
+		}
+	}
+	return "not reconciled yet"
+}
+
+func defaultString(value, fallback string) string {
+	if strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return value
+}
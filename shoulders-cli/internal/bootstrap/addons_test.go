@@ -0,0 +1,102 @@
+package bootstrap
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+)
+
+func TestFluxAddonsManifestRendersSourcesAndDependencies(t *testing.T) {
+	addons := []config.AddonConfig{
+		{
+			Name:      "cert-manager",
+			Source:    config.AddonSource{Type: config.AddonSourceHelm, URL: "https://charts.jetstack.io"},
+			Chart:     "cert-manager",
+			Version:   "v1.18.2",
+			Values:    map[string]interface{}{"crds": map[string]interface{}{"enabled": true}},
+			DependsOn: []string{"helm-releases"},
+		},
+		{
+			Name:      "internal",
+			Source:    config.AddonSource{Type: config.AddonSourceOCI, URL: "oci://ghcr.io/acme/internal", Ref: "1.0.0"},
+			Path:      "./deploy",
+			Namespace: "internal",
+			Values:    map[string]interface{}{"REPLICAS": float64(2)},
+			DependsOn: []string{"cert-manager", "helm-releases"},
+		},
+	}
+
+	manifest, err := fluxAddonsManifest("", addons)
+	if err != nil {
+		t.Fatalf("render addons: %v", err)
+	}
+	rendered := string(manifest)
+	assertYAMLDocuments(t, rendered)
+
+	for _, want := range []string{
+		"kind: HelmRepository",
+		"kind: ConfigMap",
+		"name: cert-manager-values",
+		"path: ./2-addons/manifests/addon-helm-release",
+		"ADDON_CHART: cert-manager",
+		"ADDON_VERSION: v1.18.2",
+		"ADDON_NAMESPACE: cert-manager",
+		"kind: OCIRepository",
+		"tag: 1.0.0",
+		"path: ./deploy",
+		"REPLICAS: \"2\"",
+		"shoulders.io/addon: internal",
+	} {
+		if !strings.Contains(rendered, want) {
+			t.Fatalf("expected addons manifest to contain %q\n%s", want, rendered)
+		}
+	}
+
+	documents := map[string]map[string]interface{}{}
+	for _, document := range strings.Split(rendered, "---\n") {
+		object := parseYAML(t, []byte(document))
+		metadata, _ := object["metadata"].(map[string]interface{})
+		documents[fmt.Sprintf("%s/%s", object["kind"], metadata["name"])] = object
+	}
+	dependsOn := func(name string) []interface{} {
+		spec, _ := documents["Kustomization/"+name]["spec"].(map[string]interface{})
+		dependencies, _ := spec["dependsOn"].([]interface{})
+		return dependencies
+	}
+
+	// The helm addon waits on the built-in helm-releases Kustomization.
+	if got, want := dependsOn("cert-manager"), []interface{}{map[string]interface{}{"name": "helm-releases"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected cert-manager to depend on %v, got %v", want, got)
+	}
+	if got := dependsOn("internal"); len(got) != 2 {
+		t.Fatalf("expected internal to depend on cert-manager and helm-releases, got %v", got)
+	}
+	values, _ := documents["ConfigMap/cert-manager-values"]["data"].(map[string]interface{})
+	if values["values.yaml"] != "crds:\n  enabled: true\n" {
+		t.Fatalf("unexpected cert-manager values %q", values["values.yaml"])
+	}
+}
+
+func TestFluxAddonsManifestUsesPathPrefix(t *testing.T) {
+	addons := []config.AddonConfig{{
+		Name:   "podinfo",
+		Source: config.AddonSource{Type: config.AddonSourceHelm, URL: "oci://ghcr.io/stefanprodan/charts"},
+		Chart:  "podinfo",
+	}}
+	manifest, err := fluxAddonsManifest("./platform", addons)
+	if err != nil {
+		t.Fatalf("render addons: %v", err)
+	}
+	rendered := string(manifest)
+	for _, want := range []string{"path: ./platform/2-addons/manifests/addon-helm-release", "ADDON_NAMESPACE: podinfo", "values.yaml: |"} {
+		if !strings.Contains(rendered, want) {
+			t.Fatalf("expected addons manifest to contain %q\n%s", want, rendered)
+		}
+	}
+	if strings.Contains(rendered, "ADDON_VERSION") {
+		t.Fatalf("expected an unpinned chart to leave ADDON_VERSION to the template default\n%s", rendered)
+	}
+}
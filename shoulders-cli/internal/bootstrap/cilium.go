@@ -31,8 +31,7 @@ type CiliumOptions struct {
 	EnableObservability bool
 }
 
-func CiliumOptionsForProfile(profile string) CiliumOptions {
-	spec := config.ProfileSpecFor(profile)
+func CiliumOptionsForProfile(spec config.ProfileSpec) CiliumOptions {
 	return CiliumOptions{
 		EnableHubble:        spec.HubbleUI,
 		EnableObservability: spec.CiliumObservability,
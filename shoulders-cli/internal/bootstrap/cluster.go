@@ -16,6 +16,7 @@ import (
 	vclusterconfig "github.com/loft-sh/vcluster/pkg/cli/config"
 	"github.com/loft-sh/vcluster/pkg/cli/flags"
 	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -38,7 +39,7 @@ const (
 // not already exist. vindConfig is an optional base vCluster values YAML and
 // authConfig is an optional API server auth config that is mounted into the
 // control-plane container before bootstrap.
-func EnsureVindCluster(ctx context.Context, name string, vindConfig, authConfig []byte, dexHost string) (err error) {
+func EnsureVindCluster(ctx context.Context, name string, vindConfig, authConfig []byte, dexHost string) error {
 	exists, err := containerExists(ctx, controlPlanePrefix+name)
 	if err != nil {
 		return fmt.Errorf("check if cluster already exists: %w", err)
@@ -46,7 +47,52 @@ func EnsureVindCluster(ctx context.Context, name string, vindConfig, authConfig
 	if exists {
 		return nil
 	}
+	return createVindCluster(ctx, name, vindConfig, authConfig, dexHost, false)
+}
+
+// ResizeVindCluster re-runs the vind create in upgrade mode so the worker
+// containers match vindConfig. The API server auth config written when the
+// cluster was created is reused.
+func ResizeVindCluster(ctx context.Context, name string, vindConfig []byte, dexHost string) error {
+	configPath, err := vclusterconfig.DefaultFilePath()
+	if err != nil {
+		return fmt.Errorf("determine vcluster config path: %w", err)
+	}
+	authConfig, err := os.ReadFile(clusterAuthConfigHostPath(configPath, name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read auth config: %w", err)
+	}
+	return createVindCluster(ctx, name, vindConfig, authConfig, dexHost, true)
+}
+
+// VindWorkerCount returns the number of worker containers of a vind cluster.
+func VindWorkerCount(ctx context.Context, name string) (int, error) {
+	workers, err := listContainerNames(ctx, "vcluster.node."+name+".")
+	if err != nil {
+		return 0, fmt.Errorf("list worker containers: %w", err)
+	}
+	return len(workers), nil
+}
+
+// VindConfigWorkerCount returns the number of worker nodes declared in a
+// vind values file.
+func VindConfigWorkerCount(vindConfig []byte) (int, error) {
+	var values struct {
+		Experimental struct {
+			Docker struct {
+				Nodes []struct {
+					Name string `json:"name"`
+				} `json:"nodes"`
+			} `json:"docker"`
+		} `json:"experimental"`
+	}
+	if err := yaml.Unmarshal(vindConfig, &values); err != nil {
+		return 0, fmt.Errorf("parse vind values: %w", err)
+	}
+	return len(values.Experimental.Docker.Nodes), nil
+}
 
+func createVindCluster(ctx context.Context, name string, vindConfig, authConfig []byte, dexHost string, upgrade bool) (err error) {
 	// The vCluster OCI library reads Docker's credential store when pulling
 	// images from ghcr.io. A stale empty auth entry (e.g. from a previous
 	// "docker login ghcr.io" that was never completed) causes the library to
@@ -71,6 +117,7 @@ func EnsureVindCluster(ctx context.Context, name string, vindConfig, authConfig
 		ChartVersion:  VindVersion,
 		Connect:       true,
 		UpdateCurrent: true,
+		Upgrade:       upgrade,
 	}
 
 	if len(vindConfig) > 0 || len(authConfig) > 0 {
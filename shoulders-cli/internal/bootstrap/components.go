@@ -0,0 +1,207 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+)
+
+// fluxPatch is an inline Kustomize patch applied by a Flux Kustomization.
+type fluxPatch struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Patch     string
+}
+
+// componentResource is a base manifest object owned by an optional platform
+// component, keyed by the Flux Kustomization that reconciles it.
+type componentResource struct {
+	Kustomization string
+	APIVersion    string
+	Kind          string
+	Name          string
+	Namespace     string
+}
+
+func helmRepositoryResource(name string) componentResource {
+	return componentResource{Kustomization: "helm-repositories", APIVersion: "source.toolkit.fluxcd.io/v1", Kind: "HelmRepository", Name: name, Namespace: "flux-system"}
+}
+
+func namespaceResource(name string) componentResource {
+	return componentResource{Kustomization: "namespaces", APIVersion: "v1", Kind: "Namespace", Name: name}
+}
+
+func helmReleaseResource(namespace, name string) componentResource {
+	return componentResource{Kustomization: "helm-releases", APIVersion: "helm.toolkit.fluxcd.io/v2", Kind: "HelmRelease", Name: name, Namespace: namespace}
+}
+
+func httpRouteResource(namespace, name string) componentResource {
+	return componentResource{Kustomization: "gateway", APIVersion: "gateway.networking.k8s.io/v1", Kind: "HTTPRoute", Name: name, Namespace: namespace}
+}
+
+// disabledComponentResources mirrors the deletions in 2-addons/profiles/small
+// but derives them from the individual component switches.
+func disabledComponentResources(profile config.ProfileSpec) []componentResource {
+	resources := []componentResource{}
+	if !profile.EventStreams {
+		resources = append(resources,
+			helmRepositoryResource("strimzi"),
+			namespaceResource("kafka"),
+			namespaceResource("strimzi-system"),
+			helmReleaseResource("strimzi-system", "strimzi"),
+			componentResource{Kustomization: "crossplane", APIVersion: "apiextensions.crossplane.io/v1", Kind: "Composition", Name: "event-stream-composition"},
+			componentResource{Kustomization: "crossplane", APIVersion: "apiextensions.crossplane.io/v2", Kind: "CompositeResourceDefinition", Name: "eventstreams.shoulders.io"},
+		)
+	}
+	if !profile.PolicyReporter {
+		resources = append(resources,
+			helmRepositoryResource("policy-reporter"),
+			namespaceResource("policy-reporter"),
+			helmReleaseResource("policy-reporter", "policy-reporter"),
+			httpRouteResource("policy-reporter", "policy-reporter"),
+		)
+	}
+	if !profile.Trivy {
+		resources = append(resources,
+			helmRepositoryResource("trivy-operator"),
+			namespaceResource("trivy-system"),
+			helmReleaseResource("trivy-system", "trivy-operator"),
+		)
+	}
+	// The adapter feeds Trivy reports into Policy Reporter and needs both.
+	if !profile.Trivy || !profile.PolicyReporter {
+		resources = append(resources,
+			helmRepositoryResource("trivy-operator-polr-adapter"),
+			helmReleaseResource("trivy-system", "trivy-operator-polr-adapter"),
+		)
+	}
+	if !profile.Falco {
+		resources = append(resources,
+			helmRepositoryResource("falcosecurity"),
+			namespaceResource("falco"),
+			helmReleaseResource("falco", "falco"),
+		)
+	}
+	if !profile.HubbleUI {
+		resources = append(resources, httpRouteResource("kube-system", "hubble-ui"))
+	}
+	if !profile.LogTracePipeline {
+		resources = append(resources,
+			helmReleaseResource("observability", "alloy"),
+			helmReleaseResource("observability", "loki"),
+			helmReleaseResource("observability", "tempo"),
+		)
+	}
+	return resources
+}
+
+// customProfileKustomizations reconciles the base manifests and expresses the
+// custom component selection as inline patches, so no overlay directory is
+// needed per combination.
+func customProfileKustomizations(items []fluxKustomization, profile config.ProfileSpec) []fluxKustomization {
+	patches := map[string][]fluxPatch{}
+	for _, resource := range disabledComponentResources(profile) {
+		patches[resource.Kustomization] = append(patches[resource.Kustomization], fluxPatch{
+			Kind:      resource.Kind,
+			Name:      resource.Name,
+			Namespace: resource.Namespace,
+			Patch:     deletePatch(resource),
+		})
+	}
+	patches["helm-releases"] = append(patches["helm-releases"], fluxPatch{
+		Kind:      "HelmRelease",
+		Name:      "kube-prometheus-stack",
+		Namespace: "observability",
+		Patch:     prometheusStackPatch(profile),
+	})
+	for kustomization, basePatches := range baseProfilePatches(profile.Base) {
+		patches[kustomization] = append(patches[kustomization], basePatches...)
+	}
+
+	result := make([]fluxKustomization, 0, len(items))
+	for _, item := range items {
+		switch item.Name {
+		case "policy-reporter":
+			if !profile.PolicyReporter {
+				continue
+			}
+		case "trivy-dashboard":
+			if !profile.Trivy {
+				continue
+			}
+		}
+		item.Patches = patches[item.Name]
+		result = append(result, item)
+	}
+	return result
+}
+
+// baseProfilePatches returns the value patches the overlay of a built-in
+// profile applies on top of its deletions, so a custom profile keeps the
+// tuning of its base.
+func baseProfilePatches(base string) map[string][]fluxPatch {
+	if base != config.ProfileSmall {
+		return nil
+	}
+	return map[string][]fluxPatch{
+		"helm-releases": {{Kind: "HelmRelease", Name: "kyverno", Namespace: "kyverno", Patch: smallKyvernoPatch}},
+	}
+}
+
+// smallKyvernoPatch mirrors 2-addons/profiles/small/helm-releases/kyverno.yaml:
+// no ServiceMonitors or Grafana dashboards and hourly background scans.
+const smallKyvernoPatch = `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: kyverno
+  namespace: kyverno
+spec:
+  values:
+    admissionController:
+      serviceMonitor:
+        enabled: false
+    backgroundController:
+      serviceMonitor:
+        enabled: false
+    cleanupController:
+      serviceMonitor:
+        enabled: false
+    reportsController:
+      serviceMonitor:
+        enabled: false
+    features:
+      backgroundScan:
+        backgroundScanInterval: 1h
+    grafana:
+      enabled: false
+`
+
+func deletePatch(resource componentResource) string {
+	metadata := fmt.Sprintf("metadata:\n  name: %s\n", resource.Name)
+	if resource.Namespace != "" {
+		metadata += fmt.Sprintf("  namespace: %s\n", resource.Namespace)
+	}
+	return fmt.Sprintf("apiVersion: %s\nkind: %s\n%s$patch: delete\n", resource.APIVersion, resource.Kind, metadata)
+}
+
+// prometheusStackPatch wires retention to the platform config substitutions
+// and drops the Loki/Tempo data sources when the pipeline is disabled.
+func prometheusStackPatch(profile config.ProfileSpec) string {
+	patch := "apiVersion: helm.toolkit.fluxcd.io/v2\n" +
+		"kind: HelmRelease\n" +
+		"metadata:\n" +
+		"  name: kube-prometheus-stack\n" +
+		"  namespace: observability\n" +
+		"spec:\n" +
+		"  values:\n"
+	if !profile.LogTracePipeline {
+		patch += "    grafana:\n" +
+			"      additionalDataSources: []\n"
+	}
+	return patch +
+		"    prometheus:\n" +
+		"      prometheusSpec:\n" +
+		"        retention: ${SHOULDERS_PROMETHEUS_RETENTION}\n" +
+		"        retentionSize: ${SHOULDERS_PROMETHEUS_RETENTION_SIZE}\n"
+}
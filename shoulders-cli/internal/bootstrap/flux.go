@@ -6,17 +6,20 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
 	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/sops"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
-const fluxInstallURL = "https://github.com/fluxcd/flux2/releases/download/v2.8.3/install.yaml"
+const fluxInstallURLFormat = "https://github.com/fluxcd/flux2/releases/download/%s/install.yaml"
 
 const fluxPlatformConfigName = "shoulders-platform-config"
 
@@ -26,14 +29,23 @@ var fluxKustomizationGVR = schema.GroupVersionResource{
 	Resource: "kustomizations",
 }
 
-func EnsureFlux(ctx context.Context, kubeconfigPath, repoURL, branch, pathPrefix, profile string, publicConfig PublicDomainConfig) error {
-	manifest, err := downloadFluxManifest(ctx)
+var fluxGitRepositoryGVR = schema.GroupVersionResource{
+	Group:    "source.toolkit.fluxcd.io",
+	Version:  "v1",
+	Resource: "gitrepositories",
+}
+
+func EnsureFlux(ctx context.Context, kubeconfigPath, version, repoURL, branch, pathPrefix string, profile config.ProfileSpec, publicConfig PublicDomainConfig, addons []config.AddonConfig) error {
+	manifest, err := downloadFluxManifest(ctx, version)
 	if err != nil {
 		return err
 	}
 	if err := kube.ApplyManifest(ctx, kubeconfigPath, manifest, ""); err != nil {
 		return fmt.Errorf("apply flux install manifest: %w", err)
 	}
+	if err := EnsureSOPSAgeSecret(ctx, kubeconfigPath); err != nil {
+		return err
+	}
 	if err := kube.ApplyManifest(ctx, kubeconfigPath, fluxPlatformConfigManifest(profile, publicConfig), "flux-system"); err != nil {
 		return fmt.Errorf("apply flux platform config: %w", err)
 	}
@@ -43,7 +55,7 @@ func EnsureFlux(ctx context.Context, kubeconfigPath, repoURL, branch, pathPrefix
 	if err := kube.ApplyManifest(ctx, kubeconfigPath, fluxKustomizationsManifest(pathPrefix, profile), "flux-system"); err != nil {
 		return fmt.Errorf("apply flux config: %w", err)
 	}
-	return nil
+	return ApplyAddons(ctx, kubeconfigPath, pathPrefix, addons)
 }
 
 func UninstallShouldersFlux(ctx context.Context, kubeconfigPath, pathPrefix string) error {
@@ -55,15 +67,18 @@ func UninstallShouldersFlux(ctx context.Context, kubeconfigPath, pathPrefix stri
 		return nil
 	}
 
+	if err := deleteAddons(ctx, kubeconfigPath, nil); err != nil {
+		return err
+	}
 	for _, profile := range []string{config.ProfileSmall, config.ProfileMedium, config.ProfileLarge} {
-		if err := kube.DeleteManifest(ctx, kubeconfigPath, fluxKustomizationsManifest(pathPrefix, profile), "flux-system"); err != nil {
+		if err := kube.DeleteManifest(ctx, kubeconfigPath, fluxKustomizationsManifest(pathPrefix, config.ProfileSpecFor(profile)), "flux-system"); err != nil {
 			return fmt.Errorf("delete flux kustomizations for profile %s: %w", profile, err)
 		}
 	}
 	if err := waitForFluxKustomizationsDeleted(ctx, kubeconfigPath); err != nil {
 		return err
 	}
-	if err := kube.DeleteManifest(ctx, kubeconfigPath, fluxPlatformConfigManifest(config.ProfileMedium, PublicDomainConfig{}), "flux-system"); err != nil {
+	if err := kube.DeleteManifest(ctx, kubeconfigPath, fluxPlatformConfigManifest(config.ProfileSpecFor(config.ProfileMedium), PublicDomainConfig{}), "flux-system"); err != nil {
 		return fmt.Errorf("delete flux platform config: %w", err)
 	}
 	if err := kube.DeleteManifest(ctx, kubeconfigPath, fluxGitRepositoryManifest("", ""), "flux-system"); err != nil {
@@ -72,6 +87,30 @@ func UninstallShouldersFlux(ctx context.Context, kubeconfigPath, pathPrefix stri
 	return nil
 }
 
+// InstalledFluxSource returns the URL and branch the flux-system
+// GitRepository currently tracks.
+func InstalledFluxSource(ctx context.Context, kubeconfigPath string) (string, string, error) {
+	client, err := kube.NewDynamicClient(kubeconfigPath)
+	if err != nil {
+		return "", "", fmt.Errorf("create dynamic client: %w", err)
+	}
+	repository, err := client.Resource(fluxGitRepositoryGVR).Namespace("flux-system").Get(ctx, "flux-system", metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("get flux git repository: %w", err)
+	}
+	url, _, _ := unstructured.NestedString(repository.Object, "spec", "url")
+	branch, _, _ := unstructured.NestedString(repository.Object, "spec", "ref", "branch")
+	return url, branch, nil
+}
+
+// UpdateFluxSource points the flux-system GitRepository at repoURL and branch.
+func UpdateFluxSource(ctx context.Context, kubeconfigPath, repoURL, branch string) error {
+	if err := kube.ApplyManifest(ctx, kubeconfigPath, fluxGitRepositoryManifest(repoURL, branch), "flux-system"); err != nil {
+		return fmt.Errorf("apply flux git repository: %w", err)
+	}
+	return nil
+}
+
 func fluxAPIsInstalled(kubeconfigPath string) (bool, error) {
 	discoveryClient, err := kube.NewDiscoveryClient(kubeconfigPath)
 	if err != nil {
@@ -111,7 +150,7 @@ spec:
 `, repoURL, branch))
 }
 
-func fluxKustomizationsManifest(pathPrefix, profile string) []byte {
+func fluxKustomizationsManifest(pathPrefix string, profile config.ProfileSpec) []byte {
 	items := fluxKustomizationsForProfile(pathPrefix, profile)
 
 	var builder strings.Builder
@@ -134,6 +173,12 @@ func fluxKustomizationsManifest(pathPrefix, profile string) []byte {
 		builder.WriteString("  sourceRef:\n")
 		builder.WriteString("    kind: GitRepository\n")
 		builder.WriteString("    name: flux-system\n")
+		if item.Decrypt {
+			builder.WriteString("  decryption:\n")
+			builder.WriteString("    provider: sops\n")
+			builder.WriteString("    secretRef:\n")
+			fmt.Fprintf(&builder, "      name: %s\n", sops.SecretName)
+		}
 		if item.Substitute {
 			builder.WriteString("  postBuild:\n")
 			builder.WriteString("    substituteFrom:\n")
@@ -146,11 +191,24 @@ func fluxKustomizationsManifest(pathPrefix, profile string) []byte {
 				fmt.Fprintf(&builder, "    - name: %s\n", dependency)
 			}
 		}
+		if len(item.Patches) > 0 {
+			builder.WriteString("  patches:\n")
+			for _, patch := range item.Patches {
+				builder.WriteString("    - target:\n")
+				fmt.Fprintf(&builder, "        kind: %s\n", patch.Kind)
+				fmt.Fprintf(&builder, "        name: %s\n", patch.Name)
+				if patch.Namespace != "" {
+					fmt.Fprintf(&builder, "        namespace: %s\n", patch.Namespace)
+				}
+				builder.WriteString("      patch: |\n")
+				builder.WriteString(indentBlock(strings.TrimRight(patch.Patch, "\n"), 8) + "\n")
+			}
+		}
 	}
 	return []byte(builder.String())
 }
 
-func fluxKustomizationsForProfile(pathPrefix, profile string) []fluxKustomization {
+func fluxKustomizationsForProfile(pathPrefix string, profile config.ProfileSpec) []fluxKustomization {
 	path := func(relativePath string) string {
 		return fluxRepoPath(pathPrefix, relativePath)
 	}
@@ -165,16 +223,19 @@ func fluxKustomizationsForProfile(pathPrefix, profile string) []fluxKustomizatio
 		{Name: "gateway", Path: path("2-addons/manifests/gateway"), Substitute: true, DependsOn: []string{"namespaces"}},
 		{Name: "policy-reporter", Path: path("2-addons/manifests/policy-reporter"), DependsOn: []string{"helm-releases"}},
 		{Name: "trivy-dashboard", Path: path("2-addons/manifests/trivy-dashboard"), DependsOn: []string{"helm-releases"}},
+		{Name: "user-secrets", Path: path("3-user-space/secrets"), Decrypt: true, DependsOn: []string{"crossplane"}},
 	}
 
-	switch config.ProfileSpecFor(profile).Name {
+	switch profile.Name {
+	case config.ProfileCustom:
+		return customProfileKustomizations(items, profile)
 	case config.ProfileSmall:
 		items[0].Path = path("2-addons/profiles/small/helm-repositories")
 		items[1].Path = path("2-addons/profiles/small/namespaces")
 		items[4].Path = path("2-addons/profiles/small/helm-releases")
 		items[5].Path = path("2-addons/profiles/small/crossplane")
 		items[6].Path = path("2-addons/profiles/small/gateway")
-		return []fluxKustomization{items[0], items[1], items[2], items[3], items[4], items[5], items[6]}
+		return []fluxKustomization{items[0], items[1], items[2], items[3], items[4], items[5], items[6], items[9]}
 	case config.ProfileLarge:
 		items[4].Path = path("2-addons/profiles/large/helm-releases")
 	}
@@ -200,28 +261,25 @@ type fluxKustomization struct {
 	DependsOn  []string
 	Wait       bool
 	Substitute bool
+	Decrypt    bool
+	Patches    []fluxPatch
 }
 
-func fluxPlatformConfigManifest(profile string, publicConfig PublicDomainConfig) []byte {
-	profileSpec := config.ProfileSpecFor(profile)
+func fluxPlatformConfigManifest(profileSpec config.ProfileSpec, publicConfig PublicDomainConfig) []byte {
 	values := map[string]string{
-		"SHOULDERS_DEX_HOST":                  publicConfig.DexHost,
-		"SHOULDERS_GRAFANA_HOST":              publicConfig.GrafanaHost,
-		"SHOULDERS_HEADLAMP_HOST":             publicConfig.HeadlampHost,
-		"SHOULDERS_REPORTER_HOST":             publicConfig.ReporterHost,
-		"SHOULDERS_PROMETHEUS_HOST":           publicConfig.PrometheusHost,
-		"SHOULDERS_ALERTMANAGER_HOST":         publicConfig.AlertmanagerHost,
-		"SHOULDERS_HUBBLE_HOST":               publicConfig.HubbleHost,
-		"SHOULDERS_PROFILE":                   profileSpec.Name,
-		"SHOULDERS_POSTGRES_INSTANCES":        fmt.Sprintf("%d", profileSpec.PostgresInstances),
-		"SHOULDERS_KAFKA_REPLICAS":            fmt.Sprintf("%d", profileSpec.KafkaReplicas),
-		"SHOULDERS_KAFKA_MIN_ISR":             fmt.Sprintf("%d", profileSpec.KafkaMinISR),
-		"SHOULDERS_KAFKA_STORAGE":             profileSpec.KafkaStorage,
-		"SHOULDERS_PROMETHEUS_RETENTION":      profileSpec.PrometheusRetention,
-		"SHOULDERS_PROMETHEUS_RETENTION_SIZE": profileSpec.PrometheusSize,
-		"SHOULDERS_DEX_TLS_CERT_B64":          base64.StdEncoding.EncodeToString([]byte(publicConfig.TLS.CertPEM)),
-		"SHOULDERS_DEX_TLS_KEY_B64":           base64.StdEncoding.EncodeToString([]byte(publicConfig.TLS.KeyPEM)),
-		"SHOULDERS_DEX_CA_CERT_B64":           base64.StdEncoding.EncodeToString([]byte(publicConfig.TLS.CAPEM)),
+		"SHOULDERS_DEX_HOST":          publicConfig.DexHost,
+		"SHOULDERS_GRAFANA_HOST":      publicConfig.GrafanaHost,
+		"SHOULDERS_HEADLAMP_HOST":     publicConfig.HeadlampHost,
+		"SHOULDERS_REPORTER_HOST":     publicConfig.ReporterHost,
+		"SHOULDERS_PROMETHEUS_HOST":   publicConfig.PrometheusHost,
+		"SHOULDERS_ALERTMANAGER_HOST": publicConfig.AlertmanagerHost,
+		"SHOULDERS_HUBBLE_HOST":       publicConfig.HubbleHost,
+		"SHOULDERS_DEX_TLS_CERT_B64":  base64.StdEncoding.EncodeToString([]byte(publicConfig.TLS.CertPEM)),
+		"SHOULDERS_DEX_TLS_KEY_B64":   base64.StdEncoding.EncodeToString([]byte(publicConfig.TLS.KeyPEM)),
+		"SHOULDERS_DEX_CA_CERT_B64":   base64.StdEncoding.EncodeToString([]byte(publicConfig.TLS.CAPEM)),
+	}
+	for key, value := range profileConfigValues(profileSpec) {
+		values[key] = value
 	}
 	keys := []string{
 		"SHOULDERS_DEX_HOST",
@@ -231,17 +289,13 @@ func fluxPlatformConfigManifest(profile string, publicConfig PublicDomainConfig)
 		"SHOULDERS_PROMETHEUS_HOST",
 		"SHOULDERS_ALERTMANAGER_HOST",
 		"SHOULDERS_HUBBLE_HOST",
-		"SHOULDERS_PROFILE",
-		"SHOULDERS_POSTGRES_INSTANCES",
-		"SHOULDERS_KAFKA_REPLICAS",
-		"SHOULDERS_KAFKA_MIN_ISR",
-		"SHOULDERS_KAFKA_STORAGE",
-		"SHOULDERS_PROMETHEUS_RETENTION",
-		"SHOULDERS_PROMETHEUS_RETENTION_SIZE",
+	}
+	keys = append(keys, profileConfigKeys...)
+	keys = append(keys,
 		"SHOULDERS_DEX_TLS_CERT_B64",
 		"SHOULDERS_DEX_TLS_KEY_B64",
 		"SHOULDERS_DEX_CA_CERT_B64",
-	}
+	)
 
 	var builder strings.Builder
 	builder.WriteString("apiVersion: v1\n")
@@ -256,6 +310,46 @@ func fluxPlatformConfigManifest(profile string, publicConfig PublicDomainConfig)
 	return []byte(builder.String())
 }
 
+// profileConfigKeys are the platform config entries derived from the profile.
+// They are also read back by InstalledProfileSpec.
+var profileConfigKeys = []string{
+	"SHOULDERS_PROFILE",
+	"SHOULDERS_PROFILE_BASE",
+	"SHOULDERS_EVENT_STREAMS",
+	"SHOULDERS_POLICY_REPORTER",
+	"SHOULDERS_TRIVY",
+	"SHOULDERS_FALCO",
+	"SHOULDERS_HUBBLE_UI",
+	"SHOULDERS_LOG_TRACE_PIPELINE",
+	"SHOULDERS_CILIUM_OBSERVABILITY",
+	"SHOULDERS_POSTGRES_INSTANCES",
+	"SHOULDERS_KAFKA_REPLICAS",
+	"SHOULDERS_KAFKA_MIN_ISR",
+	"SHOULDERS_KAFKA_STORAGE",
+	"SHOULDERS_PROMETHEUS_RETENTION",
+	"SHOULDERS_PROMETHEUS_RETENTION_SIZE",
+}
+
+func profileConfigValues(profileSpec config.ProfileSpec) map[string]string {
+	return map[string]string{
+		"SHOULDERS_PROFILE":                   profileSpec.Name,
+		"SHOULDERS_PROFILE_BASE":              profileSpec.Base,
+		"SHOULDERS_EVENT_STREAMS":             strconv.FormatBool(profileSpec.EventStreams),
+		"SHOULDERS_POLICY_REPORTER":           strconv.FormatBool(profileSpec.PolicyReporter),
+		"SHOULDERS_TRIVY":                     strconv.FormatBool(profileSpec.Trivy),
+		"SHOULDERS_FALCO":                     strconv.FormatBool(profileSpec.Falco),
+		"SHOULDERS_HUBBLE_UI":                 strconv.FormatBool(profileSpec.HubbleUI),
+		"SHOULDERS_LOG_TRACE_PIPELINE":        strconv.FormatBool(profileSpec.LogTracePipeline),
+		"SHOULDERS_CILIUM_OBSERVABILITY":      strconv.FormatBool(profileSpec.CiliumObservability),
+		"SHOULDERS_POSTGRES_INSTANCES":        fmt.Sprintf("%d", profileSpec.PostgresInstances),
+		"SHOULDERS_KAFKA_REPLICAS":            fmt.Sprintf("%d", profileSpec.KafkaReplicas),
+		"SHOULDERS_KAFKA_MIN_ISR":             fmt.Sprintf("%d", profileSpec.KafkaMinISR),
+		"SHOULDERS_KAFKA_STORAGE":             profileSpec.KafkaStorage,
+		"SHOULDERS_PROMETHEUS_RETENTION":      profileSpec.PrometheusRetention,
+		"SHOULDERS_PROMETHEUS_RETENTION_SIZE": profileSpec.PrometheusSize,
+	}
+}
+
 func waitForFluxKustomizationsDeleted(ctx context.Context, kubeconfigPath string) error {
 	client, err := kube.NewDynamicClient(kubeconfigPath)
 	if err != nil {
@@ -263,7 +357,7 @@ func waitForFluxKustomizationsDeleted(ctx context.Context, kubeconfigPath string
 	}
 
 	return wait.PollUntilContextTimeout(ctx, 2*time.Second, 5*time.Minute, true, func(ctx context.Context) (bool, error) {
-		for _, name := range []string{"helm-repositories", "namespaces", "crds", "helm-releases", "crossplane", "gateway", "policy-reporter", "trivy-dashboard", "headlamp"} {
+		for _, name := range []string{"helm-repositories", "namespaces", "crds", "helm-releases", "crossplane", "gateway", "policy-reporter", "trivy-dashboard", "headlamp", "user-secrets"} {
 			if _, err := client.Resource(fluxKustomizationGVR).Namespace("flux-system").Get(ctx, name, metav1.GetOptions{}); err == nil {
 				return false, nil
 			}
@@ -272,8 +366,15 @@ func waitForFluxKustomizationsDeleted(ctx context.Context, kubeconfigPath string
 	})
 }
 
-func downloadFluxManifest(ctx context.Context) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fluxInstallURL, nil)
+func fluxInstallURL(version string) string {
+	if version == "" {
+		version = config.DefaultFluxVersion
+	}
+	return fmt.Sprintf(fluxInstallURLFormat, "v"+strings.TrimPrefix(version, "v"))
+}
+
+func downloadFluxManifest(ctx context.Context, version string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fluxInstallURL(version), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -285,7 +386,7 @@ func downloadFluxManifest(ctx context.Context) ([]byte, error) {
 		_ = resp.Body.Close()
 	}()
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("failed to download flux install manifest: %s", resp.Status)
+		return nil, fmt.Errorf("failed to download flux %s install manifest: %s", version, resp.Status)
 	}
 	return io.ReadAll(resp.Body)
 }
@@ -1,6 +1,9 @@
 package bootstrap
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -27,6 +30,9 @@ func TestFluxKustomizationsManifestMediumKeepsCurrentPaths(t *testing.T) {
 		t.Fatalf("expected crossplane kustomization to use postBuild substitution\n%s", manifest)
 	}
 	assertBefore(t, manifest, "name: headlamp", "name: helm-releases")
+	if !strings.Contains(manifest, "path: ./3-user-space/secrets\n  prune: true\n  sourceRef:\n    kind: GitRepository\n    name: flux-system\n  decryption:\n    provider: sops\n    secretRef:\n      name: sops-age\n") {
+		t.Fatalf("expected user-secrets to decrypt with the sops-age key\n%s", manifest)
+	}
 }
 
 func TestFluxKustomizationsManifestSmallUsesCorePaths(t *testing.T) {
@@ -65,7 +71,7 @@ func TestFluxKustomizationsManifestLargeUsesLargeHelmReleases(t *testing.T) {
 
 func renderFluxKustomizationsManifest(t *testing.T, profile string) string {
 	t.Helper()
-	return string(fluxKustomizationsManifest(".", profile))
+	return string(fluxKustomizationsManifest(".", config.ProfileSpecFor(profile)))
 }
 
 func assertYAMLDocuments(t *testing.T, manifest string) {
@@ -88,7 +94,7 @@ func assertBefore(t *testing.T, text, first, second string) {
 }
 
 func TestFluxPlatformConfigManifestIncludesProfileDefaults(t *testing.T) {
-	manifest := string(fluxPlatformConfigManifest(config.ProfileSmall, PublicDomainConfig{}))
+	manifest := string(fluxPlatformConfigManifest(config.ProfileSpecFor(config.ProfileSmall), PublicDomainConfig{}))
 	var parsed map[string]interface{}
 	if err := yaml.Unmarshal([]byte(manifest), &parsed); err != nil {
 		t.Fatalf("platform config manifest should be valid YAML: %v\n%s", err, manifest)
@@ -106,3 +112,104 @@ func TestFluxPlatformConfigManifestIncludesProfileDefaults(t *testing.T) {
 		}
 	}
 }
+
+func TestFluxKustomizationsManifestCustomGeneratesComponentPatches(t *testing.T) {
+	disabled := false
+	profile := config.ComponentsConfig{Falco: &disabled, Trivy: &disabled, LogTracePipeline: &disabled}.Spec()
+	manifest := string(fluxKustomizationsManifest(".", profile))
+	assertYAMLDocuments(t, manifest)
+
+	for _, want := range []string{
+		"path: ./2-addons/manifests/helm-releases",
+		"path: ./2-addons/manifests/namespaces",
+		"name: policy-reporter",
+		"kind: HelmRelease\n        name: falco\n        namespace: falco",
+		"kind: Namespace\n        name: trivy-system",
+		"kind: HelmRelease\n        name: trivy-operator-polr-adapter",
+		"kind: HelmRelease\n        name: loki",
+		"additionalDataSources: []",
+		"retention: ${SHOULDERS_PROMETHEUS_RETENTION}",
+	} {
+		if !strings.Contains(manifest, want) {
+			t.Fatalf("expected custom manifest to contain %q\n%s", want, manifest)
+		}
+	}
+	for _, omitted := range []string{
+		"2-addons/profiles/",
+		"kind: Kustomization\nmetadata:\n  name: trivy-dashboard",
+		"name: strimzi",
+		"name: hubble-ui",
+	} {
+		if strings.Contains(manifest, omitted) {
+			t.Fatalf("expected custom manifest to omit %q\n%s", omitted, manifest)
+		}
+	}
+}
+
+func TestFluxKustomizationsCustomOnSmallBaseMatchesSmallOverlays(t *testing.T) {
+	custom := map[string]fluxKustomization{}
+	for _, item := range fluxKustomizationsForProfile(".", config.ComponentsConfig{Base: config.ProfileSmall}.Spec()) {
+		custom[item.Name] = item
+	}
+	small := fluxKustomizationsForProfile(".", config.ProfileSpecFor(config.ProfileSmall))
+	if len(custom) != len(small) {
+		t.Fatalf("expected the Kustomizations of small, got %v", custom)
+	}
+	for _, item := range small {
+		customItem, ok := custom[item.Name]
+		if !ok {
+			t.Fatalf("custom profile is missing Kustomization %s", item.Name)
+		}
+		got := map[string]interface{}{}
+		for _, patch := range customItem.Patches {
+			got[patch.Kind+"/"+patch.Namespace+"/"+patch.Name] = parseYAML(t, []byte(patch.Patch))
+		}
+		want := map[string]interface{}{}
+		if overlay := strings.TrimPrefix(item.Path, "./"); strings.HasPrefix(overlay, "2-addons/profiles/small/") {
+			want = overlayPatches(t, filepath.Join("..", "..", "..", overlay))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("patches of %s differ from the small overlay:\ngot  %v\nwant %v", item.Name, got, want)
+		}
+	}
+}
+
+// overlayPatches reads the patch files of a Kustomize overlay keyed like
+// the generated Flux patches.
+func overlayPatches(t *testing.T, dir string) map[string]interface{} {
+	t.Helper()
+	var kustomization struct {
+		Patches []struct {
+			Path string `json:"path"`
+		} `json:"patches"`
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("read overlay: %v", err)
+	}
+	if err := yaml.Unmarshal(content, &kustomization); err != nil {
+		t.Fatalf("parse overlay: %v", err)
+	}
+	patches := map[string]interface{}{}
+	for _, patch := range kustomization.Patches {
+		content, err := os.ReadFile(filepath.Join(dir, patch.Path))
+		if err != nil {
+			t.Fatalf("read patch: %v", err)
+		}
+		parsed := parseYAML(t, content)
+		metadata, _ := parsed["metadata"].(map[string]interface{})
+		namespace, _ := metadata["namespace"].(string)
+		name, _ := metadata["name"].(string)
+		patches[parsed["kind"].(string)+"/"+namespace+"/"+name] = parsed
+	}
+	return patches
+}
+
+func parseYAML(t *testing.T, content []byte) map[string]interface{} {
+	t.Helper()
+	var parsed map[string]interface{}
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		t.Fatalf("parse patch: %v\n%s", err, content)
+	}
+	return parsed
+}
@@ -0,0 +1,323 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+	"sigs.k8s.io/yaml"
+)
+
+// imageIDLabel is set on images imported into vind nodes so later loads can
+// skip nodes that already hold the same local Docker image.
+const imageIDLabel = "shoulders.io/image-id"
+
+// ImageLoadState describes the progress of an image load on a single node.
+type ImageLoadState int
+
+const (
+	ImageLoadChecking ImageLoadState = iota
+	ImageLoadImporting
+	ImageLoadSkipped
+	ImageLoadDone
+	ImageLoadFailed
+)
+
+// ImageLoadProgress receives per-node progress updates. It may be called
+// concurrently from several goroutines.
+type ImageLoadProgress func(node string, state ImageLoadState, detail string)
+
+// LoadImageIntoVindCluster imports a single local Docker image into every
+// node of a vind cluster.
+func LoadImageIntoVindCluster(ctx context.Context, clusterName, image string, progress ImageLoadProgress) error {
+	return LoadImagesIntoVindCluster(ctx, clusterName, []string{image}, progress)
+}
+
+// LoadImagesIntoVindCluster imports local Docker images into every node of a
+// vind cluster. Nodes whose containerd store already holds the same image IDs
+// are skipped; the remaining nodes are fed concurrently from a single
+// "docker save" stream.
+func LoadImagesIntoVindCluster(ctx context.Context, clusterName string, images []string, progress ImageLoadProgress) error {
+	if len(images) == 0 {
+		return fmt.Errorf("no images to load")
+	}
+	if progress == nil {
+		progress = func(string, ImageLoadState, string) {}
+	}
+
+	containers, err := vindContainerNames(ctx, clusterName)
+	if err != nil {
+		return err
+	}
+
+	imageIDs, err := localImageIDs(ctx, images)
+	if err != nil {
+		return err
+	}
+
+	targets, err := nodesMissingImages(ctx, containers, imageIDs, progress)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	refs := make([]string, 0, len(imageIDs))
+	for ref := range imageIDs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	return streamImagesToNodes(ctx, targets, refs, imageIDs, progress)
+}
+
+// ComposeImages returns the sorted, de-duplicated image references declared
+// by the services of a Docker Compose file.
+func ComposeImages(content []byte) ([]string, error) {
+	var compose struct {
+		Services map[string]struct {
+			Image string `json:"image"`
+		} `json:"services"`
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return nil, fmt.Errorf("parse compose file: %w", err)
+	}
+
+	seen := map[string]bool{}
+	images := make([]string, 0, len(compose.Services))
+	for _, service := range compose.Services {
+		image := strings.TrimSpace(service.Image)
+		if image == "" || seen[image] {
+			continue
+		}
+		seen[image] = true
+		images = append(images, image)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("compose file does not declare any service images")
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// localImageIDs resolves each image to its normalized containerd reference
+// and the ID of the matching image in the local Docker engine.
+func localImageIDs(ctx context.Context, images []string) (map[string]string, error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return nil, fmt.Errorf("create docker client: %w", err)
+	}
+	defer cli.Close() //nolint:errcheck // best-effort cleanup
+
+	ids := make(map[string]string, len(images))
+	for _, image := range images {
+		ref, err := normalizeImageRef(image)
+		if err != nil {
+			return nil, err
+		}
+		inspect, err := cli.ImageInspect(ctx, image)
+		if err != nil {
+			return nil, fmt.Errorf("inspect local image %q: %w", image, err)
+		}
+		ids[ref] = inspect.ID
+	}
+	return ids, nil
+}
+
+func normalizeImageRef(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(image))
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %q: %w", image, err)
+	}
+	return reference.TagNameOnly(named).String(), nil
+}
+
+// nodesMissingImages checks all nodes concurrently and returns the ones that
+// need at least one of the images imported.
+func nodesMissingImages(ctx context.Context, containers []string, imageIDs map[string]string, progress ImageLoadProgress) ([]string, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		targets []string
+		errs    []error
+	)
+	for _, containerName := range containers {
+		wg.Add(1)
+		go func(containerName string) {
+			defer wg.Done()
+			progress(containerName, ImageLoadChecking, "checking image digests")
+			missing, err := missingImagesOnNode(ctx, containerName, imageIDs)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				progress(containerName, ImageLoadFailed, err.Error())
+				errs = append(errs, fmt.Errorf("check images on %s: %w", containerName, err))
+				return
+			}
+			if len(missing) == 0 {
+				progress(containerName, ImageLoadSkipped, "already up to date")
+				return
+			}
+			targets = append(targets, containerName)
+		}(containerName)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+func missingImagesOnNode(ctx context.Context, containerName string, imageIDs map[string]string) ([]string, error) {
+	var missing []string
+	for ref, id := range imageIDs {
+		out, err := exec.CommandContext(ctx, "docker", "exec", containerName, "ctr", "-n", "k8s.io", "images", "ls", "name=="+ref).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
+		if ctrImageLabel(string(out), ref, imageIDLabel) != id {
+			missing = append(missing, ref)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// ctrImageLabel extracts a label value for ref from "ctr images ls" output.
+// Labels are printed as the last column in the form "k1=v1,k2=v2".
+func ctrImageLabel(output, ref, label string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != ref {
+			continue
+		}
+		for _, entry := range strings.Split(fields[len(fields)-1], ",") {
+			key, value, ok := strings.Cut(entry, "=")
+			if ok && key == label {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// streamImagesToNodes runs a single "docker save" and fans its output out to
+// one "ctr images import" process per target node.
+func streamImagesToNodes(ctx context.Context, targets, refs []string, imageIDs map[string]string, progress ImageLoadProgress) error {
+	cli, err := dockerClient()
+	if err != nil {
+		return fmt.Errorf("create docker client: %w", err)
+	}
+	defer cli.Close() //nolint:errcheck // best-effort cleanup
+
+	archive, err := cli.ImageSave(ctx, refs)
+	if err != nil {
+		return fmt.Errorf("save images: %w", err)
+	}
+	defer archive.Close() //nolint:errcheck // best-effort cleanup
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+		writers = make([]*io.PipeWriter, 0, len(targets))
+	)
+	fanout := &fanoutWriter{}
+	for _, containerName := range targets {
+		reader, writer := io.Pipe()
+		writers = append(writers, writer)
+		fanout.add(writer)
+
+		wg.Add(1)
+		go func(containerName string, reader *io.PipeReader) {
+			defer wg.Done()
+			progress(containerName, ImageLoadImporting, fmt.Sprintf("importing %d image(s)", len(refs)))
+			err := importArchiveIntoNode(ctx, containerName, reader, refs, imageIDs)
+			// Unblock the fan-out writer if the importer exited early.
+			_ = reader.CloseWithError(errImporterClosed)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				progress(containerName, ImageLoadFailed, err.Error())
+				errs = append(errs, fmt.Errorf("load images into %s: %w", containerName, err))
+				return
+			}
+			progress(containerName, ImageLoadDone, fmt.Sprintf("imported %d image(s)", len(refs)))
+		}(containerName, reader)
+	}
+
+	_, copyErr := io.Copy(fanout, archive)
+	for _, writer := range writers {
+		_ = writer.CloseWithError(copyErr)
+	}
+	wg.Wait()
+
+	if copyErr != nil && !errors.Is(copyErr, errImporterClosed) {
+		errs = append(errs, fmt.Errorf("stream images: %w", copyErr))
+	}
+	return errors.Join(errs...)
+}
+
+func importArchiveIntoNode(ctx context.Context, containerName string, archive io.Reader, refs []string, imageIDs map[string]string) error {
+	var stderr bytes.Buffer
+	importCmd := exec.CommandContext(ctx, "docker", "exec", "-i", containerName, "ctr", "-n", "k8s.io", "images", "import", "-")
+	importCmd.Stdin = archive
+	importCmd.Stdout = io.Discard
+	importCmd.Stderr = &stderr
+	if err := importCmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	for _, ref := range refs {
+		labelCmd := exec.CommandContext(ctx, "docker", "exec", containerName, "ctr", "-n", "k8s.io", "images", "label", ref, imageIDLabel+"="+imageIDs[ref])
+		labelCmd.Stdout = io.Discard
+		labelCmd.Stderr = os.Stderr
+		if err := labelCmd.Run(); err != nil {
+			return fmt.Errorf("label image %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+var errImporterClosed = errors.New("image importer closed")
+
+// fanoutWriter copies every write to all registered writers. A writer that
+// fails is dropped so the remaining importers keep receiving data; Write only
+// fails once every writer has failed.
+type fanoutWriter struct {
+	writers []io.Writer
+	failed  []bool
+}
+
+func (f *fanoutWriter) add(writer io.Writer) {
+	f.writers = append(f.writers, writer)
+	f.failed = append(f.failed, false)
+}
+
+func (f *fanoutWriter) Write(p []byte) (int, error) {
+	active := 0
+	for index, writer := range f.writers {
+		if f.failed[index] {
+			continue
+		}
+		if _, err := writer.Write(p); err != nil {
+			f.failed[index] = true
+			continue
+		}
+		active++
+	}
+	if active == 0 {
+		return 0, errImporterClosed
+	}
+	return len(p), nil
+}
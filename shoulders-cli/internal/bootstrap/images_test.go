@@ -0,0 +1,95 @@
+package bootstrap
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestComposeImagesDeduplicatesAndSorts(t *testing.T) {
+	content := []byte(`services:
+  web:
+    image: api:dev
+  worker:
+    image: worker:dev
+  sidecar:
+    image: api:dev
+  built:
+    build: .
+`)
+	images, err := ComposeImages(content)
+	if err != nil {
+		t.Fatalf("ComposeImages() error = %v", err)
+	}
+	want := []string{"api:dev", "worker:dev"}
+	if !reflect.DeepEqual(images, want) {
+		t.Fatalf("expected %v, got %v", want, images)
+	}
+}
+
+func TestComposeImagesRequiresImages(t *testing.T) {
+	if _, err := ComposeImages([]byte("services:\n  web:\n    build: .\n")); err == nil {
+		t.Fatal("expected an error for a compose file without images")
+	}
+}
+
+func TestNormalizeImageRef(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                       "docker.io/library/nginx:latest",
+		"nginx:1.26":                  "docker.io/library/nginx:1.26",
+		"localhost:5000/team/api:dev": "localhost:5000/team/api:dev",
+	}
+	for input, want := range tests {
+		got, err := normalizeImageRef(input)
+		if err != nil {
+			t.Fatalf("normalizeImageRef(%q) error = %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("normalizeImageRef(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestCtrImageLabel(t *testing.T) {
+	output := "REF                            TYPE                                       DIGEST      SIZE    PLATFORMS   LABELS\n" +
+		"docker.io/library/nginx:1.26   application/vnd.oci.image.manifest.v1+json sha256:aaa  67.2 MiB linux/amd64 io.cri-containerd.image=managed,shoulders.io/image-id=sha256:bbb\n" +
+		"docker.io/library/redis:8     application/vnd.oci.image.manifest.v1+json sha256:ccc  40.0 MiB linux/amd64 -\n"
+
+	if got := ctrImageLabel(output, "docker.io/library/nginx:1.26", imageIDLabel); got != "sha256:bbb" {
+		t.Fatalf("expected image id label, got %q", got)
+	}
+	if got := ctrImageLabel(output, "docker.io/library/redis:8", imageIDLabel); got != "" {
+		t.Fatalf("expected no label for unlabeled image, got %q", got)
+	}
+	if got := ctrImageLabel(output, "docker.io/library/missing:1", imageIDLabel); got != "" {
+		t.Fatalf("expected no label for missing image, got %q", got)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestFanoutWriterDropsFailedWriters(t *testing.T) {
+	var first, second bytes.Buffer
+	fanout := &fanoutWriter{}
+	fanout.add(&first)
+	fanout.add(failingWriter{})
+	fanout.add(&second)
+
+	if _, err := fanout.Write([]byte("layer")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if first.String() != "layer" || second.String() != "layer" {
+		t.Fatalf("expected healthy writers to receive data, got %q and %q", first.String(), second.String())
+	}
+
+	onlyFailing := &fanoutWriter{}
+	onlyFailing.add(failingWriter{})
+	if _, err := onlyFailing.Write([]byte("layer")); !errors.Is(err, errImporterClosed) {
+		t.Fatalf("expected errImporterClosed when all writers fail, got %v", err)
+	}
+}
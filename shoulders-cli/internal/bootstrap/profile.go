@@ -0,0 +1,283 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// ProfileChange describes what switching the platform profile would change
+// on a running cluster.
+type ProfileChange struct {
+	From                  config.ProfileSpec `json:"-" yaml:"-"`
+	To                    config.ProfileSpec `json:"-" yaml:"-"`
+	FromProfile           string             `json:"fromProfile" yaml:"fromProfile"`
+	ToProfile             string             `json:"toProfile" yaml:"toProfile"`
+	AddedKustomizations   []string           `json:"addedKustomizations,omitempty" yaml:"addedKustomizations,omitempty"`
+	RemovedKustomizations []string           `json:"removedKustomizations,omitempty" yaml:"removedKustomizations,omitempty"`
+	ChangedKustomizations []string           `json:"changedKustomizations,omitempty" yaml:"changedKustomizations,omitempty"`
+	EnabledComponents     []string           `json:"enabledComponents,omitempty" yaml:"enabledComponents,omitempty"`
+	DisabledComponents    []string           `json:"disabledComponents,omitempty" yaml:"disabledComponents,omitempty"`
+	ChangedSettings       []string           `json:"changedSettings,omitempty" yaml:"changedSettings,omitempty"`
+	RemovedResources      []string           `json:"removedResources,omitempty" yaml:"removedResources,omitempty"`
+
+	pathPrefix string
+	removed    []componentResource
+}
+
+// Empty reports whether the switch would not change anything.
+func (change ProfileChange) Empty() bool {
+	return len(change.AddedKustomizations) == 0 &&
+		len(change.RemovedKustomizations) == 0 &&
+		len(change.ChangedKustomizations) == 0 &&
+		len(change.EnabledComponents) == 0 &&
+		len(change.DisabledComponents) == 0 &&
+		len(change.ChangedSettings) == 0
+}
+
+// CiliumChanged reports whether the Cilium Helm values derived from the
+// profile differ between the two profiles.
+func (change ProfileChange) CiliumChanged() bool {
+	return CiliumOptionsForProfile(change.From) != CiliumOptionsForProfile(change.To)
+}
+
+type profileComponent struct {
+	name    string
+	enabled func(config.ProfileSpec) bool
+}
+
+var profileComponents = []profileComponent{
+	{"eventStreams", func(spec config.ProfileSpec) bool { return spec.EventStreams }},
+	{"policyReporter", func(spec config.ProfileSpec) bool { return spec.PolicyReporter }},
+	{"trivy", func(spec config.ProfileSpec) bool { return spec.Trivy }},
+	{"falco", func(spec config.ProfileSpec) bool { return spec.Falco }},
+	{"hubbleUI", func(spec config.ProfileSpec) bool { return spec.HubbleUI }},
+	{"logTracePipeline", func(spec config.ProfileSpec) bool { return spec.LogTracePipeline }},
+	{"ciliumObservability", func(spec config.ProfileSpec) bool { return spec.CiliumObservability }},
+}
+
+// InstalledProfileSpec reads the profile the cluster was bootstrapped with
+// from the shoulders-platform-config ConfigMap.
+func InstalledProfileSpec(ctx context.Context, kubeconfigPath string) (config.ProfileSpec, error) {
+	clientset, err := kube.NewClientset(kubeconfigPath)
+	if err != nil {
+		return config.ProfileSpec{}, err
+	}
+	configMap, err := clientset.CoreV1().ConfigMaps("flux-system").Get(ctx, fluxPlatformConfigName, metav1.GetOptions{})
+	if err != nil {
+		return config.ProfileSpec{}, fmt.Errorf("get platform config: %w", err)
+	}
+	return profileSpecFromPlatformConfig(configMap.Data), nil
+}
+
+// profileSpecFromPlatformConfig rebuilds a profile from the platform config
+// values. Clusters bootstrapped before the component keys existed fall back
+// to the built-in profile defaults.
+func profileSpecFromPlatformConfig(data map[string]string) config.ProfileSpec {
+	name := data["SHOULDERS_PROFILE"]
+	base := data["SHOULDERS_PROFILE_BASE"]
+	if base == "" {
+		base = name
+	}
+	spec := config.ProfileSpecFor(base)
+	if name == config.ProfileCustom {
+		spec.Name = config.ProfileCustom
+	}
+
+	bools := map[string]*bool{
+		"SHOULDERS_EVENT_STREAMS":        &spec.EventStreams,
+		"SHOULDERS_POLICY_REPORTER":      &spec.PolicyReporter,
+		"SHOULDERS_TRIVY":                &spec.Trivy,
+		"SHOULDERS_FALCO":                &spec.Falco,
+		"SHOULDERS_HUBBLE_UI":            &spec.HubbleUI,
+		"SHOULDERS_LOG_TRACE_PIPELINE":   &spec.LogTracePipeline,
+		"SHOULDERS_CILIUM_OBSERVABILITY": &spec.CiliumObservability,
+	}
+	for key, target := range bools {
+		if parsed, err := strconv.ParseBool(data[key]); err == nil {
+			*target = parsed
+		}
+	}
+	ints := map[string]*int{
+		"SHOULDERS_POSTGRES_INSTANCES": &spec.PostgresInstances,
+		"SHOULDERS_KAFKA_REPLICAS":     &spec.KafkaReplicas,
+		"SHOULDERS_KAFKA_MIN_ISR":      &spec.KafkaMinISR,
+	}
+	for key, target := range ints {
+		if parsed, err := strconv.Atoi(data[key]); err == nil {
+			*target = parsed
+		}
+	}
+	texts := map[string]*string{
+		"SHOULDERS_KAFKA_STORAGE":             &spec.KafkaStorage,
+		"SHOULDERS_PROMETHEUS_RETENTION":      &spec.PrometheusRetention,
+		"SHOULDERS_PROMETHEUS_RETENTION_SIZE": &spec.PrometheusSize,
+	}
+	for key, target := range texts {
+		if value := data[key]; value != "" {
+			*target = value
+		}
+	}
+	return spec
+}
+
+// PlanProfileChange diffs the Flux Kustomizations, components and removed
+// resources between two profiles.
+func PlanProfileChange(pathPrefix string, from, to config.ProfileSpec) ProfileChange {
+	change := ProfileChange{
+		From:        from,
+		To:          to,
+		FromProfile: from.Name,
+		ToProfile:   to.Name,
+		pathPrefix:  pathPrefix,
+	}
+
+	fromItems := map[string]fluxKustomization{}
+	for _, item := range fluxKustomizationsForProfile(pathPrefix, from) {
+		fromItems[item.Name] = item
+	}
+	toItems := map[string]fluxKustomization{}
+	for _, item := range fluxKustomizationsForProfile(pathPrefix, to) {
+		toItems[item.Name] = item
+		previous, ok := fromItems[item.Name]
+		switch {
+		case !ok:
+			change.AddedKustomizations = append(change.AddedKustomizations, item.Name)
+		case previous.Path != item.Path:
+			change.ChangedKustomizations = append(change.ChangedKustomizations, fmt.Sprintf("%s: %s -> %s", item.Name, previous.Path, item.Path))
+		case len(previous.Patches) != len(item.Patches):
+			change.ChangedKustomizations = append(change.ChangedKustomizations, fmt.Sprintf("%s: %d -> %d patches", item.Name, len(previous.Patches), len(item.Patches)))
+		}
+	}
+	for name := range fromItems {
+		if _, ok := toItems[name]; !ok {
+			change.RemovedKustomizations = append(change.RemovedKustomizations, name)
+		}
+	}
+	sort.Strings(change.RemovedKustomizations)
+
+	for _, component := range profileComponents {
+		was, will := component.enabled(from), component.enabled(to)
+		switch {
+		case !was && will:
+			change.EnabledComponents = append(change.EnabledComponents, component.name)
+		case was && !will:
+			change.DisabledComponents = append(change.DisabledComponents, component.name)
+		}
+	}
+
+	fromValues := profileConfigValues(from)
+	toValues := profileConfigValues(to)
+	for _, key := range []string{"SHOULDERS_POSTGRES_INSTANCES", "SHOULDERS_KAFKA_REPLICAS", "SHOULDERS_KAFKA_MIN_ISR", "SHOULDERS_KAFKA_STORAGE", "SHOULDERS_PROMETHEUS_RETENTION", "SHOULDERS_PROMETHEUS_RETENTION_SIZE"} {
+		if fromValues[key] != toValues[key] {
+			change.ChangedSettings = append(change.ChangedSettings, fmt.Sprintf("%s: %s -> %s", key, fromValues[key], toValues[key]))
+		}
+	}
+
+	alreadyRemoved := map[componentResource]bool{}
+	for _, resource := range disabledComponentResources(from) {
+		alreadyRemoved[resource] = true
+	}
+	for _, resource := range disabledComponentResources(to) {
+		if alreadyRemoved[resource] {
+			continue
+		}
+		change.removed = append(change.removed, resource)
+		name := resource.Name
+		if resource.Namespace != "" {
+			name = resource.Namespace + "/" + resource.Name
+		}
+		change.RemovedResources = append(change.RemovedResources, resource.Kind+" "+name)
+	}
+	return change
+}
+
+// ApplyProfileChange updates the profile entries of the platform config and
+// re-applies the Flux Kustomizations for the target profile. Kustomizations
+// that the target profile no longer uses are deleted so Flux prunes them.
+func ApplyProfileChange(ctx context.Context, kubeconfigPath string, change ProfileChange) error {
+	clientset, err := kube.NewClientset(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{"data": profileConfigValues(change.To)})
+	if err != nil {
+		return fmt.Errorf("marshal platform config patch: %w", err)
+	}
+	if _, err := clientset.CoreV1().ConfigMaps("flux-system").Patch(ctx, fluxPlatformConfigName, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("patch platform config: %w", err)
+	}
+
+	if err := kube.ApplyManifest(ctx, kubeconfigPath, fluxKustomizationsManifest(change.pathPrefix, change.To), "flux-system"); err != nil {
+		return fmt.Errorf("apply flux kustomizations: %w", err)
+	}
+
+	client, err := kube.NewDynamicClient(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("create dynamic client: %w", err)
+	}
+	for _, name := range change.RemovedKustomizations {
+		if err := kube.Delete(ctx, client, fluxKustomizationGVR, "flux-system", name); err != nil {
+			return fmt.Errorf("delete flux kustomization %s: %w", name, err)
+		}
+	}
+
+	// Re-applying the helm-releases Kustomization resets its patches, so the
+	// CLI-managed Cilium release has to be excluded again.
+	return SuspendCiliumHelmRelease(kubeconfigPath)
+}
+
+// WaitForProfilePruned waits until Flux has pruned every resource the target
+// profile removes.
+func WaitForProfilePruned(ctx context.Context, kubeconfigPath string, change ProfileChange, timeout time.Duration) error {
+	client, err := kube.NewDynamicClient(kubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("create dynamic client: %w", err)
+	}
+
+	return wait.PollUntilContextTimeout(ctx, 5*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		for _, resource := range change.removed {
+			gvr, ok := componentResourceGVR(resource)
+			if !ok {
+				continue
+			}
+			var getErr error
+			if resource.Namespace != "" {
+				_, getErr = client.Resource(gvr).Namespace(resource.Namespace).Get(ctx, resource.Name, metav1.GetOptions{})
+			} else {
+				_, getErr = client.Resource(gvr).Get(ctx, resource.Name, metav1.GetOptions{})
+			}
+			if getErr == nil || !apierrors.IsNotFound(getErr) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+func componentResourceGVR(resource componentResource) (schema.GroupVersionResource, bool) {
+	gv, err := schema.ParseGroupVersion(resource.APIVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, false
+	}
+	plural, ok := map[string]string{
+		"Namespace":                   "namespaces",
+		"HelmRepository":              "helmrepositories",
+		"HelmRelease":                 "helmreleases",
+		"HTTPRoute":                   "httproutes",
+		"Composition":                 "compositions",
+		"CompositeResourceDefinition": "compositeresourcedefinitions",
+	}[resource.Kind]
+	return gv.WithResource(plural), ok
+}
@@ -0,0 +1,62 @@
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/config"
+)
+
+func TestProfileSpecFromPlatformConfigRoundTrips(t *testing.T) {
+	enabled := true
+	components := config.ComponentsConfig{Base: config.ProfileSmall, Falco: &enabled, KafkaReplicas: 2}
+	spec := components.Spec()
+
+	got := profileSpecFromPlatformConfig(profileConfigValues(spec))
+	if got != spec {
+		t.Fatalf("expected %+v, got %+v", spec, got)
+	}
+}
+
+func TestProfileSpecFromPlatformConfigFallsBackToProfileDefaults(t *testing.T) {
+	got := profileSpecFromPlatformConfig(map[string]string{"SHOULDERS_PROFILE": config.ProfileLarge})
+	if want := config.ProfileSpecFor(config.ProfileLarge); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestPlanProfileChangeMediumToSmall(t *testing.T) {
+	change := PlanProfileChange("", config.ProfileSpecFor(config.ProfileMedium), config.ProfileSpecFor(config.ProfileSmall))
+
+	if change.Empty() {
+		t.Fatalf("expected medium to small to change the platform")
+	}
+	if strings.Join(change.RemovedKustomizations, ",") != "policy-reporter,trivy-dashboard" {
+		t.Fatalf("unexpected removed kustomizations: %v", change.RemovedKustomizations)
+	}
+	if !containsString(change.DisabledComponents, "eventStreams") {
+		t.Fatalf("expected eventStreams to be disabled, got %v", change.DisabledComponents)
+	}
+	if !containsString(change.RemovedResources, "CompositeResourceDefinition eventstreams.shoulders.io") {
+		t.Fatalf("expected the EventStream XRD to be pruned, got %v", change.RemovedResources)
+	}
+	if len(change.AddedKustomizations) != 0 {
+		t.Fatalf("expected no added kustomizations, got %v", change.AddedKustomizations)
+	}
+}
+
+func TestPlanProfileChangeSameProfileIsEmpty(t *testing.T) {
+	spec := config.ProfileSpecFor(config.ProfileMedium)
+	if change := PlanProfileChange("", spec, spec); !change.Empty() {
+		t.Fatalf("expected no changes, got %+v", change)
+	}
+}
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"github.com/jherreros/shoulders/shoulders-cli/internal/sops"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EnsureSOPSAgeSecret stores the age key Flux decrypts sealed Secrets with.
+// A key already in the cluster is kept; otherwise the key persisted in
+// ~/.shoulders/age is used, so files sealed for an earlier cluster still
+// decrypt after it is recreated.
+func EnsureSOPSAgeSecret(ctx context.Context, kubeconfigPath string) error {
+	clientset, err := kube.NewClientset(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+	secrets := clientset.CoreV1().Secrets(sops.SecretNamespace)
+	if _, err := secrets.Get(ctx, sops.SecretName, metav1.GetOptions{}); err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("get sops age key: %w", err)
+	}
+
+	dir, err := sops.Dir()
+	if err != nil {
+		return err
+	}
+	identity, _, err := sops.LoadOrCreateIdentity(dir)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: sops.SecretName, Namespace: sops.SecretNamespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{sops.KeyFile: sops.KeyFileContent(identity, time.Now())},
+	}
+	if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("store sops age key: %w", err)
+	}
+	return nil
+}
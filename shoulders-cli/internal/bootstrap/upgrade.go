@@ -0,0 +1,223 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jherreros/shoulders/shoulders-cli/internal/kube"
+	"helm.sh/helm/v4/pkg/action"
+	helmcli "helm.sh/helm/v4/pkg/cli"
+	helmkube "helm.sh/helm/v4/pkg/kube"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
+	"helm.sh/helm/v4/pkg/storage/driver"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const fluxVersionLabel = "app.kubernetes.io/version"
+
+// CiliumRelease describes the CLI-managed Cilium Helm release.
+type CiliumRelease struct {
+	Version  string
+	Revision int
+}
+
+// FluxInstallation describes the Flux distribution version and the image of
+// each controller Deployment in flux-system.
+type FluxInstallation struct {
+	Version     string
+	Controllers map[string]string
+}
+
+// InstalledCiliumRelease returns the deployed Cilium chart version and Helm
+// revision. The boolean is false when Cilium is not installed by Helm.
+func InstalledCiliumRelease(kubeconfigPath string) (CiliumRelease, bool, error) {
+	actionConfig, err := newCiliumActionConfig(kubeconfigPath)
+	if err != nil {
+		return CiliumRelease{}, false, err
+	}
+
+	releaser, err := action.NewGet(actionConfig).Run(ciliumChartName)
+	if err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return CiliumRelease{}, false, nil
+		}
+		return CiliumRelease{}, false, fmt.Errorf("get cilium release: %w", err)
+	}
+	release, ok := releaser.(*releasev1.Release)
+	if !ok {
+		return CiliumRelease{}, false, fmt.Errorf("unsupported cilium release type %T", releaser)
+	}
+
+	info := CiliumRelease{Revision: release.Version}
+	if release.Chart != nil && release.Chart.Metadata != nil {
+		info.Version = release.Chart.Metadata.Version
+	}
+	return info, true, nil
+}
+
+// RollbackCilium rolls the Cilium Helm release back to revision and waits for
+// the agents and operator to settle.
+func RollbackCilium(kubeconfigPath string, revision int) error {
+	actionConfig, err := newCiliumActionConfig(kubeconfigPath)
+	if err != nil {
+		return err
+	}
+
+	rollback := action.NewRollback(actionConfig)
+	rollback.Version = revision
+	rollback.WaitStrategy = helmkube.LegacyStrategy
+	rollback.Timeout = 5 * time.Minute
+	if err := rollback.Run(ciliumChartName); err != nil {
+		return fmt.Errorf("rollback cilium to revision %d: %w", revision, err)
+	}
+	return RestartCiliumWorkloads(kubeconfigPath)
+}
+
+// InstalledFluxInstallation reads the Flux controllers running in flux-system.
+func InstalledFluxInstallation(ctx context.Context, kubeconfigPath string) (FluxInstallation, error) {
+	clientset, err := kube.NewClientset(kubeconfigPath)
+	if err != nil {
+		return FluxInstallation{}, err
+	}
+
+	deployments, err := clientset.AppsV1().Deployments("flux-system").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return FluxInstallation{}, fmt.Errorf("list flux controllers: %w", err)
+	}
+	return fluxInstallationFromDeployments(deployments.Items), nil
+}
+
+// FluxReleaseInstallation downloads the Flux install manifest for version and
+// returns the controller images it would deploy.
+func FluxReleaseInstallation(ctx context.Context, version string) (FluxInstallation, error) {
+	manifest, err := downloadFluxManifest(ctx, version)
+	if err != nil {
+		return FluxInstallation{}, err
+	}
+	return fluxInstallationFromManifest(manifest)
+}
+
+// UpgradeFlux applies the Flux install manifest for version and waits for
+// every controller Deployment to roll out.
+func UpgradeFlux(ctx context.Context, kubeconfigPath, version string) error {
+	manifest, err := downloadFluxManifest(ctx, version)
+	if err != nil {
+		return err
+	}
+	target, err := fluxInstallationFromManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if err := kube.ApplyManifest(ctx, kubeconfigPath, manifest, ""); err != nil {
+		return fmt.Errorf("apply flux install manifest: %w", err)
+	}
+	for _, name := range sortedKeys(target.Controllers) {
+		if err := WaitForDeploymentReady(kubeconfigPath, "flux-system", name, 5*time.Minute); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FluxControllerChanges lists the controllers whose image differs between the
+// installed and target Flux installations, formatted as "name: old -> new".
+func FluxControllerChanges(installed, target FluxInstallation) []string {
+	changes := []string{}
+	for _, name := range sortedKeys(target.Controllers) {
+		current := installed.Controllers[name]
+		desired := target.Controllers[name]
+		if current == desired {
+			continue
+		}
+		if current == "" {
+			current = "<none>"
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, ImageTag(current), ImageTag(desired)))
+	}
+	return changes
+}
+
+// ImageTag returns the tag of an image reference, or the reference itself
+// when no tag is present.
+func ImageTag(image string) string {
+	image = strings.SplitN(image, "@", 2)[0]
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		return image[colon+1:]
+	}
+	return image
+}
+
+func fluxInstallationFromDeployments(deployments []appsv1.Deployment) FluxInstallation {
+	installation := FluxInstallation{Controllers: map[string]string{}}
+	for _, deployment := range deployments {
+		containers := deployment.Spec.Template.Spec.Containers
+		if len(containers) == 0 {
+			continue
+		}
+		installation.Controllers[deployment.Name] = containers[0].Image
+		if installation.Version == "" {
+			installation.Version = deployment.Labels[fluxVersionLabel]
+		}
+	}
+	return installation
+}
+
+func fluxInstallationFromManifest(manifest []byte) (FluxInstallation, error) {
+	deployments := []appsv1.Deployment{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+	for {
+		var raw unstructured.Unstructured
+		if err := decoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return FluxInstallation{}, fmt.Errorf("parse flux install manifest: %w", err)
+		}
+		if raw.Object == nil || raw.GetKind() != "Deployment" {
+			continue
+		}
+		var deployment appsv1.Deployment
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, &deployment); err != nil {
+			return FluxInstallation{}, fmt.Errorf("parse flux controller %s: %w", raw.GetName(), err)
+		}
+		deployments = append(deployments, deployment)
+	}
+	if len(deployments) == 0 {
+		return FluxInstallation{}, fmt.Errorf("flux install manifest does not contain any controllers")
+	}
+	return fluxInstallationFromDeployments(deployments), nil
+}
+
+func newCiliumActionConfig(kubeconfigPath string) (*action.Configuration, error) {
+	settings := helmcli.New()
+	if kubeconfigPath != "" {
+		settings.KubeConfig = kubeconfigPath
+	}
+	settings.SetNamespace("kube-system")
+
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), "secret"); err != nil {
+		return nil, err
+	}
+	return actionConfig, nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
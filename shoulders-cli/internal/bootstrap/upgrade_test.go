@@ -0,0 +1,105 @@
+package bootstrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFluxInstallationFromManifestReadsControllers(t *testing.T) {
+	manifest := []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: flux-system
+  labels:
+    app.kubernetes.io/version: v2.8.3
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: source-controller
+  namespace: flux-system
+spec:
+  selector:
+    app: source-controller
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: source-controller
+  namespace: flux-system
+  labels:
+    app.kubernetes.io/version: v2.8.3
+spec:
+  template:
+    spec:
+      containers:
+        - name: manager
+          image: ghcr.io/fluxcd/source-controller:v1.8.1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: kustomize-controller
+  namespace: flux-system
+  labels:
+    app.kubernetes.io/version: v2.8.3
+spec:
+  template:
+    spec:
+      containers:
+        - name: manager
+          image: ghcr.io/fluxcd/kustomize-controller:v1.8.2
+`)
+
+	installation, err := fluxInstallationFromManifest(manifest)
+	if err != nil {
+		t.Fatalf("fluxInstallationFromManifest() error = %v", err)
+	}
+	if installation.Version != "v2.8.3" {
+		t.Fatalf("expected version v2.8.3, got %q", installation.Version)
+	}
+	want := map[string]string{
+		"source-controller":    "ghcr.io/fluxcd/source-controller:v1.8.1",
+		"kustomize-controller": "ghcr.io/fluxcd/kustomize-controller:v1.8.2",
+	}
+	if !reflect.DeepEqual(installation.Controllers, want) {
+		t.Fatalf("expected controllers %v, got %v", want, installation.Controllers)
+	}
+}
+
+func TestFluxControllerChangesListsChangedImages(t *testing.T) {
+	installed := FluxInstallation{Controllers: map[string]string{
+		"helm-controller":   "ghcr.io/fluxcd/helm-controller:v1.5.0",
+		"source-controller": "ghcr.io/fluxcd/source-controller:v1.8.1",
+	}}
+	target := FluxInstallation{Controllers: map[string]string{
+		"helm-controller":   "ghcr.io/fluxcd/helm-controller:v1.5.0",
+		"source-controller": "ghcr.io/fluxcd/source-controller:v1.9.0",
+		"image-controller":  "ghcr.io/fluxcd/image-controller:v0.1.0",
+	}}
+
+	changes := FluxControllerChanges(installed, target)
+	want := []string{
+		"image-controller: <none> -> v0.1.0",
+		"source-controller: v1.8.1 -> v1.9.0",
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("expected changes %v, got %v", want, changes)
+	}
+	if changes := FluxControllerChanges(installed, installed); len(changes) != 0 {
+		t.Fatalf("expected no changes for identical installations, got %v", changes)
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io/fluxcd/source-controller:v1.8.1":        "v1.8.1",
+		"localhost:5000/source-controller":               "localhost:5000/source-controller",
+		"ghcr.io/fluxcd/source-controller:v1@sha256:abc": "v1",
+	}
+	for image, want := range tests {
+		if got := ImageTag(image); got != want {
+			t.Fatalf("ImageTag(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	AddonSourceGit  = "git"
+	AddonSourceOCI  = "oci"
+	AddonSourceHelm = "helm"
+)
+
+// BuiltinKustomizations are the Flux Kustomizations that addons may depend on.
+var BuiltinKustomizations = []string{
+	"helm-repositories",
+	"namespaces",
+	"crds",
+	"headlamp",
+	"helm-releases",
+	"crossplane",
+	"gateway",
+	"policy-reporter",
+	"trivy-dashboard",
+	"user-secrets",
+}
+
+var dnsLabelPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// AddonConfig is a third-party component installed by Flux alongside the
+// built-in platform addons.
+type AddonConfig struct {
+	Name   string      `yaml:"name" json:"name"`
+	Source AddonSource `yaml:"source" json:"source"`
+	// Path is the directory reconciled from a git or oci source.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Chart and Version select the chart of a helm source.
+	Chart     string `yaml:"chart,omitempty" json:"chart,omitempty"`
+	Version   string `yaml:"version,omitempty" json:"version,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	// Values are Helm values for helm sources and postBuild substitutions
+	// for git and oci sources.
+	Values    map[string]interface{} `yaml:"values,omitempty" json:"values,omitempty"`
+	DependsOn []string               `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty"`
+}
+
+type AddonSource struct {
+	Type string `yaml:"type" json:"type"`
+	URL  string `yaml:"url" json:"url"`
+	// Ref is the branch of a git source or the tag of an oci source.
+	Ref string `yaml:"ref,omitempty" json:"ref,omitempty"`
+}
+
+func (cfg *Config) Addons() []AddonConfig {
+	if cfg == nil {
+		return nil
+	}
+	return cfg.Platform.Addons
+}
+
+// ValidateAddons checks each addon and that dependsOn only names built-in
+// Kustomizations or other addons.
+func ValidateAddons(addons []AddonConfig) error {
+	known := map[string]bool{}
+	for _, name := range BuiltinKustomizations {
+		known[name] = true
+	}
+	for _, addon := range addons {
+		if err := addon.Validate(); err != nil {
+			return err
+		}
+		if known[addon.Name] {
+			return fmt.Errorf("addon %q: name is already used by another addon or a built-in kustomization", addon.Name)
+		}
+		known[addon.Name] = true
+	}
+	for _, addon := range addons {
+		for _, dependency := range addon.DependsOn {
+			if !known[dependency] {
+				return fmt.Errorf("addon %q: unknown dependency %q", addon.Name, dependency)
+			}
+			if dependency == addon.Name {
+				return fmt.Errorf("addon %q: cannot depend on itself", addon.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (addon AddonConfig) Validate() error {
+	if !dnsLabelPattern.MatchString(addon.Name) {
+		return fmt.Errorf("addon %q: name must be a lowercase DNS label", addon.Name)
+	}
+	if strings.TrimSpace(addon.Source.URL) == "" {
+		return fmt.Errorf("addon %q: source.url is required", addon.Name)
+	}
+	switch addon.Source.Type {
+	case AddonSourceGit, AddonSourceOCI:
+		if addon.Chart != "" {
+			return fmt.Errorf("addon %q: chart is only supported for helm sources", addon.Name)
+		}
+		for key, value := range addon.Values {
+			switch value.(type) {
+			case string, bool, float64, int, int64:
+			default:
+				return fmt.Errorf("addon %q: value %q must be a scalar for %s sources", addon.Name, key, addon.Source.Type)
+			}
+		}
+	case AddonSourceHelm:
+		if addon.Chart == "" {
+			return fmt.Errorf("addon %q: chart is required for helm sources", addon.Name)
+		}
+		if addon.Path != "" {
+			return fmt.Errorf("addon %q: path is only supported for git and oci sources", addon.Name)
+		}
+	default:
+		return fmt.Errorf("addon %q: unsupported source type %q (expected git, oci or helm)", addon.Name, addon.Source.Type)
+	}
+	return nil
+}
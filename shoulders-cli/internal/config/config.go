@@ -1,11 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"sigs.k8s.io/yaml"
 )
 
 func Load(pathOverride ...string) (*Config, error) {
@@ -13,43 +12,90 @@ func Load(pathOverride ...string) (*Config, error) {
 }
 
 func LoadWithOverrides(overrides []string, pathOverride ...string) (*Config, error) {
+	return LoadEnvironment("", overrides, pathOverride...)
+}
+
+// LoadEnvironment loads the config with the named environment active. An
+// empty name selects SHOULDERS_CURRENT_ENVIRONMENT or current_environment
+// from the file. Values are layered as defaults < file < SHOULDERS_*
+// environment variables < overrides.
+func LoadEnvironment(environment string, overrides []string, pathOverride ...string) (*Config, error) {
 	configPath, err := Path(pathOverride...)
 	if err != nil {
 		return nil, err
 	}
 
-	cfg := &Config{}
-	data, err := os.ReadFile(configPath)
+	cfg, err := readFile(environment, configPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			data = nil
-		} else {
-			return nil, err
-		}
+		return nil, err
 	}
-	if len(data) > 0 {
-		if err := yaml.Unmarshal(data, cfg); err != nil {
-			return nil, err
+	cfg.recordOrigins(nil, OriginFile)
+
+	before := Leaves(cfg)
+	for _, entry := range EnvOverrides() {
+		key, value, _ := strings.Cut(entry, "=")
+		if err := SetValue(cfg, key, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", envSource(key), err)
 		}
 	}
+	cfg.recordOrigins(before, OriginEnv)
+
+	before = Leaves(cfg)
 	if err := ApplyOverrides(cfg, overrides); err != nil {
 		return nil, err
 	}
+	cfg.recordOrigins(before, OriginFlag)
+
+	before = Leaves(cfg)
 	cfg.ApplyDefaults()
+	cfg.recordOrigins(before, OriginDefault)
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 	return cfg, nil
 }
 
+// LoadFile reads the config file with the named environment active but
+// without overrides or defaults, so edits can be saved without persisting
+// runtime values.
+func LoadFile(environment string, pathOverride ...string) (*Config, error) {
+	configPath, err := Path(pathOverride...)
+	if err != nil {
+		return nil, err
+	}
+	return readFile(environment, configPath)
+}
+
+func readFile(environment, configPath string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := decodeFile(data, cfg); err != nil {
+			return nil, fmt.Errorf("read config %s: %w", configPath, err)
+		}
+	}
+	if environment == "" {
+		environment = strings.TrimSpace(os.Getenv(EnvVarName(currentEnvironmentKey)))
+	}
+	if environment == "" {
+		environment = cfg.CurrentEnvironment
+	}
+	if err := cfg.UseEnvironment(environment); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
 func Save(cfg *Config, pathOverride ...string) error {
 	configPath, err := Path(pathOverride...)
 	if err != nil {
 		return err
 	}
-	clone := *cfg
-	clone.ApplyDefaults()
-	if err := clone.Validate(); err != nil {
+	content, err := Render(cfg)
+	if err != nil {
 		return err
 	}
 
@@ -57,11 +103,15 @@ func Save(cfg *Config, pathOverride ...string) error {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return err
 	}
-	content, err := yaml.Marshal(&clone)
-	if err != nil {
+	if err := backupBeforeMigration(cfg, configPath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, content, 0o644); err != nil {
 		return err
 	}
-	return os.WriteFile(configPath, content, 0o644)
+	cfg.migrated = false
+	cfg.fileVersion = APIVersion
+	return nil
 }
 
 func Path(pathOverride ...string) (string, error) {
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"sigs.k8s.io/yaml"
@@ -96,6 +97,7 @@ func TestLoadWithOverridesWithoutConfigFile(t *testing.T) {
 		"platform.profile=small",
 		"platform.domain=lvh.me",
 		"platform.cilium.version=1.20.0",
+		"platform.flux.version=2.9.0",
 		"platform.flux.gitRepository.url=https://example.com/shoulders.git",
 		"platform.flux.gitRepository.branch=feature/config",
 		"platform.flux.pathPrefix=platform",
@@ -124,6 +126,9 @@ func TestLoadWithOverridesWithoutConfigFile(t *testing.T) {
 	if loaded.CiliumVersion() != "1.20.0" {
 		t.Fatalf("expected cilium version override, got %s", loaded.CiliumVersion())
 	}
+	if loaded.FluxVersion() != "v2.9.0" {
+		t.Fatalf("expected flux version override, got %s", loaded.FluxVersion())
+	}
 	if loaded.FluxRepositoryURL() != "https://example.com/shoulders.git" {
 		t.Fatalf("expected flux url override, got %s", loaded.FluxRepositoryURL())
 	}
@@ -275,4 +280,404 @@ func TestExampleYAMLIsValid(t *testing.T) {
 	if cfg.FluxPathPrefix() != "." {
 		t.Fatalf("expected default path prefix '.', got %s", cfg.FluxPathPrefix())
 	}
+	if cfg.Platform.Flux.Version != "" {
+		t.Fatalf("expected the example to leave the Flux version unpinned, got %s", cfg.Platform.Flux.Version)
+	}
+}
+
+func TestApplyDefaultsLeavesFluxVersionUnpinned(t *testing.T) {
+	cfg := DefaultConfig()
+	if cfg.Platform.Flux.Version != "" {
+		t.Fatalf("expected no Flux version to be stored, got %s", cfg.Platform.Flux.Version)
+	}
+	if cfg.FluxVersion() != DefaultFluxVersion {
+		t.Fatalf("expected the getter to resolve %s, got %s", DefaultFluxVersion, cfg.FluxVersion())
+	}
+}
+
+func TestCustomProfileInheritsBaseAndOverridesComponents(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "missing.yaml")
+
+	loaded, err := LoadWithOverrides([]string{
+		"platform.profile=custom",
+		"platform.components.base=small",
+		"platform.components.eventStreams=true",
+		"platform.components.prometheusRetention=2d",
+	}, configPath)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	spec := loaded.ProfileSpec()
+	if spec.Name != ProfileCustom || spec.Base != ProfileSmall {
+		t.Fatalf("expected custom profile on small base, got %s/%s", spec.Name, spec.Base)
+	}
+	if !spec.EventStreams {
+		t.Fatalf("expected event streams override to be applied")
+	}
+	if spec.Falco {
+		t.Fatalf("expected falco to inherit disabled from small base")
+	}
+	if spec.PrometheusRetention != "2d" || spec.PrometheusSize != "512MiB" {
+		t.Fatalf("expected retention override with inherited size, got %s/%s", spec.PrometheusRetention, spec.PrometheusSize)
+	}
+}
+
+func TestCustomProfileValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "missing.yaml")
+
+	for _, overrides := range [][]string{
+		{"platform.profile=custom", "platform.components.base=huge"},
+		{"platform.profile=custom", "platform.components.kafkaReplicas=1", "platform.components.kafkaMinISR=2"},
+		{"platform.profile=custom", "platform.components.kafkaReplicas=-1"},
+	} {
+		if _, err := LoadWithOverrides(overrides, configPath); err == nil {
+			t.Fatalf("expected overrides %v to fail validation", overrides)
+		}
+	}
+}
+
+func TestLoadAddons(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "shoulders.yaml")
+	content := "platform:\n" +
+		"  addons:\n" +
+		"    - name: cert-manager\n" +
+		"      source: {type: helm, url: https://charts.jetstack.io}\n" +
+		"      chart: cert-manager\n" +
+		"      values: {crds: {enabled: true}}\n" +
+		"      dependsOn: [helm-releases]\n" +
+		"    - name: internal\n" +
+		"      source: {type: git, url: https://example.com/internal.git, ref: main}\n" +
+		"      path: ./deploy\n" +
+		"      dependsOn: [cert-manager]\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	loaded, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	addons := loaded.Addons()
+	if len(addons) != 2 || addons[0].Chart != "cert-manager" || addons[1].Path != "./deploy" {
+		t.Fatalf("unexpected addons: %+v", addons)
+	}
+}
+
+func TestValidateAddons(t *testing.T) {
+	valid := AddonConfig{Name: "extra", Source: AddonSource{Type: AddonSourceGit, URL: "https://example.com/extra.git"}}
+	if err := ValidateAddons([]AddonConfig{valid}); err != nil {
+		t.Fatalf("expected addon to be valid: %v", err)
+	}
+
+	for name, addons := range map[string][]AddonConfig{
+		"unknown type":       {{Name: "extra", Source: AddonSource{Type: "s3", URL: "s3://bucket"}}},
+		"missing chart":      {{Name: "extra", Source: AddonSource{Type: AddonSourceHelm, URL: "https://charts.example.com"}}},
+		"builtin name":       {{Name: "helm-releases", Source: valid.Source}},
+		"unknown dependency": {{Name: "extra", Source: valid.Source, DependsOn: []string{"missing"}}},
+		"nested git value":   {{Name: "extra", Source: valid.Source, Values: map[string]interface{}{"key": map[string]interface{}{}}}},
+		"duplicate":          {valid, valid},
+	} {
+		if err := ValidateAddons(addons); err == nil {
+			t.Fatalf("expected %s to fail validation", name)
+		}
+	}
+}
+
+func TestEnvironmentsSelectAndSaveBack(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "shoulders.yaml")
+	content := "current_environment: staging\n" +
+		"current_workspace: local-team\n" +
+		"cluster:\n" +
+		"  name: dev\n" +
+		"environments:\n" +
+		"  staging:\n" +
+		"    current_workspace: team-a\n" +
+		"    cluster:\n" +
+		"      provider: existing\n" +
+		"      context: staging-admin\n" +
+		"    platform:\n" +
+		"      profile: large\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	loaded, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if loaded.Environment() != "staging" || loaded.Provider() != ProviderExisting || loaded.CurrentWorkspace != "team-a" || loaded.Profile() != ProfileLarge {
+		t.Fatalf("expected staging settings to be active, got %s/%s/%s/%s", loaded.Environment(), loaded.Provider(), loaded.CurrentWorkspace, loaded.Profile())
+	}
+
+	loaded.CurrentWorkspace = "team-b"
+	if err := Save(loaded, configPath); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	defaults, err := LoadEnvironment(DefaultEnvironment, nil, configPath)
+	if err != nil {
+		t.Fatalf("load default environment: %v", err)
+	}
+	if defaults.CurrentWorkspace != "local-team" || defaults.ClusterName() != "dev" || defaults.Provider() != ProviderVind {
+		t.Fatalf("expected top-level settings to be preserved, got %+v", defaults.Cluster)
+	}
+	staging, err := defaults.ForEnvironment("staging")
+	if err != nil {
+		t.Fatalf("resolve staging: %v", err)
+	}
+	if staging.CurrentWorkspace != "team-b" {
+		t.Fatalf("expected staging workspace to be saved back, got %q", staging.CurrentWorkspace)
+	}
+	if _, err := defaults.ForEnvironment("prod"); err == nil {
+		t.Fatalf("expected unknown environment to fail")
+	}
+}
+
+func TestKeyPathsSetGetUnset(t *testing.T) {
+	cfg := &Config{}
+	entries := map[string]string{
+		"platform.components.eventStreams":      "false",
+		"platform.addons[0].name":               "cert-manager",
+		"platform.addons.0.values.crds.enabled": "true",
+		"platform.addons.0.dependsOn":           "[cilium, flux-system]",
+		"environments.staging.cluster.context":  "staging-admin",
+	}
+	for key, value := range entries {
+		if err := SetValue(cfg, key, value); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+
+	if enabled, err := GetValue(cfg, "platform.components.eventStreams"); err != nil || *enabled.(*bool) {
+		t.Fatalf("expected eventStreams=false, got %v (%v)", enabled, err)
+	}
+	if context, err := GetValue(cfg, "environments.staging.cluster.context"); err != nil || context != "staging-admin" {
+		t.Fatalf("expected staging context, got %v (%v)", context, err)
+	}
+	if crds, err := GetValue(cfg, "platform.addons.0.values.crds.enabled"); err != nil || crds != true {
+		t.Fatalf("expected nested addon value, got %v (%v)", crds, err)
+	}
+	if len(cfg.Platform.Addons) != 1 || len(cfg.Platform.Addons[0].DependsOn) != 2 {
+		t.Fatalf("expected one addon with two dependencies, got %+v", cfg.Platform.Addons)
+	}
+
+	leaves := Leaves(cfg)
+	if leaves["platform.addons.0.dependsOn.1"] != "flux-system" || leaves["platform.components.eventStreams"] != "false" {
+		t.Fatalf("unexpected leaves: %v", leaves)
+	}
+
+	if err := UnsetValue(cfg, "environments.staging"); err != nil {
+		t.Fatalf("unset environment: %v", err)
+	}
+	if _, ok := cfg.Environments["staging"]; ok {
+		t.Fatalf("expected staging environment to be removed")
+	}
+	if err := UnsetValue(cfg, "platform.addons.0"); err != nil {
+		t.Fatalf("unset addon: %v", err)
+	}
+	if len(cfg.Platform.Addons) != 0 {
+		t.Fatalf("expected addon to be removed, got %+v", cfg.Platform.Addons)
+	}
+
+	for _, key := range []string{"platform.unknown", "platform.addons.3.name", "cluster..name"} {
+		if err := SetValue(cfg, key, "x"); err == nil {
+			t.Fatalf("expected %s to fail", key)
+		}
+	}
+}
+
+func TestLoadRecordsOrigins(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "shoulders.yaml")
+	if err := os.WriteFile(configPath, []byte("cluster:\n  name: from-file\nplatform:\n  profile: small\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	loaded, err := LoadWithOverrides([]string{"platform.profile=large"}, configPath)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	expected := map[string]Origin{
+		"cluster.name":     OriginFile,
+		"platform.profile": OriginFlag,
+		"cluster.provider": OriginDefault,
+	}
+	for key, origin := range expected {
+		if loaded.Origin(key) != origin {
+			t.Fatalf("expected %s from %s, got %q", key, origin, loaded.Origin(key))
+		}
+	}
+}
+
+func TestEnvVarName(t *testing.T) {
+	cases := map[string]string{
+		"platform.profile":                      "SHOULDERS_PLATFORM_PROFILE",
+		"current_workspace":                     "SHOULDERS_CURRENT_WORKSPACE",
+		"platform.components.eventStreams":      "SHOULDERS_PLATFORM_COMPONENTS_EVENT_STREAMS",
+		"platform.components.hubbleUI":          "SHOULDERS_PLATFORM_COMPONENTS_HUBBLE_UI",
+		"platform.flux.gitRepository.url":       "SHOULDERS_PLATFORM_FLUX_GIT_REPOSITORY_URL",
+		"platform.components.kafkaMinISR":       "SHOULDERS_PLATFORM_COMPONENTS_KAFKA_MIN_ISR",
+		"platform.components.postgresInstances": "SHOULDERS_PLATFORM_COMPONENTS_POSTGRES_INSTANCES",
+	}
+	for key, expected := range cases {
+		if got := EnvVarName(key); got != expected {
+			t.Fatalf("expected %s for %s, got %s", expected, key, got)
+		}
+	}
+}
+
+func TestLoadLayersEnvironmentVariables(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "shoulders.yaml")
+	if err := os.WriteFile(configPath, []byte("cluster:\n  name: from-file\nplatform:\n  profile: large\n  domain: file.example\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	t.Setenv("SHOULDERS_PLATFORM_PROFILE", "small")
+	t.Setenv("SHOULDERS_CLUSTER_PROVIDER", "existing")
+	t.Setenv("SHOULDERS_PLATFORM_DOMAIN", "env.example")
+
+	loaded, err := LoadWithOverrides([]string{"platform.domain=flag.example"}, configPath)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.Profile() != ProfileSmall || loaded.Provider() != ProviderExisting {
+		t.Fatalf("expected env values to override the file, got %s/%s", loaded.Profile(), loaded.Provider())
+	}
+	if loaded.Domain() != "flag.example" {
+		t.Fatalf("expected --set to override env, got %s", loaded.Domain())
+	}
+	if loaded.ClusterName() != "from-file" || loaded.Origin("cluster.name") != OriginFile {
+		t.Fatalf("expected cluster name from file, got %s (%s)", loaded.ClusterName(), loaded.Origin("cluster.name"))
+	}
+	if loaded.Origin("platform.profile") != OriginEnv || loaded.Origin("platform.domain") != OriginFlag {
+		t.Fatalf("unexpected origins: profile=%s domain=%s", loaded.Origin("platform.profile"), loaded.Origin("platform.domain"))
+	}
+
+	saved, err := LoadFile("", configPath)
+	if err != nil {
+		t.Fatalf("load file failed: %v", err)
+	}
+	if saved.Platform.Profile != "large" {
+		t.Fatalf("expected LoadFile to ignore env overrides, got %s", saved.Platform.Profile)
+	}
+}
+
+func TestLoadMapsKubeconfigAliasThroughEnvLayer(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "shoulders.yaml")
+	if err := os.WriteFile(configPath, []byte("cluster:\n  kubeconfig: /from/file\n"), 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	t.Setenv("SHOULDERS_KUBECONFIG", "/from/alias")
+
+	loaded, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.Cluster.Kubeconfig != "/from/alias" || loaded.Origin("cluster.kubeconfig") != OriginEnv {
+		t.Fatalf("expected SHOULDERS_KUBECONFIG to override the file, got %s (%s)", loaded.Cluster.Kubeconfig, loaded.Origin("cluster.kubeconfig"))
+	}
+	if source := envSource("cluster.kubeconfig"); source != "SHOULDERS_KUBECONFIG" {
+		t.Fatalf("expected the alias to be reported as the source, got %s", source)
+	}
+
+	loaded, err = LoadWithOverrides([]string{"cluster.kubeconfig=/from/flag"}, configPath)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.Cluster.Kubeconfig != "/from/flag" {
+		t.Fatalf("expected --set to override SHOULDERS_KUBECONFIG, got %s", loaded.Cluster.Kubeconfig)
+	}
+
+	t.Setenv("SHOULDERS_CLUSTER_KUBECONFIG", "/from/env")
+	loaded, err = Load(configPath)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.Cluster.Kubeconfig != "/from/env" || envSource("cluster.kubeconfig") != "SHOULDERS_CLUSTER_KUBECONFIG" {
+		t.Fatalf("expected SHOULDERS_CLUSTER_KUBECONFIG to win over the alias, got %s", loaded.Cluster.Kubeconfig)
+	}
+}
+
+func TestValidateReportsValueSource(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "missing.yaml")
+	t.Setenv("SHOULDERS_PLATFORM_PROFILE", "huge")
+
+	_, err := Load(configPath)
+	if err == nil || !strings.Contains(err.Error(), "SHOULDERS_PLATFORM_PROFILE") {
+		t.Fatalf("expected error naming the env variable, got %v", err)
+	}
+	_, err = LoadWithOverrides([]string{"platform.profile=small", "cluster.provider=cloud"}, configPath)
+	if err == nil || !strings.Contains(err.Error(), "--set cluster.provider") {
+		t.Fatalf("expected error naming the --set flag, got %v", err)
+	}
+	t.Setenv("SHOULDERS_PLATFORM_COMPONENTS_EVENT_STREAMS", "maybe")
+	if _, err := Load(configPath); err == nil || !strings.Contains(err.Error(), "SHOULDERS_PLATFORM_COMPONENTS_EVENT_STREAMS") {
+		t.Fatalf("expected parse error naming the env variable, got %v", err)
+	}
+}
+
+func TestLoadMigratesUnversionedFileAndBacksUpOnSave(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "shoulders.yaml")
+	original := []byte("current_workspace: team-a\nplatform:\n  profile: small\n")
+	if err := os.WriteFile(configPath, original, 0o644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	loaded, err := LoadFile("", configPath)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !loaded.NeedsMigration() || loaded.FileAPIVersion() != "" {
+		t.Fatalf("expected unversioned file to need migration, got %q", loaded.FileAPIVersion())
+	}
+	if loaded.CurrentWorkspace != "team-a" || loaded.Platform.Profile != ProfileSmall {
+		t.Fatalf("expected values to survive migration, got %+v", loaded)
+	}
+
+	if err := Save(loaded, configPath); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	backup, err := os.ReadFile(BackupPath(configPath, ""))
+	if err != nil {
+		t.Fatalf("expected backup before migration: %v", err)
+	}
+	if string(backup) != string(original) {
+		t.Fatalf("expected backup to hold the original file, got %q", backup)
+	}
+	saved, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !strings.HasPrefix(string(saved), "apiVersion: "+APIVersion+"\nkind: "+Kind+"\n") {
+		t.Fatalf("expected versioned header, got %q", saved)
+	}
+
+	reloaded, err := LoadFile("", configPath)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if reloaded.NeedsMigration() {
+		t.Fatalf("expected saved file to be current")
+	}
+}
+
+func TestLoadRejectsUnknownSchema(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "shoulders.yaml")
+	documents := map[string]string{
+		"newer version": "apiVersion: config.shoulders.io/v9\nkind: Config\n",
+		"other kind":    "apiVersion: " + APIVersion + "\nkind: Workspace\n",
+	}
+	for name, content := range documents {
+		if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if _, err := Load(configPath); err == nil {
+			t.Fatalf("expected %s to fail", name)
+		}
+	}
 }
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix prefixes the environment variables that override config keys,
+// for example SHOULDERS_PLATFORM_PROFILE for platform.profile.
+const EnvPrefix = "SHOULDERS_"
+
+const currentEnvironmentKey = "current_environment"
+
+// envAliases lists shorter variables that also override a key. The variable
+// from EnvVarName wins when both are set.
+var envAliases = map[string]string{
+	"cluster.kubeconfig": EnvPrefix + "KUBECONFIG",
+}
+
+// EnvVarName returns the environment variable that overrides key. Segments
+// are joined with underscores and camelCase names are split, so
+// platform.components.eventStreams maps to
+// SHOULDERS_PLATFORM_COMPONENTS_EVENT_STREAMS.
+func EnvVarName(key string) string {
+	var name strings.Builder
+	name.WriteString(EnvPrefix)
+	runes := []rune(key)
+	for index, current := range runes {
+		switch {
+		case current == '.' || current == '-':
+			name.WriteRune('_')
+			continue
+		case unicode.IsUpper(current) && index > 0:
+			previous := runes[index-1]
+			nextIsLower := index+1 < len(runes) && unicode.IsLower(runes[index+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				name.WriteRune('_')
+			}
+		}
+		name.WriteRune(unicode.ToUpper(current))
+	}
+	return name.String()
+}
+
+// EnvOverrides returns key=value entries for every config key whose
+// environment variable is set to a non-empty value. Lists and maps such as
+// SHOULDERS_PLATFORM_ADDONS take a YAML value. current_environment is left
+// out because it selects the environment before overrides apply.
+func EnvOverrides() []string {
+	entries := []string{}
+	for _, key := range KeyPaths() {
+		if key == currentEnvironmentKey {
+			continue
+		}
+		if value, _ := envValue(key); value != "" {
+			entries = append(entries, key+"="+value)
+		}
+	}
+	return entries
+}
+
+// envValue returns the trimmed value overriding key and the variable that
+// supplied it.
+func envValue(key string) (string, string) {
+	for _, name := range []string{EnvVarName(key), envAliases[key]} {
+		if name == "" {
+			continue
+		}
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return value, name
+		}
+	}
+	return "", EnvVarName(key)
+}
+
+// envSource names the variable that overrides key, or the list or map that
+// contains it.
+func envSource(key string) string {
+	_, name := envValue(envKey(key))
+	return name
+}
+
+// envKey returns the key path whose environment variable covers key, which
+// is key itself or the list or map that contains it.
+func envKey(key string) string {
+	match := key
+	for _, candidate := range KeyPaths() {
+		if key == candidate {
+			return key
+		}
+		if strings.HasPrefix(key, candidate+".") {
+			match = candidate
+		}
+	}
+	return match
+}
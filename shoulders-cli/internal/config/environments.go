@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultEnvironment names the cluster and platform settings stored at the
+// top level of the config file.
+const DefaultEnvironment = "default"
+
+// EnvironmentConfig is a named set of cluster and platform settings, such as
+// a local vind cluster for dev and an existing cluster for staging.
+type EnvironmentConfig struct {
+	CurrentWorkspace string         `yaml:"current_workspace,omitempty" json:"current_workspace,omitempty"`
+	Cluster          ClusterConfig  `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+	Platform         PlatformConfig `yaml:"platform,omitempty" json:"platform,omitempty"`
+}
+
+// Environment returns the name of the active environment.
+func (cfg *Config) Environment() string {
+	if cfg == nil || cfg.environment == "" {
+		return DefaultEnvironment
+	}
+	return cfg.environment
+}
+
+// EnvironmentNames returns the default environment followed by the named
+// environments in alphabetical order.
+func (cfg *Config) EnvironmentNames() []string {
+	names := []string{DefaultEnvironment}
+	if cfg == nil {
+		return names
+	}
+	named := make([]string, 0, len(cfg.Environments))
+	for name := range cfg.Environments {
+		named = append(named, name)
+	}
+	sort.Strings(named)
+	return append(names, named...)
+}
+
+// UseEnvironment makes the settings of the named environment the active
+// top-level settings. Saving the config writes them back to the environment.
+func (cfg *Config) UseEnvironment(name string) error {
+	file := cfg.fileView()
+	name = strings.TrimSpace(name)
+	if name == "" || name == DefaultEnvironment {
+		*cfg = file
+		return nil
+	}
+	env, ok := file.Environments[name]
+	if !ok {
+		return fmt.Errorf("unknown environment %q (available: %s)", name, strings.Join(file.EnvironmentNames(), ", "))
+	}
+	*cfg = file
+	cfg.root = cfg.activeSettings()
+	cfg.setActiveSettings(env)
+	cfg.environment = name
+	return nil
+}
+
+// ForEnvironment returns a copy of the config with the named environment
+// active and defaults applied, leaving cfg untouched.
+func (cfg *Config) ForEnvironment(name string) (*Config, error) {
+	view := cfg.fileView()
+	if err := view.UseEnvironment(name); err != nil {
+		return nil, err
+	}
+	view.ApplyDefaults()
+	if err := view.Validate(); err != nil {
+		return nil, fmt.Errorf("environment %s: %w", view.Environment(), err)
+	}
+	return &view, nil
+}
+
+// fileView returns the config as it is stored on disk, with the active
+// environment's settings moved back under environments.
+func (cfg *Config) fileView() Config {
+	view := *cfg
+	if cfg.environment == "" {
+		return view
+	}
+	view.Environments = make(map[string]EnvironmentConfig, len(cfg.Environments))
+	for name, env := range cfg.Environments {
+		view.Environments[name] = env
+	}
+	view.Environments[cfg.environment] = cfg.activeSettings()
+	view.setActiveSettings(cfg.root)
+	view.environment = ""
+	view.root = EnvironmentConfig{}
+	return view
+}
+
+func (cfg *Config) activeSettings() EnvironmentConfig {
+	return EnvironmentConfig{
+		CurrentWorkspace: cfg.CurrentWorkspace,
+		Cluster:          cfg.Cluster,
+		Platform:         cfg.Platform,
+	}
+}
+
+func (cfg *Config) setActiveSettings(env EnvironmentConfig) {
+	cfg.CurrentWorkspace = env.CurrentWorkspace
+	cfg.Cluster = env.Cluster
+	cfg.Platform = env.Platform
+}
+
+func validateEnvironmentNames(environments map[string]EnvironmentConfig) error {
+	for name := range environments {
+		if name == DefaultEnvironment {
+			return fmt.Errorf("environment name %q is reserved for the top-level settings", name)
+		}
+		if !dnsLabelPattern.MatchString(name) {
+			return fmt.Errorf("environment %q: name must be a lowercase DNS label", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the config file schema written by this CLI.
+	APIVersion = "config.shoulders.io/v1alpha1"
+	// Kind identifies a Shoulders config file.
+	Kind = "Config"
+)
+
+// migration upgrades a config document from one apiVersion to the next.
+type migration struct {
+	from    string
+	to      string
+	migrate func(doc map[string]interface{}) error
+}
+
+// migrations is the upgrade chain, oldest first. Add a step whenever a key
+// moves or changes meaning and point APIVersion at its target, so older
+// files keep their values instead of silently dropping them.
+var migrations = []migration{
+	{
+		// Files written before the header existed already use the
+		// v1alpha1 layout; they only gain apiVersion and kind.
+		from:    "",
+		to:      "config.shoulders.io/v1alpha1",
+		migrate: func(map[string]interface{}) error { return nil },
+	},
+}
+
+// VersionLabel names a config file version for messages and backup files.
+func VersionLabel(apiVersion string) string {
+	if apiVersion == "" {
+		return "unversioned"
+	}
+	return apiVersion
+}
+
+// NeedsMigration reports whether the file cfg was read from uses an older
+// schema. Saving cfg writes a backup of that file first.
+func (cfg *Config) NeedsMigration() bool {
+	return cfg != nil && cfg.migrated
+}
+
+// FileAPIVersion returns the apiVersion of the file cfg was read from.
+func (cfg *Config) FileAPIVersion() string {
+	if !cfg.NeedsMigration() {
+		return APIVersion
+	}
+	return cfg.fileVersion
+}
+
+// BackupPath returns where the pre-migration copy of configPath is kept.
+func BackupPath(configPath, apiVersion string) string {
+	label := VersionLabel(apiVersion)
+	if index := strings.LastIndex(label, "/"); index >= 0 {
+		label = label[index+1:]
+	}
+	return configPath + "." + label + ".bak"
+}
+
+// migrateDocument upgrades doc in place to APIVersion and returns the
+// version it started at. The apiVersion and kind header is removed.
+func migrateDocument(doc map[string]interface{}) (string, error) {
+	if kind, ok := doc["kind"]; ok && kind != Kind {
+		return "", fmt.Errorf("config file kind %v is not %s", kind, Kind)
+	}
+	from := ""
+	if value, ok := doc["apiVersion"]; ok {
+		version, isString := value.(string)
+		if !isString || version == "" {
+			return "", fmt.Errorf("config file apiVersion must be a string")
+		}
+		from = version
+	}
+
+	version := from
+	for version != APIVersion {
+		step, ok := migrationFrom(version)
+		if !ok {
+			return "", fmt.Errorf("unsupported config apiVersion %q (this CLI reads up to %s; run 'shoulders update')", version, APIVersion)
+		}
+		if err := step.migrate(doc); err != nil {
+			return "", fmt.Errorf("migrate config from %s to %s: %w", VersionLabel(step.from), step.to, err)
+		}
+		version = step.to
+	}
+	delete(doc, "apiVersion")
+	delete(doc, "kind")
+	return from, nil
+}
+
+func migrationFrom(version string) (migration, bool) {
+	for _, step := range migrations {
+		if step.from == version {
+			return step, true
+		}
+	}
+	return migration{}, false
+}
+
+// decodeFile migrates a config file to APIVersion and decodes it into cfg.
+func decodeFile(data []byte, cfg *Config) error {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc) == 0 {
+		return nil
+	}
+	from, err := migrateDocument(doc)
+	if err != nil {
+		return err
+	}
+	migrated, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(migrated, cfg); err != nil {
+		return err
+	}
+	cfg.fileVersion = from
+	cfg.migrated = from != APIVersion
+	return nil
+}
+
+// Render returns the file content Save writes for cfg: the apiVersion and
+// kind header followed by the file view of cfg with defaults applied.
+func Render(cfg *Config) ([]byte, error) {
+	clone := cfg.fileView()
+	clone.ApplyDefaults()
+	if err := clone.Validate(); err != nil {
+		return nil, err
+	}
+	content, err := yaml.Marshal(&clone)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("apiVersion: %s\nkind: %s\n", APIVersion, Kind)
+	return append([]byte(header), content...), nil
+}
+
+// backupBeforeMigration copies configPath aside when cfg was read from an
+// older schema, so a migration never loses the original file.
+func backupBeforeMigration(cfg *Config, configPath string) error {
+	if !cfg.NeedsMigration() {
+		return nil
+	}
+	original, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	backup := BackupPath(configPath, cfg.fileVersion)
+	if err := os.WriteFile(backup, original, 0o600); err != nil {
+		return fmt.Errorf("back up config before migration: %w", err)
+	}
+	return nil
+}
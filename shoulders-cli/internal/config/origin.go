@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Origin names the layer that supplied a config value.
+type Origin string
+
+const (
+	OriginDefault Origin = "default"
+	OriginFile    Origin = "file"
+	OriginEnv     Origin = "env"
+	OriginFlag    Origin = "flag"
+)
+
+// Origin reports which layer supplied the value at key. Keys that were never
+// set report an empty origin.
+func (cfg *Config) Origin(key string) Origin {
+	if cfg == nil {
+		return ""
+	}
+	return cfg.origins[key]
+}
+
+// recordOrigins attributes every value that differs from before to origin.
+func (cfg *Config) recordOrigins(before map[string]string, origin Origin) {
+	if cfg.origins == nil {
+		cfg.origins = map[string]Origin{}
+	}
+	for key, value := range Leaves(cfg) {
+		if previous, ok := before[key]; !ok || previous != value {
+			cfg.origins[key] = origin
+		}
+	}
+}
+
+// originPrecedence orders origins from the weakest to the strongest layer.
+var originPrecedence = map[Origin]int{OriginDefault: 1, OriginFile: 2, OriginEnv: 3, OriginFlag: 4}
+
+// attribute adds the source of the value at key to err. When key names a
+// list, map or struct, the strongest origin among its values is reported.
+func (cfg *Config) attribute(key string, err error) error {
+	if err == nil || cfg == nil {
+		return err
+	}
+	sourceKey, origin := key, cfg.origins[key]
+	for candidate, candidateOrigin := range cfg.origins {
+		if strings.HasPrefix(candidate, key+".") && originPrecedence[candidateOrigin] > originPrecedence[origin] {
+			sourceKey, origin = candidate, candidateOrigin
+		}
+	}
+	switch origin {
+	case OriginFile:
+		return fmt.Errorf("%w (from the config file)", err)
+	case OriginEnv:
+		return fmt.Errorf("%w (from %s)", err, envSource(sourceKey))
+	case OriginFlag:
+		return fmt.Errorf("%w (from --set %s)", err, sourceKey)
+	default:
+		return err
+	}
+}
@@ -2,10 +2,11 @@ package config
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 )
 
+// ApplyOverrides applies key=value entries from --set through the same key
+// path engine as 'shoulders config set'.
 func ApplyOverrides(cfg *Config, entries []string) error {
 	if cfg == nil {
 		return fmt.Errorf("config override target is nil")
@@ -15,58 +16,15 @@ func ApplyOverrides(cfg *Config, entries []string) error {
 		if err != nil {
 			return err
 		}
-
-		switch key {
-		case "current_workspace":
-			cfg.CurrentWorkspace = value
-		case "cluster.provider":
-			cfg.Cluster.Provider = value
-		case "cluster.name":
-			cfg.Cluster.Name = value
-		case "cluster.kubeconfig":
-			cfg.Cluster.Kubeconfig = value
-		case "cluster.context":
-			cfg.Cluster.Context = value
-		case "platform.profile":
-			cfg.Platform.Profile = value
-		case "platform.domain":
-			cfg.Platform.Domain = value
-		case "platform.cilium.enabled":
-			enabled, err := parseBoolOverride(key, value)
-			if err != nil {
-				return err
-			}
-			cfg.Platform.Cilium.Enabled = &enabled
-		case "platform.cilium.version":
-			cfg.Platform.Cilium.Version = value
-		case "platform.flux.gitRepository.url":
-			cfg.Platform.Flux.GitRepository.URL = value
-		case "platform.flux.gitRepository.branch":
-			cfg.Platform.Flux.GitRepository.Branch = value
-		case "platform.flux.pathPrefix":
-			cfg.Platform.Flux.PathPrefix = value
-		default:
-			return unsupportedOverrideKeyError(key)
+		if err := SetValue(cfg, key, value); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 func SupportedOverrideKeys() []string {
-	return []string{
-		"current_workspace",
-		"cluster.provider",
-		"cluster.name",
-		"cluster.kubeconfig",
-		"cluster.context",
-		"platform.profile",
-		"platform.domain",
-		"platform.cilium.enabled",
-		"platform.cilium.version",
-		"platform.flux.gitRepository.url",
-		"platform.flux.gitRepository.branch",
-		"platform.flux.pathPrefix",
-	}
+	return KeyPaths()
 }
 
 func parseOverride(entry string) (string, string, error) {
@@ -80,15 +38,3 @@ func parseOverride(entry string) (string, string, error) {
 	}
 	return key, strings.TrimSpace(value), nil
 }
-
-func parseBoolOverride(key, value string) (bool, error) {
-	parsed, err := strconv.ParseBool(value)
-	if err != nil {
-		return false, fmt.Errorf("invalid boolean value %q for config override %q", value, key)
-	}
-	return parsed, nil
-}
-
-func unsupportedOverrideKeyError(key string) error {
-	return fmt.Errorf("unsupported config override %q (supported: %s)", key, strings.Join(SupportedOverrideKeys(), ", "))
-}
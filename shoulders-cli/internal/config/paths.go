@@ -0,0 +1,364 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config keys are dot-separated paths built from the yaml tags of Config,
+// for example "platform.flux.gitRepository.url". Map entries use their key
+// ("environments.staging.cluster.provider") and list items their index
+// ("platform.addons.0.name" or "platform.addons[0].name"). Setting the index
+// just past the end of a list appends an item.
+
+// GetValue returns the value stored at key.
+func GetValue(cfg *Config, key string) (interface{}, error) {
+	segments, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	value, err := getPath(reflect.ValueOf(cfg).Elem(), segments, key)
+	if err != nil {
+		return nil, err
+	}
+	return value.Interface(), nil
+}
+
+// SetValue parses raw for the type stored at key and assigns it. Strings are
+// taken verbatim, booleans and numbers are parsed, and lists, objects and
+// free-form values are parsed as YAML.
+func SetValue(cfg *Config, key, raw string) error {
+	segments, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	return setPath(reflect.ValueOf(cfg).Elem(), segments, key, raw)
+}
+
+// UnsetValue clears the value at key. Map entries and list items are removed.
+func UnsetValue(cfg *Config, key string) error {
+	segments, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	return unsetPath(reflect.ValueOf(cfg).Elem(), segments, key)
+}
+
+// KeyPaths lists the keys reachable through Config's fields. Lists, maps and
+// free-form values are listed once and accept a YAML value.
+func KeyPaths() []string {
+	paths := []string{}
+	collectKeyPaths(reflect.TypeOf(Config{}), "", &paths)
+	return paths
+}
+
+// Leaves flattens cfg into key/value pairs for every set scalar, sorted by
+// key.
+func Leaves(cfg *Config) map[string]string {
+	leaves := map[string]string{}
+	flatten(reflect.ValueOf(cfg).Elem(), "", leaves)
+	return leaves
+}
+
+// SortedKeys returns the keys of leaves in order.
+func SortedKeys(leaves map[string]string) []string {
+	keys := make([]string, 0, len(leaves))
+	for key := range leaves {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitKey(key string) ([]string, error) {
+	normalized := strings.NewReplacer("[", ".", "]", "").Replace(strings.TrimSpace(key))
+	segments := strings.Split(normalized, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid config key %q", key)
+		}
+	}
+	return segments, nil
+}
+
+func unknownKeyError(key string) error {
+	return fmt.Errorf("unsupported config key %q (supported: %s)", key, strings.Join(KeyPaths(), ", "))
+}
+
+func fieldByKey(value reflect.Value, name string) (reflect.Value, bool) {
+	valueType := value.Type()
+	for index := 0; index < valueType.NumField(); index++ {
+		field := valueType.Field(index)
+		if field.PkgPath != "" {
+			continue
+		}
+		if fieldKey(field) == name {
+			return value.Field(index), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func fieldKey(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func sliceIndex(value reflect.Value, segment, key string, allowAppend bool) (int, error) {
+	index, err := strconv.Atoi(segment)
+	limit := value.Len()
+	if allowAppend {
+		limit++
+	}
+	if err != nil || index < 0 || index >= limit {
+		return 0, fmt.Errorf("config key %q: invalid list index %q (list has %d items)", key, segment, value.Len())
+	}
+	return index, nil
+}
+
+func getPath(value reflect.Value, segments []string, key string) (reflect.Value, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return reflect.Value{}, fmt.Errorf("config key %q is not set", key)
+		}
+		return getPath(value.Elem(), segments, key)
+	case reflect.Struct:
+		field, ok := fieldByKey(value, segments[0])
+		if !ok {
+			return reflect.Value{}, unknownKeyError(key)
+		}
+		return getPath(field, segments[1:], key)
+	case reflect.Map:
+		entry := value.MapIndex(reflect.ValueOf(segments[0]).Convert(value.Type().Key()))
+		if !entry.IsValid() {
+			return reflect.Value{}, fmt.Errorf("config key %q is not set", key)
+		}
+		return getPath(entry, segments[1:], key)
+	case reflect.Slice:
+		index, err := sliceIndex(value, segments[0], key, false)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return getPath(value.Index(index), segments[1:], key)
+	default:
+		return reflect.Value{}, unknownKeyError(key)
+	}
+}
+
+func setPath(value reflect.Value, segments []string, key, raw string) error {
+	if len(segments) == 0 {
+		return assignValue(value, key, raw)
+	}
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return setPath(value.Elem(), segments, key, raw)
+	case reflect.Interface:
+		// Free-form values (addon values) grow nested maps on demand.
+		inner := value.Elem()
+		if !inner.IsValid() || inner.Kind() != reflect.Map {
+			inner = reflect.ValueOf(map[string]interface{}{})
+		}
+		nested := reflect.New(inner.Type()).Elem()
+		nested.Set(inner)
+		if err := setPath(nested, segments, key, raw); err != nil {
+			return err
+		}
+		value.Set(nested)
+		return nil
+	case reflect.Struct:
+		field, ok := fieldByKey(value, segments[0])
+		if !ok {
+			return unknownKeyError(key)
+		}
+		return setPath(field, segments[1:], key, raw)
+	case reflect.Map:
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+		mapKey := reflect.ValueOf(segments[0]).Convert(value.Type().Key())
+		// Map entries are not addressable, so update a copy and store it.
+		entry := reflect.New(value.Type().Elem()).Elem()
+		if existing := value.MapIndex(mapKey); existing.IsValid() {
+			entry.Set(existing)
+		}
+		if err := setPath(entry, segments[1:], key, raw); err != nil {
+			return err
+		}
+		value.SetMapIndex(mapKey, entry)
+		return nil
+	case reflect.Slice:
+		index, err := sliceIndex(value, segments[0], key, true)
+		if err != nil {
+			return err
+		}
+		if index == value.Len() {
+			value.Set(reflect.Append(value, reflect.Zero(value.Type().Elem())))
+		}
+		return setPath(value.Index(index), segments[1:], key, raw)
+	default:
+		return unknownKeyError(key)
+	}
+}
+
+func unsetPath(value reflect.Value, segments []string, key string) error {
+	if len(segments) == 0 {
+		value.Set(reflect.Zero(value.Type()))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
+		return unsetPath(value.Elem(), segments, key)
+	case reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		inner := reflect.New(value.Elem().Type()).Elem()
+		inner.Set(value.Elem())
+		if err := unsetPath(inner, segments, key); err != nil {
+			return err
+		}
+		value.Set(inner)
+		return nil
+	case reflect.Struct:
+		field, ok := fieldByKey(value, segments[0])
+		if !ok {
+			return unknownKeyError(key)
+		}
+		return unsetPath(field, segments[1:], key)
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		mapKey := reflect.ValueOf(segments[0]).Convert(value.Type().Key())
+		existing := value.MapIndex(mapKey)
+		if !existing.IsValid() {
+			return nil
+		}
+		if len(segments) == 1 {
+			value.SetMapIndex(mapKey, reflect.Value{})
+			return nil
+		}
+		entry := reflect.New(value.Type().Elem()).Elem()
+		entry.Set(existing)
+		if err := unsetPath(entry, segments[1:], key); err != nil {
+			return err
+		}
+		value.SetMapIndex(mapKey, entry)
+		return nil
+	case reflect.Slice:
+		index, err := sliceIndex(value, segments[0], key, false)
+		if err != nil {
+			return err
+		}
+		if len(segments) == 1 {
+			value.Set(reflect.AppendSlice(value.Slice(0, index), value.Slice(index+1, value.Len())))
+			return nil
+		}
+		return unsetPath(value.Index(index), segments[1:], key)
+	default:
+		return unknownKeyError(key)
+	}
+}
+
+func assignValue(value reflect.Value, key, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean value %q for config key %q", raw, key)
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer value %q for config key %q", raw, key)
+		}
+		value.SetInt(parsed)
+	case reflect.Ptr:
+		target := reflect.New(value.Type().Elem())
+		if err := assignValue(target.Elem(), key, raw); err != nil {
+			return err
+		}
+		value.Set(target)
+	default:
+		target := reflect.New(value.Type())
+		if err := yaml.Unmarshal([]byte(raw), target.Interface()); err != nil {
+			return fmt.Errorf("invalid value %q for config key %q: %w", raw, key, err)
+		}
+		value.Set(target.Elem())
+	}
+	return nil
+}
+
+func collectKeyPaths(valueType reflect.Type, prefix string, paths *[]string) {
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	if valueType.Kind() != reflect.Struct {
+		*paths = append(*paths, prefix)
+		return
+	}
+	for index := 0; index < valueType.NumField(); index++ {
+		field := valueType.Field(index)
+		if field.PkgPath != "" {
+			continue
+		}
+		collectKeyPaths(field.Type, joinKey(prefix, fieldKey(field)), paths)
+	}
+}
+
+func flatten(value reflect.Value, prefix string, leaves map[string]string) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			flatten(value.Elem(), prefix, leaves)
+		}
+	case reflect.Struct:
+		for index := 0; index < value.NumField(); index++ {
+			field := value.Type().Field(index)
+			if field.PkgPath != "" {
+				continue
+			}
+			flatten(value.Field(index), joinKey(prefix, fieldKey(field)), leaves)
+		}
+	case reflect.Map:
+		for _, mapKey := range value.MapKeys() {
+			flatten(value.MapIndex(mapKey), joinKey(prefix, fmt.Sprint(mapKey.Interface())), leaves)
+		}
+	case reflect.Slice:
+		for index := 0; index < value.Len(); index++ {
+			flatten(value.Index(index), joinKey(prefix, strconv.Itoa(index)), leaves)
+		}
+	default:
+		if !value.IsZero() || value.Kind() == reflect.Bool {
+			leaves[prefix] = fmt.Sprint(value.Interface())
+		}
+	}
+}
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
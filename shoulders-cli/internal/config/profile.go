@@ -1,7 +1,12 @@
 package config
 
+import "fmt"
+
 type ProfileSpec struct {
-	Name                string
+	Name string
+	// Base is the built-in profile that provides the vind topology and the
+	// overlay defaults. It equals Name for small, medium and large.
+	Base                string
 	EventStreams        bool
 	PolicyReporter      bool
 	Trivy               bool
@@ -17,8 +22,93 @@ type ProfileSpec struct {
 	PrometheusSize      string
 }
 
+// ComponentsConfig selects individual platform components when
+// platform.profile is custom. Unset fields inherit from the base profile.
+type ComponentsConfig struct {
+	Base                string `yaml:"base,omitempty" json:"base,omitempty"`
+	EventStreams        *bool  `yaml:"eventStreams,omitempty" json:"eventStreams,omitempty"`
+	PolicyReporter      *bool  `yaml:"policyReporter,omitempty" json:"policyReporter,omitempty"`
+	Trivy               *bool  `yaml:"trivy,omitempty" json:"trivy,omitempty"`
+	Falco               *bool  `yaml:"falco,omitempty" json:"falco,omitempty"`
+	HubbleUI            *bool  `yaml:"hubbleUI,omitempty" json:"hubbleUI,omitempty"`
+	LogTracePipeline    *bool  `yaml:"logTracePipeline,omitempty" json:"logTracePipeline,omitempty"`
+	CiliumObservability *bool  `yaml:"ciliumObservability,omitempty" json:"ciliumObservability,omitempty"`
+	PostgresInstances   int    `yaml:"postgresInstances,omitempty" json:"postgresInstances,omitempty"`
+	KafkaReplicas       int    `yaml:"kafkaReplicas,omitempty" json:"kafkaReplicas,omitempty"`
+	KafkaMinISR         int    `yaml:"kafkaMinISR,omitempty" json:"kafkaMinISR,omitempty"`
+	KafkaStorage        string `yaml:"kafkaStorage,omitempty" json:"kafkaStorage,omitempty"`
+	PrometheusRetention string `yaml:"prometheusRetention,omitempty" json:"prometheusRetention,omitempty"`
+	PrometheusSize      string `yaml:"prometheusRetentionSize,omitempty" json:"prometheusRetentionSize,omitempty"`
+}
+
 func (cfg *Config) ProfileSpec() ProfileSpec {
-	return ProfileSpecFor(cfg.Profile())
+	if cfg == nil || cfg.Profile() != ProfileCustom {
+		return ProfileSpecFor(cfg.Profile())
+	}
+	return cfg.Platform.Components.Spec()
+}
+
+// Spec resolves the custom components on top of their base profile.
+func (components ComponentsConfig) Spec() ProfileSpec {
+	spec := ProfileSpecFor(components.BaseProfile())
+	spec.Name = ProfileCustom
+
+	overrideBool(&spec.EventStreams, components.EventStreams)
+	overrideBool(&spec.PolicyReporter, components.PolicyReporter)
+	overrideBool(&spec.Trivy, components.Trivy)
+	overrideBool(&spec.Falco, components.Falco)
+	overrideBool(&spec.HubbleUI, components.HubbleUI)
+	overrideBool(&spec.LogTracePipeline, components.LogTracePipeline)
+	overrideBool(&spec.CiliumObservability, components.CiliumObservability)
+	overrideInt(&spec.PostgresInstances, components.PostgresInstances)
+	overrideInt(&spec.KafkaReplicas, components.KafkaReplicas)
+	overrideInt(&spec.KafkaMinISR, components.KafkaMinISR)
+	overrideString(&spec.KafkaStorage, components.KafkaStorage)
+	overrideString(&spec.PrometheusRetention, components.PrometheusRetention)
+	overrideString(&spec.PrometheusSize, components.PrometheusSize)
+	return spec
+}
+
+func (components ComponentsConfig) BaseProfile() string {
+	base := normalizeProfile(components.Base)
+	if base == "" {
+		return DefaultPlatformProfile
+	}
+	return base
+}
+
+func (components ComponentsConfig) Validate() error {
+	switch components.BaseProfile() {
+	case ProfileSmall, ProfileMedium, ProfileLarge:
+	default:
+		return fmt.Errorf("unsupported platform.components.base %q (supported: small, medium, large)", components.Base)
+	}
+	if components.PostgresInstances < 0 || components.KafkaReplicas < 0 || components.KafkaMinISR < 0 {
+		return fmt.Errorf("platform.components replica counts must not be negative")
+	}
+	spec := components.Spec()
+	if spec.EventStreams && spec.KafkaMinISR > spec.KafkaReplicas {
+		return fmt.Errorf("platform.components.kafkaMinISR (%d) must not exceed kafkaReplicas (%d)", spec.KafkaMinISR, spec.KafkaReplicas)
+	}
+	return nil
+}
+
+func overrideBool(target *bool, value *bool) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+func overrideInt(target *int, value int) {
+	if value > 0 {
+		*target = value
+	}
+}
+
+func overrideString(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
 }
 
 func ProfileSpecFor(profile string) ProfileSpec {
@@ -26,6 +116,7 @@ func ProfileSpecFor(profile string) ProfileSpec {
 	case ProfileSmall:
 		return ProfileSpec{
 			Name:                ProfileSmall,
+			Base:                ProfileSmall,
 			PostgresInstances:   1,
 			KafkaReplicas:       1,
 			KafkaMinISR:         1,
@@ -36,6 +127,7 @@ func ProfileSpecFor(profile string) ProfileSpec {
 	case ProfileLarge:
 		return ProfileSpec{
 			Name:                ProfileLarge,
+			Base:                ProfileLarge,
 			EventStreams:        true,
 			PolicyReporter:      true,
 			Trivy:               true,
@@ -53,6 +145,7 @@ func ProfileSpecFor(profile string) ProfileSpec {
 	default:
 		return ProfileSpec{
 			Name:                ProfileMedium,
+			Base:                ProfileMedium,
 			EventStreams:        true,
 			PolicyReporter:      true,
 			Trivy:               true,
@@ -12,9 +12,11 @@ const (
 	ProfileSmall  = "small"
 	ProfileMedium = "medium"
 	ProfileLarge  = "large"
+	ProfileCustom = "custom"
 
 	DefaultClusterName      = "shoulders"
 	DefaultCiliumVersion    = "1.19.2"
+	DefaultFluxVersion      = "v2.8.3"
 	DefaultFluxRepoURL      = "https://github.com/jherreros/shoulders.git"
 	DefaultFluxBranch       = "main"
 	DefaultPlatformProfile  = ProfileMedium
@@ -28,9 +30,22 @@ const (
 )
 
 type Config struct {
-	CurrentWorkspace string         `yaml:"current_workspace,omitempty" json:"current_workspace,omitempty"`
-	Cluster          ClusterConfig  `yaml:"cluster,omitempty" json:"cluster,omitempty"`
-	Platform         PlatformConfig `yaml:"platform,omitempty" json:"platform,omitempty"`
+	CurrentEnvironment string                       `yaml:"current_environment,omitempty" json:"current_environment,omitempty"`
+	CurrentWorkspace   string                       `yaml:"current_workspace,omitempty" json:"current_workspace,omitempty"`
+	Cluster            ClusterConfig                `yaml:"cluster,omitempty" json:"cluster,omitempty"`
+	Platform           PlatformConfig               `yaml:"platform,omitempty" json:"platform,omitempty"`
+	Environments       map[string]EnvironmentConfig `yaml:"environments,omitempty" json:"environments,omitempty"`
+
+	// environment is the active named environment; root holds the top-level
+	// settings while it is active.
+	environment string
+	root        EnvironmentConfig
+	// origins records the layer that supplied each key when loaded.
+	origins map[string]Origin
+	// fileVersion is the apiVersion the config file was written with;
+	// migrated is set when it was older than APIVersion.
+	fileVersion string
+	migrated    bool
 }
 
 type ClusterConfig struct {
@@ -41,10 +56,12 @@ type ClusterConfig struct {
 }
 
 type PlatformConfig struct {
-	Profile string       `yaml:"profile,omitempty" json:"profile,omitempty"`
-	Domain  string       `yaml:"domain,omitempty" json:"domain,omitempty"`
-	Cilium  CiliumConfig `yaml:"cilium,omitempty" json:"cilium,omitempty"`
-	Flux    FluxConfig   `yaml:"flux,omitempty" json:"flux,omitempty"`
+	Profile    string           `yaml:"profile,omitempty" json:"profile,omitempty"`
+	Components ComponentsConfig `yaml:"components,omitempty" json:"components,omitempty"`
+	Domain     string           `yaml:"domain,omitempty" json:"domain,omitempty"`
+	Cilium     CiliumConfig     `yaml:"cilium,omitempty" json:"cilium,omitempty"`
+	Flux       FluxConfig       `yaml:"flux,omitempty" json:"flux,omitempty"`
+	Addons     []AddonConfig    `yaml:"addons,omitempty" json:"addons,omitempty"`
 }
 
 type CiliumConfig struct {
@@ -53,6 +70,7 @@ type CiliumConfig struct {
 }
 
 type FluxConfig struct {
+	Version       string              `yaml:"version,omitempty" json:"version,omitempty"`
 	GitRepository GitRepositoryConfig `yaml:"gitRepository,omitempty" json:"gitRepository,omitempty"`
 	PathPrefix    string              `yaml:"pathPrefix,omitempty" json:"pathPrefix,omitempty"`
 }
@@ -100,19 +118,29 @@ func (cfg *Config) ApplyDefaults() {
 func (cfg *Config) Validate() error {
 	if domain := cfg.Domain(); domain != "" {
 		if strings.Contains(domain, "://") || strings.Contains(domain, "/") {
-			return fmt.Errorf("platform.domain must be a host suffix without a scheme or path")
+			return cfg.attribute("platform.domain", fmt.Errorf("platform.domain must be a host suffix without a scheme or path"))
 		}
 	}
 	switch cfg.Profile() {
 	case ProfileSmall, ProfileMedium, ProfileLarge:
+	case ProfileCustom:
+		if err := cfg.Platform.Components.Validate(); err != nil {
+			return cfg.attribute("platform.components", err)
+		}
 	default:
-		return fmt.Errorf("unsupported platform profile %q", cfg.Platform.Profile)
+		return cfg.attribute("platform.profile", fmt.Errorf("unsupported platform profile %q", cfg.Platform.Profile))
+	}
+	if err := ValidateAddons(cfg.Platform.Addons); err != nil {
+		return cfg.attribute("platform.addons", err)
+	}
+	if err := validateEnvironmentNames(cfg.Environments); err != nil {
+		return cfg.attribute("environments", err)
 	}
 	switch cfg.Provider() {
 	case ProviderVind, ProviderExisting:
 		return nil
 	default:
-		return fmt.Errorf("unsupported cluster provider %q", cfg.Cluster.Provider)
+		return cfg.attribute("cluster.provider", fmt.Errorf("unsupported cluster provider %q", cfg.Cluster.Provider))
 	}
 }
 
@@ -158,6 +186,16 @@ func (cfg *Config) CiliumVersion() string {
 	return cfg.Platform.Cilium.Version
 }
 
+// FluxVersion is the pinned Flux version, or the default of this CLI build.
+// The default is not written to the config file so that upgrading the CLI
+// moves unpinned clusters to its Flux release.
+func (cfg *Config) FluxVersion() string {
+	if cfg == nil || cfg.Platform.Flux.Version == "" {
+		return DefaultFluxVersion
+	}
+	return "v" + strings.TrimPrefix(cfg.Platform.Flux.Version, "v")
+}
+
 func (cfg *Config) FluxRepositoryURL() string {
 	if cfg == nil || cfg.Platform.Flux.GitRepository.URL == "" {
 		return DefaultFluxRepoURL
@@ -278,6 +316,8 @@ func ExampleYAML(provider string) (string, error) {
 	return fmt.Sprintf(
 		"# Shoulders CLI configuration\n"+
 			"# Pass this file with --config, or place it at ~/.shoulders/config.yaml.\n\n"+
+			"apiVersion: %s\n"+
+			"kind: %s\n\n"+
 			"current_workspace: \"\"\n\n"+
 			"cluster:\n"+
 			"  provider: %s\n"+
@@ -285,21 +325,39 @@ func ExampleYAML(provider string) (string, error) {
 			"  kubeconfig: \"\"\n"+
 			"  context: %s\n\n"+
 			"platform:\n"+
-			"  profile: %q\n"+
+			"  profile: %q  # small | medium | large | custom\n"+
 			"  domain: \"\"\n"+
 			"  cilium:\n"+
 			"    enabled: %s\n"+
 			"    version: %q\n"+
 			"  flux:\n"+
+			"    # version: %q  # pin Flux; unset follows this CLI's default\n"+
 			"    gitRepository:\n"+
 			"      url: %q\n"+
 			"      branch: %q\n"+
-			"    pathPrefix: %q\n",
+			"    pathPrefix: %q\n"+
+			"  # Third-party addons reconciled by Flux next to the built-in ones.\n"+
+			"  addons: []\n"+
+			"  #  - name: cert-manager\n"+
+			"  #    source: {type: helm, url: https://charts.jetstack.io}\n"+
+			"  #    chart: cert-manager\n"+
+			"  #    namespace: cert-manager\n"+
+			"  #    values: {crds: {enabled: true}}\n"+
+			"  #    dependsOn: [helm-releases]\n\n"+
+			"# Named environments, selected with 'shoulders env use <name>' or --env.\n"+
+			"# environments:\n"+
+			"#   staging:\n"+
+			"#     current_workspace: team-a\n"+
+			"#     cluster: {provider: existing, context: staging-admin}\n"+
+			"#     platform: {profile: large}\n",
+		APIVersion,
+		Kind,
 		providerValue,
 		contextHint,
 		DefaultPlatformProfile,
 		ciliumEnabled,
 		DefaultCiliumVersion,
+		DefaultFluxVersion,
 		DefaultFluxRepoURL,
 		DefaultFluxBranch,
 		".",
@@ -19,6 +19,16 @@ func NewDynamicClient(kubeconfig string) (dynamic.Interface, error) {
 	return dynamic.NewForConfig(config)
 }
 
+// NewDynamicClientForContext returns a dynamic client for an explicit kube
+// context, such as another environment's cluster.
+func NewDynamicClientForContext(kubeconfig, contextName string) (dynamic.Interface, error) {
+	config, err := NewRestConfigForContext(kubeconfig, contextName)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(config)
+}
+
 func NewClientset(kubeconfig string) (*kubernetes.Clientset, error) {
 	config, err := NewRestConfig(kubeconfig)
 	if err != nil {
@@ -29,10 +29,17 @@ func configLoadingRules(kubeconfig string) *clientcmd.ClientConfigLoadingRules {
 }
 
 func NewRestConfig(kubeconfig string) (*rest.Config, error) {
+	return NewRestConfigForContext(kubeconfig, contextOverride)
+}
+
+// NewRestConfigForContext builds a client config for an explicit kube
+// context, ignoring the process-wide override. An empty contextName uses the
+// kubeconfig's current context.
+func NewRestConfigForContext(kubeconfig, contextName string) (*rest.Config, error) {
 	rules := configLoadingRules(kubeconfig)
 	overrides := &clientcmd.ConfigOverrides{}
-	if contextOverride != "" {
-		overrides.CurrentContext = contextOverride
+	if contextName != "" {
+		overrides.CurrentContext = contextName
 	}
 	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
 	config, err := clientConfig.ClientConfig()
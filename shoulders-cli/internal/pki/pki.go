@@ -0,0 +1,253 @@
+// Package pki manages the Shoulders local certificate authority and the
+// per-host certificates it issues for WebApplication routes.
+package pki
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	CACertFile = "ca.crt"
+	CAKeyFile  = "ca.key"
+
+	caCommonName = "Shoulders Local CA"
+	caValidity   = 10 * 365 * 24 * time.Hour
+	// leafValidity stays under the 398 days browsers accept for server
+	// certificates.
+	leafValidity = 397 * 24 * time.Hour
+	// RenewBefore is how long before expiry a certificate is reissued.
+	RenewBefore = 30 * 24 * time.Hour
+)
+
+// CA is the local certificate authority.
+type CA struct {
+	Cert    *x509.Certificate
+	Key     *rsa.PrivateKey
+	CertPEM []byte
+}
+
+// Dir returns the directory the local CA is persisted in.
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".shoulders", "pki"), nil
+}
+
+// LoadOrCreateCA reads the CA from dir, creating and persisting a new one
+// when dir holds none. The boolean reports whether a CA was created.
+func LoadOrCreateCA(dir string) (*CA, bool, error) {
+	certPEM, certErr := os.ReadFile(filepath.Join(dir, CACertFile))
+	keyPEM, keyErr := os.ReadFile(filepath.Join(dir, CAKeyFile))
+	if certErr == nil && keyErr == nil {
+		ca, err := ParseCA(certPEM, keyPEM)
+		if err != nil {
+			return nil, false, fmt.Errorf("read local ca from %s: %w", dir, err)
+		}
+		return ca, false, nil
+	}
+	if !errors.Is(certErr, os.ErrNotExist) && certErr != nil {
+		return nil, false, certErr
+	}
+	if !errors.Is(keyErr, os.ErrNotExist) && keyErr != nil {
+		return nil, false, keyErr
+	}
+	if certErr == nil || keyErr == nil {
+		return nil, false, fmt.Errorf("local ca in %s is incomplete: expected both %s and %s", dir, CACertFile, CAKeyFile)
+	}
+
+	ca, _, err := NewCA()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := Save(dir, ca); err != nil {
+		return nil, false, err
+	}
+	return ca, true, nil
+}
+
+// Save writes ca to dir, replacing any CA persisted there.
+func Save(dir string, ca *CA) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, CAKeyFile), ca.KeyPEM(), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, CACertFile), ca.CertPEM, 0o644)
+}
+
+// NewCA generates a CA and returns it with its PEM-encoded key.
+func NewCA() (*CA, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate ca key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: caCommonName, Organization: []string{"Shoulders"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create ca certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return &CA{Cert: cert, Key: key, CertPEM: certPEM}, keyPEM, nil
+}
+
+// ParseCA decodes a PEM-encoded CA certificate and RSA key.
+func ParseCA(certPEM, keyPEM []byte) (*CA, error) {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a ca certificate", cert.Subject.CommonName)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("decode ca key: no PEM block")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse ca key: %w", err)
+	}
+	return &CA{Cert: cert, Key: key, CertPEM: certPEM}, nil
+}
+
+// KeyPEM returns the PEM-encoded CA key.
+func (c *CA) KeyPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(c.Key)})
+}
+
+// Issue creates a server certificate for hosts signed by the CA and returns
+// the PEM-encoded certificate chain and key.
+func (c *CA) Issue(hosts []string) ([]byte, []byte, error) {
+	if len(hosts) == 0 {
+		return nil, nil, fmt.Errorf("issue certificate: no hosts")
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate certificate key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	notAfter := time.Now().Add(leafValidity)
+	if notAfter.After(c.Cert.NotAfter) {
+		notAfter = c.Cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     append([]string(nil), hosts...),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, c.Cert, &key.PublicKey, c.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create certificate: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certPEM = append(certPEM, c.CertPEM...)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return certPEM, keyPEM, nil
+}
+
+// Current reports whether certPEM was issued by the CA for exactly hosts and
+// is not due for renewal at now.
+func (c *CA) Current(certPEM []byte, hosts []string, now time.Time) bool {
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return false
+	}
+	if cert.CheckSignatureFrom(c.Cert) != nil {
+		return false
+	}
+	if now.Add(RenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	return sameHosts(cert.DNSNames, hosts)
+}
+
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("decode certificate: no PEM certificate block")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %w", err)
+	}
+	return cert, nil
+}
+
+func sameHosts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	left := append([]string(nil), a...)
+	right := append([]string(nil), b...)
+	sort.Strings(left)
+	sort.Strings(right)
+	for index := range left {
+		if left[index] != right[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the CA certificate, as
+// browsers show it.
+func (c *CA) Fingerprint() string {
+	sum := sha256.Sum256(c.Cert.Raw)
+	var out bytes.Buffer
+	for index, b := range sum {
+		if index > 0 {
+			out.WriteByte(':')
+		}
+		fmt.Fprintf(&out, "%02X", b)
+	}
+	return out.String()
+}
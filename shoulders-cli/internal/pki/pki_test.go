@@ -0,0 +1,93 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreateCAPersists(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pki")
+	ca, created, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("create ca: %v", err)
+	}
+	if !created {
+		t.Fatalf("expected a new ca to be created")
+	}
+	info, err := os.Stat(filepath.Join(dir, CAKeyFile))
+	if err != nil {
+		t.Fatalf("stat ca key: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the ca key to be private, got %v", info.Mode().Perm())
+	}
+
+	loaded, created, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatalf("load ca: %v", err)
+	}
+	if created || loaded.Fingerprint() != ca.Fingerprint() {
+		t.Fatalf("expected the persisted ca to be loaded")
+	}
+}
+
+func TestLoadOrCreateCARejectsIncompleteDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, CACertFile), []byte("cert"), 0o644); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if _, _, err := LoadOrCreateCA(dir); err == nil {
+		t.Fatalf("expected a ca without a key to fail")
+	}
+}
+
+func TestIssueAndCurrent(t *testing.T) {
+	ca, _, err := NewCA()
+	if err != nil {
+		t.Fatalf("create ca: %v", err)
+	}
+	certPEM, keyPEM, err := ca.Issue([]string{"shop.local"})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if len(keyPEM) == 0 {
+		t.Fatalf("expected a key")
+	}
+
+	block, rest := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse leaf: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.CertPEM)
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "shop.local", Roots: roots}); err != nil {
+		t.Fatalf("expected the leaf to verify against the ca: %v", err)
+	}
+	if chained, _ := pem.Decode(rest); chained == nil {
+		t.Fatalf("expected the ca certificate to be chained after the leaf")
+	}
+
+	now := time.Now()
+	if !ca.Current(certPEM, []string{"shop.local"}, now) {
+		t.Fatalf("expected a fresh certificate to be current")
+	}
+	if ca.Current(certPEM, []string{"www.shop.local"}, now) {
+		t.Fatalf("expected a host change to require a new certificate")
+	}
+	if ca.Current(certPEM, []string{"shop.local"}, cert.NotAfter.Add(-RenewBefore/2)) {
+		t.Fatalf("expected a certificate close to expiry to be renewed")
+	}
+
+	other, _, err := NewCA()
+	if err != nil {
+		t.Fatalf("create ca: %v", err)
+	}
+	if other.Current(certPEM, []string{"shop.local"}, now) {
+		t.Fatalf("expected a certificate from another ca to be reissued")
+	}
+}
@@ -0,0 +1,137 @@
+// Package sops writes SOPS-encrypted manifests that Flux decrypts with the
+// cluster's age key, and manages that key.
+package sops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"filippo.io/age"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/config"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	"github.com/getsops/sops/v3/version"
+	yaml "go.yaml.in/yaml/v3"
+)
+
+const (
+	// KeyFile holds the age identity, in ~/.shoulders/age and in the Flux
+	// decryption Secret. Flux reads identities from keys ending in .agekey.
+	KeyFile = "age.agekey"
+	// SecretName is the flux-system Secret Kustomizations decrypt with.
+	SecretName      = "sops-age"
+	SecretNamespace = "flux-system"
+
+	// EncryptedRegex selects the Secret fields that are encrypted; the rest
+	// of the manifest stays readable in review.
+	EncryptedRegex = "^(data|stringData)$"
+)
+
+// Dir returns the directory the age identity is persisted in.
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".shoulders", "age"), nil
+}
+
+// LoadOrCreateIdentity reads the age identity from dir, creating and
+// persisting a new one when dir holds none. The boolean reports whether an
+// identity was created.
+func LoadOrCreateIdentity(dir string) (*age.X25519Identity, bool, error) {
+	content, err := os.ReadFile(filepath.Join(dir, KeyFile))
+	if err == nil {
+		identity, err := ParseIdentity(content)
+		if err != nil {
+			return nil, false, fmt.Errorf("read age key from %s: %w", dir, err)
+		}
+		return identity, false, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, false, fmt.Errorf("generate age key: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, false, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, KeyFile), KeyFileContent(identity, time.Now()), 0o600); err != nil {
+		return nil, false, err
+	}
+	return identity, true, nil
+}
+
+// KeyFileContent renders identity the way age-keygen does.
+func KeyFileContent(identity *age.X25519Identity, created time.Time) []byte {
+	return []byte(fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		created.UTC().Format(time.RFC3339), identity.Recipient(), identity))
+}
+
+// ParseIdentity reads the first X25519 identity from an age key file.
+func ParseIdentity(content []byte) (*age.X25519Identity, error) {
+	identities, err := age.ParseIdentities(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			return x25519, nil
+		}
+	}
+	return nil, fmt.Errorf("no X25519 age identity found")
+}
+
+// Encrypt renders document as a SOPS file encrypted for the age recipient,
+// with the SOPS libraries Flux decrypts it with. Values under keys matching
+// EncryptedRegex are encrypted with a fresh data key; the data key is
+// encrypted for recipient and a MAC over all values protects the rest of the
+// document. Mapping keys are written sorted.
+func Encrypt(document map[string]interface{}, recipient string, now time.Time) ([]byte, error) {
+	masterKey, err := sopsage.MasterKeyFromRecipient(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("parse age recipient: %w", err)
+	}
+	plain, err := yaml.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	store := sopsyaml.NewStore(&config.YAMLStoreConfig{Indent: 2})
+	branches, err := store.LoadPlainFile(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: sops.Metadata{
+			KeyGroups:      []sops.KeyGroup{{masterKey}},
+			EncryptedRegex: EncryptedRegex,
+			Version:        version.Version,
+		},
+	}
+	dataKey, errs := tree.GenerateDataKey()
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("encrypt data key: %w", errors.Join(errs...))
+	}
+	cipher := aes.NewCipher()
+	mac, err := tree.Encrypt(dataKey, cipher)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt values: %w", err)
+	}
+	tree.Metadata.LastModified = now.UTC().Truncate(time.Second)
+	tree.Metadata.MessageAuthenticationCode, err = cipher.Encrypt(mac, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt MAC: %w", err)
+	}
+	return store.EmitEncryptedFile(tree)
+}
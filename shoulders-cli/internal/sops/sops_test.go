@@ -0,0 +1,81 @@
+package sops
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/decrypt"
+	yaml "go.yaml.in/yaml/v3"
+)
+
+func TestLoadOrCreateIdentityPersists(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "age")
+	identity, created, err := LoadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("create identity: %v", err)
+	}
+	if !created {
+		t.Fatalf("expected a new identity to be created")
+	}
+	info, err := os.Stat(filepath.Join(dir, KeyFile))
+	if err != nil {
+		t.Fatalf("stat key: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected the key to be private, got %v", info.Mode().Perm())
+	}
+
+	loaded, created, err := LoadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatalf("load identity: %v", err)
+	}
+	if created || loaded.String() != identity.String() {
+		t.Fatalf("expected the persisted identity to be loaded")
+	}
+}
+
+func TestEncryptDecryptsWithSOPS(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	document := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "api", "namespace": "team-a"},
+		"type":       "Opaque",
+		"data":       map[string]interface{}{"PASSWORD": "czNjcjN0", "EMPTY": ""},
+	}
+	content, err := Encrypt(document, identity.Recipient().String(), time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if strings.Contains(string(content), "czNjcjN0") {
+		t.Fatalf("expected data to be encrypted:\n%s", content)
+	}
+	for _, want := range []string{"name: api", "lastmodified: \"2026-01-02T03:04:05Z\"", "encrypted_regex: ^(data|stringData)$"} {
+		if !strings.Contains(string(content), want) {
+			t.Fatalf("expected %q in the readable metadata:\n%s", want, content)
+		}
+	}
+
+	// Decrypt the way sops -d and Flux do, with the identity in SOPS_AGE_KEY.
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+	plain, err := decrypt.DataWithFormat(content, formats.Yaml)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	var decrypted map[string]interface{}
+	if err := yaml.Unmarshal(plain, &decrypted); err != nil {
+		t.Fatalf("parse decrypted: %v", err)
+	}
+	data := decrypted["data"].(map[string]interface{})
+	if data["PASSWORD"] != "czNjcjN0" || data["EMPTY"] != "" || decrypted["metadata"].(map[string]interface{})["name"] != "api" {
+		t.Fatalf("unexpected decrypted document: %#v", decrypted)
+	}
+}
@@ -0,0 +1,226 @@
+// Package templates loads and renders workspace templates: directories of
+// Go-templated Shoulders manifests applied when a workspace is created.
+//
+// A template directory holds an optional template.yaml describing the
+// template and its parameters, and any number of .yaml manifests. Manifests
+// see the workspace name as {{ .Workspace }} and parameters as
+// {{ .Params.name }}, with the sprig functions available.
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"sigs.k8s.io/yaml"
+)
+
+// SourceBuiltin is the source of the templates embedded in the CLI.
+const SourceBuiltin = "built-in"
+
+// MetadataFile describes a template and its parameters.
+const MetadataFile = "template.yaml"
+
+//go:embed all:builtin
+var builtinFS embed.FS
+
+type Parameter struct {
+	Name        string `json:"name"`
+	Default     string `json:"default,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type File struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+type Template struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Source      string      `json:"source"`
+	Parameters  []Parameter `json:"parameters,omitempty"`
+	Files       []File      `json:"files"`
+}
+
+type metadata struct {
+	Description string      `json:"description,omitempty"`
+	Parameters  []Parameter `json:"parameters,omitempty"`
+}
+
+// UserDir returns the directory user templates are discovered from.
+func UserDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".shoulders", "templates"), nil
+}
+
+// Discover returns the built-in templates and the ones in userDir, sorted by
+// name. A user template replaces the built-in template of the same name.
+func Discover(userDir string) ([]Template, error) {
+	builtin, err := fs.Sub(builtinFS, "builtin")
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]Template{}
+	if err := loadAll(builtin, SourceBuiltin, byName); err != nil {
+		return nil, err
+	}
+	if userDir != "" {
+		if _, err := os.Stat(userDir); err == nil {
+			if err := loadAll(os.DirFS(userDir), userDir, byName); err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	found := make([]Template, 0, len(byName))
+	for _, tmpl := range byName {
+		found = append(found, tmpl)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Name < found[j].Name })
+	return found, nil
+}
+
+// Find returns the template called name.
+func Find(userDir, name string) (Template, error) {
+	found, err := Discover(userDir)
+	if err != nil {
+		return Template{}, err
+	}
+	names := make([]string, 0, len(found))
+	for _, tmpl := range found {
+		if tmpl.Name == name {
+			return tmpl, nil
+		}
+		names = append(names, tmpl.Name)
+	}
+	return Template{}, fmt.Errorf("unknown workspace template %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+func loadAll(fsys fs.FS, source string, byName map[string]Template) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		tmpl, err := load(fsys, entry.Name(), source)
+		if err != nil {
+			return err
+		}
+		byName[tmpl.Name] = tmpl
+	}
+	return nil
+}
+
+func load(fsys fs.FS, name, source string) (Template, error) {
+	tmpl := Template{Name: name, Source: source}
+	if source != SourceBuiltin {
+		tmpl.Source = filepath.Join(source, name)
+	}
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return Template{}, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, name+"/"+entry.Name())
+		if err != nil {
+			return Template{}, err
+		}
+		switch {
+		case entry.Name() == MetadataFile:
+			var meta metadata
+			if err := yaml.Unmarshal(content, &meta); err != nil {
+				return Template{}, fmt.Errorf("read template %s: %s: %w", name, MetadataFile, err)
+			}
+			tmpl.Description = meta.Description
+			tmpl.Parameters = meta.Parameters
+		case strings.HasSuffix(entry.Name(), ".yaml") || strings.HasSuffix(entry.Name(), ".yml"):
+			tmpl.Files = append(tmpl.Files, File{Name: entry.Name(), Content: string(content)})
+		}
+	}
+	if len(tmpl.Files) == 0 {
+		return Template{}, fmt.Errorf("template %s has no manifests", name)
+	}
+	return tmpl, nil
+}
+
+// ParseParams turns repeated key=value flags into a map.
+func ParseParams(entries []string) (map[string]string, error) {
+	params := map[string]string{}
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid template parameter %q (expected key=value)", entry)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+// Values applies the parameter defaults of t to params. Parameters t does not
+// declare are rejected, so a typo does not silently fall back to a default.
+func (t Template) Values(params map[string]string) (map[string]string, error) {
+	values := map[string]string{}
+	declared := map[string]bool{}
+	for _, parameter := range t.Parameters {
+		declared[parameter.Name] = true
+		value, ok := params[parameter.Name]
+		if !ok {
+			if parameter.Required {
+				return nil, fmt.Errorf("template %s requires --param %s=<value>", t.Name, parameter.Name)
+			}
+			value = parameter.Default
+		}
+		values[parameter.Name] = value
+	}
+	for key := range params {
+		if !declared[key] {
+			return nil, fmt.Errorf("template %s has no parameter %q", t.Name, key)
+		}
+	}
+	return values, nil
+}
+
+// Render executes every manifest of t for workspace and joins them into one
+// multi-document YAML stream.
+func (t Template) Render(workspace string, params map[string]string) ([]byte, error) {
+	values, err := t.Values(params)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{"Workspace": workspace, "Params": values}
+
+	var rendered bytes.Buffer
+	for _, file := range t.Files {
+		parsed, err := template.New(file.Name).Funcs(sprig.TxtFuncMap()).Option("missingkey=error").Parse(file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("parse template %s/%s: %w", t.Name, file.Name, err)
+		}
+		rendered.WriteString("---\n")
+		if err := parsed.Execute(&rendered, data); err != nil {
+			return nil, fmt.Errorf("render template %s/%s: %w", t.Name, file.Name, err)
+		}
+		rendered.WriteString("\n")
+	}
+	return rendered.Bytes(), nil
+}
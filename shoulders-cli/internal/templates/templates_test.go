@@ -0,0 +1,66 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderBuiltinStandardService(t *testing.T) {
+	tmpl, err := Find("", "standard-service")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tmpl.Source != SourceBuiltin {
+		t.Fatalf("expected built-in source, got %q", tmpl.Source)
+	}
+
+	rendered, err := tmpl.Render("team-c", map[string]string{"database": "orders"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content := string(rendered)
+	for _, expected := range []string{"name: team-c-db", `database: "orders"`, "name: team-c-assets", "name: team-c-worker", "name: team-c-env"} {
+		if !strings.Contains(content, expected) {
+			t.Fatalf("expected %q in rendered template:\n%s", expected, content)
+		}
+	}
+
+	if _, err := tmpl.Render("team-c", map[string]string{"databse": "orders"}); err == nil {
+		t.Fatalf("expected an undeclared parameter to fail")
+	}
+}
+
+func TestDiscoverUserTemplateOverridesBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"standard-service/app.yaml":      "kind: WebApplication\nmetadata:\n  name: {{ .Workspace }}-{{ .Params.app }}\n",
+		"standard-service/template.yaml": "description: Team override\nparameters:\n  - name: app\n    required: true\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	tmpl, err := Find(dir, "standard-service")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tmpl.Description != "Team override" || len(tmpl.Files) != 1 {
+		t.Fatalf("expected the user template to replace the built-in one, got %#v", tmpl)
+	}
+	if _, err := tmpl.Render("team-c", nil); err == nil || !strings.Contains(err.Error(), "requires --param app") {
+		t.Fatalf("expected a missing required parameter to fail, got %v", err)
+	}
+	if _, err := Find(dir, "missing"); err == nil || !strings.Contains(err.Error(), "standard-service") {
+		t.Fatalf("expected unknown template error listing the available ones, got %v", err)
+	}
+	if _, err := ParseParams([]string{"novalue"}); err == nil {
+		t.Fatalf("expected a parameter without = to fail")
+	}
+}
@@ -0,0 +1,221 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	SourcePrometheus    = "prometheus"
+	SourceMetricsServer = "metrics-server"
+)
+
+// Prometheus of the kube-prometheus-stack addon, reached through the API
+// server's service proxy so no port-forward or Gateway login is needed.
+const (
+	prometheusNamespace = "observability"
+	prometheusService   = "kube-prometheus-stack-prometheus"
+	prometheusPort      = "9090"
+)
+
+var podMetricsGVR = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+// Source reports per-container usage in a namespace.
+type Source interface {
+	Name() string
+	// ContainerSamples returns usage keyed by pod name, then container name,
+	// over window.
+	ContainerSamples(ctx context.Context, namespace string, window time.Duration) (map[string]map[string]Sample, error)
+	// VolumeUsage returns the used bytes of PVCs keyed by claim name, or nil
+	// when the source cannot tell.
+	VolumeUsage(ctx context.Context, namespace string) (map[string]float64, error)
+}
+
+// Prometheus reads cAdvisor and kubelet volume metrics.
+type Prometheus struct {
+	Clientset kubernetes.Interface
+}
+
+func (p Prometheus) Name() string { return SourcePrometheus }
+
+// Available reports whether Prometheus answers queries.
+func (p Prometheus) Available(ctx context.Context) bool {
+	_, err := p.query(ctx, "vector(1)")
+	return err == nil
+}
+
+func (p Prometheus) ContainerSamples(ctx context.Context, namespace string, window time.Duration) (map[string]map[string]Sample, error) {
+	selector := fmt.Sprintf(`namespace=%q,container!="",container!="POD"`, namespace)
+	cpu := fmt.Sprintf(`sum by (pod, container) (rate(container_cpu_usage_seconds_total{%s}[5m]))`, selector)
+	memory := fmt.Sprintf(`sum by (pod, container) (container_memory_working_set_bytes{%s})`, selector)
+	span := fmt.Sprintf("%ds", int64(window.Seconds()))
+
+	samples := map[string]map[string]Sample{}
+	queries := []struct {
+		expr   string
+		assign func(*Sample, float64)
+	}{
+		{fmt.Sprintf("avg_over_time(%s[%s:1m])", cpu, span), func(s *Sample, v float64) { s.CPUAvg = v }},
+		{fmt.Sprintf("max_over_time(%s[%s:1m])", cpu, span), func(s *Sample, v float64) { s.CPUPeak = v }},
+		{fmt.Sprintf("avg_over_time(%s[%s:1m])", memory, span), func(s *Sample, v float64) { s.MemoryAvg = v }},
+		{fmt.Sprintf("max_over_time(%s[%s:1m])", memory, span), func(s *Sample, v float64) { s.MemoryPeak = v }},
+	}
+	for _, query := range queries {
+		results, err := p.vector(ctx, query.expr)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			pod, container := result.Metric["pod"], result.Metric["container"]
+			if samples[pod] == nil {
+				samples[pod] = map[string]Sample{}
+			}
+			sample := samples[pod][container]
+			query.assign(&sample, result.Value)
+			sample.Pods = 1
+			samples[pod][container] = sample
+		}
+	}
+	return samples, nil
+}
+
+func (p Prometheus) VolumeUsage(ctx context.Context, namespace string) (map[string]float64, error) {
+	return p.queryBy(ctx, fmt.Sprintf(`max by (persistentvolumeclaim) (kubelet_volume_stats_used_bytes{namespace=%q})`, namespace), "persistentvolumeclaim")
+}
+
+// Value runs a query that yields a single unlabelled sample, such as a ratio
+// of sums. The boolean is false when the query returned no data.
+func (p Prometheus) Value(ctx context.Context, expr string) (float64, bool, error) {
+	values, err := p.queryBy(ctx, expr, "")
+	if err != nil {
+		return 0, false, err
+	}
+	value, ok := values[""]
+	return value, ok, nil
+}
+
+func (p Prometheus) query(ctx context.Context, expr string) (map[string]float64, error) {
+	return p.queryBy(ctx, expr, "pod")
+}
+
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		Result []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// vectorSample is one series of an instant query result.
+type vectorSample struct {
+	Metric map[string]string
+	Value  float64
+}
+
+// queryBy runs an instant query and keys the vector result by label.
+func (p Prometheus) queryBy(ctx context.Context, expr, label string) (map[string]float64, error) {
+	results, err := p.vector(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]float64{}
+	for _, result := range results {
+		values[result.Metric[label]] = result.Value
+	}
+	return values, nil
+}
+
+// vector runs an instant query, skipping series without a numeric value.
+func (p Prometheus) vector(ctx context.Context, expr string) ([]vectorSample, error) {
+	raw, err := p.Clientset.CoreV1().Services(prometheusNamespace).
+		ProxyGet("http", prometheusService, prometheusPort, "/api/v1/query", map[string]string{"query": expr}).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query prometheus: %w", err)
+	}
+	var response prometheusResponse
+	if err := json.Unmarshal(raw, &response); err != nil {
+		return nil, fmt.Errorf("decode prometheus response: %w", err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("query prometheus: %s", response.Error)
+	}
+	samples := []vectorSample{}
+	for _, result := range response.Data.Result {
+		if len(result.Value) != 2 {
+			continue
+		}
+		text, _ := result.Value[1].(string)
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(value) {
+			continue
+		}
+		samples = append(samples, vectorSample{Metric: result.Metric, Value: value})
+	}
+	return samples, nil
+}
+
+// MetricsServer reads the current usage from the metrics API. It has no
+// history, so averages and peaks are the same point-in-time value and the
+// window is ignored.
+type MetricsServer struct {
+	Client dynamic.Interface
+}
+
+func (m MetricsServer) Name() string { return SourceMetricsServer }
+
+// Available reports whether the metrics API is served.
+func (m MetricsServer) Available(ctx context.Context) bool {
+	_, err := m.Client.Resource(podMetricsGVR).Namespace(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{Limit: 1})
+	return err == nil
+}
+
+func (m MetricsServer) ContainerSamples(ctx context.Context, namespace string, _ time.Duration) (map[string]map[string]Sample, error) {
+	list, err := m.Client.Resource(podMetricsGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pod metrics: %w", err)
+	}
+	samples := map[string]map[string]Sample{}
+	for _, item := range list.Items {
+		containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+		pod := map[string]Sample{}
+		for _, container := range containers {
+			fields, _ := container.(map[string]interface{})
+			name, _ := fields["name"].(string)
+			usage, _ := fields["usage"].(map[string]interface{})
+			cpu, memory := quantityValue(usage["cpu"]), quantityValue(usage["memory"])
+			pod[name] = Sample{CPUAvg: cpu, CPUPeak: cpu, MemoryAvg: memory, MemoryPeak: memory, Pods: 1}
+		}
+		samples[item.GetName()] = pod
+	}
+	return samples, nil
+}
+
+func (m MetricsServer) VolumeUsage(context.Context, string) (map[string]float64, error) {
+	return nil, nil
+}
+
+func quantityValue(raw interface{}) float64 {
+	if raw == nil {
+		return 0
+	}
+	quantity, err := resource.ParseQuantity(fmt.Sprint(raw))
+	if err != nil {
+		return 0
+	}
+	return quantity.AsApproximateFloat64()
+}
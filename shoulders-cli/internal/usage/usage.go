@@ -0,0 +1,207 @@
+// Package usage compares the requested resources of Shoulders apps and
+// workloads with what their pods actually use and suggests better values.
+package usage
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	StatusOK               = "ok"
+	StatusOverProvisioned  = "over-provisioned"
+	StatusUnderProvisioned = "under-provisioned"
+	StatusNoRequest        = "no-request"
+	StatusNoData           = "no-data"
+)
+
+// Thresholds of the right-sizing rules. Suggested values leave headroom
+// above the observed peak.
+const (
+	overProvisionedRatio = 0.5
+	nearLimitRatio       = 0.9
+	requestHeadroom      = 1.2
+	limitHeadroom        = 1.5
+	minCPU               = 0.01
+	minMemory            = 16 * 1024 * 1024
+)
+
+// Sample is the usage of one container, in one pod or across the pods of an
+// app, over the report window. CPU is in cores and memory in bytes.
+type Sample struct {
+	CPUAvg     float64
+	CPUPeak    float64
+	MemoryAvg  float64
+	MemoryPeak float64
+	Pods       int
+}
+
+// Resources holds the requests and limits of a container. Zero means unset.
+type Resources struct {
+	CPURequest    float64
+	CPULimit      float64
+	MemoryRequest float64
+	MemoryLimit   float64
+}
+
+// Assessment is the verdict for one app or workload. Suggested is keyed by
+// the app update flag name, for example cpu-request.
+type Assessment struct {
+	Status    string
+	Reasons   []string
+	Suggested map[string]string
+}
+
+// ParseResources reads the requests and limits of a WebApplication or
+// Workload spec.resources map.
+func ParseResources(spec map[string]interface{}) (Resources, error) {
+	var parsed Resources
+	targets := map[string]map[string]*float64{
+		"requests": {"cpu": &parsed.CPURequest, "memory": &parsed.MemoryRequest},
+		"limits":   {"cpu": &parsed.CPULimit, "memory": &parsed.MemoryLimit},
+	}
+	for section, fields := range targets {
+		values, _ := spec[section].(map[string]interface{})
+		for name, target := range fields {
+			raw, ok := values[name]
+			if !ok {
+				continue
+			}
+			quantity, err := resource.ParseQuantity(fmt.Sprint(raw))
+			if err != nil {
+				return Resources{}, fmt.Errorf("invalid %s.%s %q: %w", section, name, raw, err)
+			}
+			*target = quantity.AsApproximateFloat64()
+		}
+	}
+	return parsed, nil
+}
+
+// Assess applies the right-sizing rules to one container of an app or
+// workload, against that container's own requests and limits:
+//   - a peak below half the request is over-provisioned;
+//   - an average above the request, or a peak within 10% of the limit, is
+//     under-provisioned;
+//   - a container without a request gets one suggested.
+func Assess(resources Resources, sample Sample) Assessment {
+	assessment := Assessment{Status: StatusOK, Suggested: map[string]string{}}
+	if sample.Pods == 0 {
+		assessment.Status = StatusNoData
+		return assessment
+	}
+	assessResource(&assessment, "cpu", resources.CPURequest, resources.CPULimit, sample.CPUAvg, sample.CPUPeak, DescribeCPU, FormatCPU)
+	assessResource(&assessment, "memory", resources.MemoryRequest, resources.MemoryLimit, sample.MemoryAvg, sample.MemoryPeak, DescribeMemory, FormatMemory)
+	return assessment
+}
+
+func assessResource(assessment *Assessment, name string, request, limit, avg, peak float64, describe, suggest func(float64) string) {
+	switch {
+	case request == 0:
+		assessment.raise(StatusNoRequest, fmt.Sprintf("no %s request", name))
+		assessment.Suggested[name+"-request"] = suggest(peak * requestHeadroom)
+	case avg > request:
+		assessment.raise(StatusUnderProvisioned, fmt.Sprintf("%s average %s is above the request %s", name, describe(avg), describe(request)))
+		assessment.Suggested[name+"-request"] = suggest(peak * requestHeadroom)
+	case peak < request*overProvisionedRatio:
+		assessment.raise(StatusOverProvisioned, fmt.Sprintf("%s peak %s is under half the request %s", name, describe(peak), describe(request)))
+		assessment.Suggested[name+"-request"] = suggest(peak * requestHeadroom)
+	}
+	if limit > 0 && peak >= limit*nearLimitRatio {
+		assessment.raise(StatusUnderProvisioned, fmt.Sprintf("%s peak %s is near the limit %s", name, describe(peak), describe(limit)))
+		assessment.Suggested[name+"-limit"] = suggest(peak * limitHeadroom)
+	}
+}
+
+// raise records reason and keeps the most severe status: under-provisioned
+// wins over a missing request, which wins over over-provisioned.
+func (a *Assessment) raise(status, reason string) {
+	a.Reasons = append(a.Reasons, reason)
+	if statusSeverity(status) > statusSeverity(a.Status) {
+		a.Status = status
+	}
+}
+
+func statusSeverity(status string) int {
+	switch status {
+	case StatusUnderProvisioned:
+		return 3
+	case StatusNoRequest:
+		return 2
+	case StatusOverProvisioned:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// DescribeCPU renders cores as whole millicores for reports.
+func DescribeCPU(cores float64) string {
+	return fmt.Sprintf("%dm", int64(math.Round(cores*1000)))
+}
+
+// DescribeMemory renders bytes as whole Mi for reports.
+func DescribeMemory(bytes float64) string {
+	return fmt.Sprintf("%dMi", int64(math.Round(bytes/(1024*1024))))
+}
+
+// FormatCPU renders a suggested CPU value as millicores, rounded up to 10m.
+func FormatCPU(cores float64) string {
+	cores = math.Max(cores, minCPU)
+	return fmt.Sprintf("%dm", int64(math.Ceil(cores*100))*10)
+}
+
+// FormatMemory renders a suggested memory value as Mi, rounded up to 16Mi.
+func FormatMemory(bytes float64) string {
+	bytes = math.Max(bytes, minMemory)
+	return fmt.Sprintf("%dMi", int64(math.Ceil(bytes/minMemory))*16)
+}
+
+// Aggregate combines the container samples of the pods owned by the app or
+// workload called owner, keyed by container name: averages are averaged over
+// the pods running the container and peaks take the maximum. Pods are matched
+// by name, <owner>-<hash> or <owner>-<hash>-<hash>, so pods that no longer
+// exist still count over the window. Among owners sharing a prefix, the
+// longest name wins.
+func Aggregate(pods map[string]map[string]Sample, owner string, owners []string) map[string]Sample {
+	aggregates := map[string]Sample{}
+	for pod, containers := range pods {
+		if OwnerOf(pod, owners) != owner {
+			continue
+		}
+		for container, sample := range containers {
+			aggregate := aggregates[container]
+			aggregate.CPUAvg += sample.CPUAvg
+			aggregate.MemoryAvg += sample.MemoryAvg
+			aggregate.CPUPeak = math.Max(aggregate.CPUPeak, sample.CPUPeak)
+			aggregate.MemoryPeak = math.Max(aggregate.MemoryPeak, sample.MemoryPeak)
+			aggregate.Pods++
+			aggregates[container] = aggregate
+		}
+	}
+	for container, aggregate := range aggregates {
+		aggregate.CPUAvg /= float64(aggregate.Pods)
+		aggregate.MemoryAvg /= float64(aggregate.Pods)
+		aggregates[container] = aggregate
+	}
+	return aggregates
+}
+
+// OwnerOf returns the owner whose pod name pattern matches pod, or "".
+func OwnerOf(pod string, owners []string) string {
+	sorted := append([]string(nil), owners...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	for _, owner := range sorted {
+		if podNamePattern(owner).MatchString(pod) {
+			return owner
+		}
+	}
+	return ""
+}
+
+func podNamePattern(owner string) *regexp.Regexp {
+	return regexp.MustCompile("^" + regexp.QuoteMeta(owner) + `-[a-z0-9]+(-[a-z0-9]+)?$`)
+}
@@ -0,0 +1,67 @@
+package usage
+
+import "testing"
+
+const mebibyte = 1024 * 1024
+
+func TestAssess(t *testing.T) {
+	resources, err := ParseResources(map[string]interface{}{
+		"requests": map[string]interface{}{"cpu": "500m", "memory": "256Mi"},
+		"limits":   map[string]interface{}{"memory": "300Mi"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assessment := Assess(resources, Sample{CPUAvg: 0.05, CPUPeak: 0.1, MemoryAvg: 200 * mebibyte, MemoryPeak: 290 * mebibyte, Pods: 2})
+	if assessment.Status != StatusUnderProvisioned {
+		t.Fatalf("expected a peak near the memory limit to win over idle CPU, got %s (%v)", assessment.Status, assessment.Reasons)
+	}
+	if assessment.Suggested["cpu-request"] != "120m" {
+		t.Fatalf("expected cpu request from the peak plus headroom, got %v", assessment.Suggested)
+	}
+	if assessment.Suggested["memory-limit"] != "448Mi" {
+		t.Fatalf("expected memory limit from the peak plus headroom, got %v", assessment.Suggested)
+	}
+	if _, ok := assessment.Suggested["memory-request"]; ok {
+		t.Fatalf("expected the memory request to be left alone, got %v", assessment.Suggested)
+	}
+
+	if status := Assess(Resources{}, Sample{CPUPeak: 0.001, MemoryPeak: mebibyte, Pods: 1}).Status; status != StatusNoRequest {
+		t.Fatalf("expected no-request, got %s", status)
+	}
+	if status := Assess(resources, Sample{}).Status; status != StatusNoData {
+		t.Fatalf("expected no-data without pods, got %s", status)
+	}
+	if _, err := ParseResources(map[string]interface{}{"requests": map[string]interface{}{"cpu": "lots"}}); err == nil {
+		t.Fatalf("expected an invalid quantity to fail")
+	}
+}
+
+func TestAggregateMatchesPodsByOwner(t *testing.T) {
+	pods := map[string]map[string]Sample{
+		"team-a-web-7c9f8d-abcde": {
+			"app":   {CPUAvg: 0.1, CPUPeak: 0.2, Pods: 1},
+			"proxy": {CPUAvg: 0.4, CPUPeak: 0.9, MemoryAvg: 64 * mebibyte, MemoryPeak: 80 * mebibyte, Pods: 1},
+		},
+		"team-a-web-7c9f8d-fghij":     {"app": {CPUAvg: 0.3, CPUPeak: 0.5, Pods: 1}},
+		"team-a-web-api-5d6f7-klmno":  {"app": {CPUAvg: 1, CPUPeak: 2, Pods: 1}},
+		"team-a-db-1":                 {"postgres": {CPUAvg: 4, CPUPeak: 4, Pods: 1}},
+		"team-a-report-29384756-pqrs": {"app": {CPUAvg: 0.2, CPUPeak: 0.2, Pods: 1}},
+	}
+	owners := []string{"team-a-web", "team-a-web-api", "team-a-report"}
+
+	web := Aggregate(pods, "team-a-web", owners)
+	if app := web["app"]; app.Pods != 2 || app.CPUPeak != 0.5 || DescribeCPU(app.CPUAvg) != "200m" {
+		t.Fatalf("unexpected aggregate for the team-a-web app container: %#v", app)
+	}
+	if proxy := web["proxy"]; proxy.Pods != 1 || proxy.CPUPeak != 0.9 || DescribeMemory(proxy.MemoryPeak) != "80Mi" {
+		t.Fatalf("expected the sidecar to be aggregated on its own, got %#v", proxy)
+	}
+	if api := Aggregate(pods, "team-a-web-api", owners); api["app"].Pods != 1 {
+		t.Fatalf("expected the longer owner name to claim its pods, got %#v", api)
+	}
+	if owner := OwnerOf("team-a-db-1", owners); owner != "" {
+		t.Fatalf("expected no owner for a database pod, got %q", owner)
+	}
+}
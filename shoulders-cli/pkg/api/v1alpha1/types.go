@@ -3,6 +3,7 @@ package v1alpha1
 import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
@@ -22,6 +23,7 @@ type WebApplicationSpec struct {
 	Replicas           int32                    `json:"replicas"`
 	Host               string                   `json:"host,omitempty"`
 	Port               int32                    `json:"port,omitempty"`
+	Protocol           string                   `json:"protocol,omitempty"`
 	ImagePullPolicy    string                   `json:"imagePullPolicy,omitempty"`
 	Command            []string                 `json:"command,omitempty"`
 	Args               []string                 `json:"args,omitempty"`
@@ -38,16 +40,181 @@ type WebApplicationSpec struct {
 	PodSecurityContext map[string]interface{}   `json:"podSecurityContext,omitempty"`
 	SecurityContext    map[string]interface{}   `json:"securityContext,omitempty"`
 	ServiceAccountName string                   `json:"serviceAccountName,omitempty"`
+	InitContainers     []ContainerSpec          `json:"initContainers,omitempty"`
+	Sidecars           []ContainerSpec          `json:"sidecars,omitempty"`
+	Canary             *CanarySpec              `json:"canary,omitempty"`
+	Availability       *AvailabilitySpec        `json:"availability,omitempty"`
+	Bindings           []BindingSpec            `json:"bindings,omitempty"`
+	ConfigFiles        []ConfigFileSpec         `json:"configFiles,omitempty"`
+	Persistence        []PersistenceSpec        `json:"persistence,omitempty"`
+	ExposeTo           []string                 `json:"exposeTo,omitempty"`
+}
+
+// AvailabilitySpec keeps replicas up through node drains. MinAvailable or
+// MaxUnavailable renders a PodDisruptionBudget, MinAvailable winning when
+// both are set. Spread and AntiAffinity are none, soft or hard and spread
+// pods over TopologyKey, which defaults to kubernetes.io/hostname.
+type AvailabilitySpec struct {
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	Spread         string              `json:"spread,omitempty"`
+	AntiAffinity   string              `json:"antiAffinity,omitempty"`
+	TopologyKey    string              `json:"topologyKey,omitempty"`
+}
+
+// BindingSpec connects an app to a StateStore or EventStream in its namespace
+// by injecting environment variables for it. Postgres variables come from the
+// <name>-app-secret Secret and the <name>-rw Service, S3 variables from the
+// <bucket>-s3 Secret, and Kafka variables from the <name>-cluster bootstrap
+// Service. EnvPrefix is prepended to every variable name.
+type BindingSpec struct {
+	Kind             string   `json:"kind"`
+	Name             string   `json:"name"`
+	EnvPrefix        string   `json:"envPrefix,omitempty"`
+	PostgreSQL       *bool    `json:"postgresql,omitempty"`
+	SecretName       string   `json:"secretName,omitempty"`
+	Database         string   `json:"database,omitempty"`
+	Redis            bool     `json:"redis,omitempty"`
+	Bucket           string   `json:"bucket,omitempty"`
+	BucketSecretName string   `json:"bucketSecretName,omitempty"`
+	Topics           []string `json:"topics,omitempty"`
+}
+
+// ConfigFileSpec is a file rendered into a ConfigMap named after a hash of
+// all config files, so changing any of them rolls the pods. The file is
+// mounted read-only at MountPath, which defaults to /etc/config/<name>.
+type ConfigFileSpec struct {
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	MountPath string `json:"mountPath,omitempty"`
+}
+
+// PersistenceSpec is a PersistentVolumeClaim of Size mounted at MountPath.
+// With one replica the pod mounts the <name>-<app>-0 claim; with more, the
+// app runs as a StatefulSet and every replica gets its own claim, named the
+// same way. AccessMode defaults to ReadWriteOnce and StorageClass to the
+// cluster default.
+type PersistenceSpec struct {
+	Name         string `json:"name"`
+	Size         string `json:"size"`
+	StorageClass string `json:"storageClass,omitempty"`
+	AccessMode   string `json:"accessMode,omitempty"`
+	MountPath    string `json:"mountPath"`
+}
+
+// CanarySpec runs a second <name>-canary Deployment and Service with another
+// image and sends Weight percent of the route traffic to it. Tag defaults to
+// the tag of the app.
+type CanarySpec struct {
+	Image    string `json:"image"`
+	Tag      string `json:"tag,omitempty"`
+	Weight   int32  `json:"weight"`
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// ContainerSpec is an init container or sidecar next to the main app
+// container. Sidecars run as native sidecars (init containers with
+// restartPolicy Always), so they start first and do not keep Jobs alive.
+type ContainerSpec struct {
+	Name            string                   `json:"name"`
+	Image           string                   `json:"image"`
+	Tag             string                   `json:"tag,omitempty"`
+	ImagePullPolicy string                   `json:"imagePullPolicy,omitempty"`
+	Command         []string                 `json:"command,omitempty"`
+	Args            []string                 `json:"args,omitempty"`
+	Env             []map[string]interface{} `json:"env,omitempty"`
+	EnvFrom         []map[string]interface{} `json:"envFrom,omitempty"`
+	Ports           []ContainerPort          `json:"ports,omitempty"`
+	Resources       map[string]interface{}   `json:"resources,omitempty"`
+	SecurityContext map[string]interface{}   `json:"securityContext,omitempty"`
+	VolumeMounts    []map[string]interface{} `json:"volumeMounts,omitempty"`
+}
+
+type ContainerPort struct {
+	Name          string `json:"name,omitempty"`
+	ContainerPort int32  `json:"containerPort"`
+	Protocol      string `json:"protocol,omitempty"`
 }
 
 type ServiceSpec struct {
 	Port int32 `json:"port,omitempty"`
 }
 
+// RouteSpec exposes the app through a Gateway. TLS needs a certificate and an
+// HTTPS listener per host, which only the CLI issues: apps reconciled by Flux
+// serve plain HTTP until `shoulders certs sync` runs.
 type RouteSpec struct {
-	Enabled          *bool  `json:"enabled,omitempty"`
-	GatewayName      string `json:"gatewayName,omitempty"`
-	GatewayNamespace string `json:"gatewayNamespace,omitempty"`
+	Enabled          *bool          `json:"enabled,omitempty"`
+	GatewayName      string         `json:"gatewayName,omitempty"`
+	GatewayNamespace string         `json:"gatewayNamespace,omitempty"`
+	Hosts            []string       `json:"hosts,omitempty"`
+	TLS              bool           `json:"tls,omitempty"`
+	Rules            []RouteRule    `json:"rules,omitempty"`
+	Timeouts         *RouteTimeouts `json:"timeouts,omitempty"`
+}
+
+// RouteRule maps to one HTTPRoute rule, or one GRPCRoute rule when the app
+// speaks gRPC. A rule without matches catches every request; a rule with a
+// redirect sends no traffic to the app. Method applies to gRPC only; Path,
+// Rewrite and Redirect to HTTP only.
+type RouteRule struct {
+	Path            *RoutePathMatch      `json:"path,omitempty"`
+	Method          *RouteMethodMatch    `json:"method,omitempty"`
+	Headers         []RouteHeaderMatch   `json:"headers,omitempty"`
+	RequestHeaders  *RouteHeaderModifier `json:"requestHeaders,omitempty"`
+	ResponseHeaders *RouteHeaderModifier `json:"responseHeaders,omitempty"`
+	Rewrite         *RouteRewrite        `json:"rewrite,omitempty"`
+	Redirect        *RouteRedirect       `json:"redirect,omitempty"`
+}
+
+type RoutePathMatch struct {
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value"`
+}
+
+type RouteMethodMatch struct {
+	Type    string `json:"type,omitempty"`
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+}
+
+type RouteHeaderMatch struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+}
+
+type RouteHeaderModifier struct {
+	Set    []RouteHeader `json:"set,omitempty"`
+	Add    []RouteHeader `json:"add,omitempty"`
+	Remove []string      `json:"remove,omitempty"`
+}
+
+type RouteHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type RouteRewrite struct {
+	Hostname           string `json:"hostname,omitempty"`
+	ReplacePrefixMatch string `json:"replacePrefixMatch,omitempty"`
+	ReplaceFullPath    string `json:"replaceFullPath,omitempty"`
+}
+
+type RouteRedirect struct {
+	Scheme             string `json:"scheme,omitempty"`
+	Hostname           string `json:"hostname,omitempty"`
+	Port               *int32 `json:"port,omitempty"`
+	StatusCode         int32  `json:"statusCode,omitempty"`
+	ReplacePrefixMatch string `json:"replacePrefixMatch,omitempty"`
+	ReplaceFullPath    string `json:"replaceFullPath,omitempty"`
+}
+
+// RouteTimeouts are Gateway API durations, for example 30s, applied to
+// every rule of the route.
+type RouteTimeouts struct {
+	Request        string `json:"request,omitempty"`
+	BackendRequest string `json:"backendRequest,omitempty"`
 }
 
 type WebApplicationList struct {
@@ -154,6 +321,12 @@ type WorkloadSpec struct {
 	PodSecurityContext map[string]interface{}   `json:"podSecurityContext,omitempty"`
 	SecurityContext    map[string]interface{}   `json:"securityContext,omitempty"`
 	ServiceAccountName string                   `json:"serviceAccountName,omitempty"`
+	InitContainers     []ContainerSpec          `json:"initContainers,omitempty"`
+	Sidecars           []ContainerSpec          `json:"sidecars,omitempty"`
+	Availability       *AvailabilitySpec        `json:"availability,omitempty"`
+	Bindings           []BindingSpec            `json:"bindings,omitempty"`
+	ConfigFiles        []ConfigFileSpec         `json:"configFiles,omitempty"`
+	Persistence        []PersistenceSpec        `json:"persistence,omitempty"`
 }
 
 type WorkloadList struct {
@@ -168,7 +341,62 @@ type Workspace struct {
 	Spec          WorkspaceSpec `json:"spec,omitempty"`
 }
 
-type WorkspaceSpec struct{}
+type WorkspaceSpec struct {
+	Quota     *WorkspaceQuota    `json:"quota,omitempty"`
+	Defaults  *WorkspaceDefaults `json:"defaults,omitempty"`
+	Members   []WorkspaceMember  `json:"members,omitempty"`
+	AllowFrom []WorkspaceGrant   `json:"allowFrom,omitempty"`
+}
+
+const (
+	WorkspaceMemberUser  = "User"
+	WorkspaceMemberGroup = "Group"
+
+	WorkspaceRoleAdmin     = "admin"
+	WorkspaceRoleDeveloper = "developer"
+	WorkspaceRoleViewer    = "viewer"
+)
+
+// WorkspaceMember grants a Dex user (by email) or group a role in the
+// workspace namespace.
+type WorkspaceMember struct {
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// WorkspaceGrant lets pods of another workspace reach this one. App limits
+// the grant to the pods of one application and Ports to its container ports.
+type WorkspaceGrant struct {
+	Workspace string  `json:"workspace"`
+	App       string  `json:"app,omitempty"`
+	Ports     []int32 `json:"ports,omitempty"`
+}
+
+// WorkspaceQuota caps the total requests and object counts of a workspace
+// namespace. CPU, memory and storage are Kubernetes quantities.
+type WorkspaceQuota struct {
+	CPU                    string `json:"cpu,omitempty"`
+	Memory                 string `json:"memory,omitempty"`
+	Storage                string `json:"storage,omitempty"`
+	Pods                   *int32 `json:"pods,omitempty"`
+	Services               *int32 `json:"services,omitempty"`
+	PersistentVolumeClaims *int32 `json:"persistentVolumeClaims,omitempty"`
+	ConfigMaps             *int32 `json:"configMaps,omitempty"`
+	Secrets                *int32 `json:"secrets,omitempty"`
+}
+
+// WorkspaceDefaults sets the requests and limits of containers that do not
+// declare their own.
+type WorkspaceDefaults struct {
+	Requests *WorkspaceResources `json:"requests,omitempty"`
+	Limits   *WorkspaceResources `json:"limits,omitempty"`
+}
+
+type WorkspaceResources struct {
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
 
 type WorkspaceList struct {
 	v1.TypeMeta `json:",inline"`
@@ -300,6 +528,7 @@ func (in *Workspace) DeepCopyObject() runtime.Object {
 	out := new(Workspace)
 	*out = *in
 	copyObjectMeta(&in.ObjectMeta, &out.ObjectMeta)
+	out.Spec = copyWorkspaceSpec(in.Spec)
 	return out
 }
 
@@ -340,11 +569,7 @@ func copyWebApplicationSpec(in WebApplicationSpec) WebApplicationSpec {
 		out.Service = &ServiceSpec{Port: in.Service.Port}
 	}
 	if in.Route != nil {
-		out.Route = &RouteSpec{
-			Enabled:          copyBoolPointer(in.Route.Enabled),
-			GatewayName:      in.Route.GatewayName,
-			GatewayNamespace: in.Route.GatewayNamespace,
-		}
+		out.Route = copyRouteSpec(in.Route)
 	}
 	out.Env = copyObjectSlice(in.Env)
 	out.EnvFrom = copyObjectSlice(in.EnvFrom)
@@ -356,6 +581,113 @@ func copyWebApplicationSpec(in WebApplicationSpec) WebApplicationSpec {
 	out.Resources = copyConfig(in.Resources)
 	out.PodSecurityContext = copyConfig(in.PodSecurityContext)
 	out.SecurityContext = copyConfig(in.SecurityContext)
+	out.InitContainers = copyContainerSpecs(in.InitContainers)
+	out.Sidecars = copyContainerSpecs(in.Sidecars)
+	if in.Canary != nil {
+		canary := *in.Canary
+		canary.Replicas = copyInt32Pointer(in.Canary.Replicas)
+		out.Canary = &canary
+	}
+	out.Availability = copyAvailabilitySpec(in.Availability)
+	out.Bindings = copyBindingSpecs(in.Bindings)
+	if in.ConfigFiles != nil {
+		out.ConfigFiles = append([]ConfigFileSpec(nil), in.ConfigFiles...)
+	}
+	if in.Persistence != nil {
+		out.Persistence = append([]PersistenceSpec(nil), in.Persistence...)
+	}
+	return out
+}
+
+func copyRouteSpec(in *RouteSpec) *RouteSpec {
+	out := &RouteSpec{
+		Enabled:          copyBoolPointer(in.Enabled),
+		GatewayName:      in.GatewayName,
+		GatewayNamespace: in.GatewayNamespace,
+		TLS:              in.TLS,
+	}
+	if in.Hosts != nil {
+		out.Hosts = append([]string(nil), in.Hosts...)
+	}
+	if in.Rules != nil {
+		out.Rules = make([]RouteRule, len(in.Rules))
+		for index, rule := range in.Rules {
+			out.Rules[index] = copyRouteRule(rule)
+		}
+	}
+	if in.Timeouts != nil {
+		timeouts := *in.Timeouts
+		out.Timeouts = &timeouts
+	}
+	return out
+}
+
+func copyRouteRule(in RouteRule) RouteRule {
+	out := RouteRule{}
+	if in.Path != nil {
+		path := *in.Path
+		out.Path = &path
+	}
+	if in.Method != nil {
+		method := *in.Method
+		out.Method = &method
+	}
+	if in.Headers != nil {
+		out.Headers = append([]RouteHeaderMatch(nil), in.Headers...)
+	}
+	out.RequestHeaders = copyRouteHeaderModifier(in.RequestHeaders)
+	out.ResponseHeaders = copyRouteHeaderModifier(in.ResponseHeaders)
+	if in.Rewrite != nil {
+		rewrite := *in.Rewrite
+		out.Rewrite = &rewrite
+	}
+	if in.Redirect != nil {
+		redirect := *in.Redirect
+		redirect.Port = copyInt32Pointer(in.Redirect.Port)
+		out.Redirect = &redirect
+	}
+	return out
+}
+
+func copyRouteHeaderModifier(in *RouteHeaderModifier) *RouteHeaderModifier {
+	if in == nil {
+		return nil
+	}
+	out := &RouteHeaderModifier{}
+	if in.Set != nil {
+		out.Set = append([]RouteHeader(nil), in.Set...)
+	}
+	if in.Add != nil {
+		out.Add = append([]RouteHeader(nil), in.Add...)
+	}
+	if in.Remove != nil {
+		out.Remove = append([]string(nil), in.Remove...)
+	}
+	return out
+}
+
+func copyContainerSpecs(in []ContainerSpec) []ContainerSpec {
+	if in == nil {
+		return nil
+	}
+	out := make([]ContainerSpec, len(in))
+	for index, container := range in {
+		out[index] = container
+		if container.Command != nil {
+			out[index].Command = append([]string(nil), container.Command...)
+		}
+		if container.Args != nil {
+			out[index].Args = append([]string(nil), container.Args...)
+		}
+		if container.Ports != nil {
+			out[index].Ports = append([]ContainerPort(nil), container.Ports...)
+		}
+		out[index].Env = copyObjectSlice(container.Env)
+		out[index].EnvFrom = copyObjectSlice(container.EnvFrom)
+		out[index].Resources = copyConfig(container.Resources)
+		out[index].SecurityContext = copyConfig(container.SecurityContext)
+		out[index].VolumeMounts = copyObjectSlice(container.VolumeMounts)
+	}
 	return out
 }
 
@@ -437,6 +769,47 @@ func copyWorkloadSpec(in WorkloadSpec) WorkloadSpec {
 	out.Resources = copyConfig(in.Resources)
 	out.PodSecurityContext = copyConfig(in.PodSecurityContext)
 	out.SecurityContext = copyConfig(in.SecurityContext)
+	out.InitContainers = copyContainerSpecs(in.InitContainers)
+	out.Sidecars = copyContainerSpecs(in.Sidecars)
+	out.Availability = copyAvailabilitySpec(in.Availability)
+	out.Bindings = copyBindingSpecs(in.Bindings)
+	if in.ConfigFiles != nil {
+		out.ConfigFiles = append([]ConfigFileSpec(nil), in.ConfigFiles...)
+	}
+	if in.Persistence != nil {
+		out.Persistence = append([]PersistenceSpec(nil), in.Persistence...)
+	}
+	return out
+}
+
+func copyAvailabilitySpec(in *AvailabilitySpec) *AvailabilitySpec {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.MinAvailable != nil {
+		minAvailable := *in.MinAvailable
+		out.MinAvailable = &minAvailable
+	}
+	if in.MaxUnavailable != nil {
+		maxUnavailable := *in.MaxUnavailable
+		out.MaxUnavailable = &maxUnavailable
+	}
+	return &out
+}
+
+func copyBindingSpecs(in []BindingSpec) []BindingSpec {
+	if in == nil {
+		return nil
+	}
+	out := make([]BindingSpec, len(in))
+	for index, binding := range in {
+		out[index] = binding
+		out[index].PostgreSQL = copyBoolPointer(binding.PostgreSQL)
+		if binding.Topics != nil {
+			out[index].Topics = append([]string(nil), binding.Topics...)
+		}
+	}
 	return out
 }
 
@@ -468,9 +841,51 @@ func copyWorkspace(in *Workspace) *Workspace {
 	out := new(Workspace)
 	*out = *in
 	copyObjectMeta(&in.ObjectMeta, &out.ObjectMeta)
+	out.Spec = copyWorkspaceSpec(in.Spec)
+	return out
+}
+
+func copyWorkspaceSpec(in WorkspaceSpec) WorkspaceSpec {
+	out := in
+	if in.Quota != nil {
+		out.Quota = &WorkspaceQuota{
+			CPU:                    in.Quota.CPU,
+			Memory:                 in.Quota.Memory,
+			Storage:                in.Quota.Storage,
+			Pods:                   copyInt32Pointer(in.Quota.Pods),
+			Services:               copyInt32Pointer(in.Quota.Services),
+			PersistentVolumeClaims: copyInt32Pointer(in.Quota.PersistentVolumeClaims),
+			ConfigMaps:             copyInt32Pointer(in.Quota.ConfigMaps),
+			Secrets:                copyInt32Pointer(in.Quota.Secrets),
+		}
+	}
+	if in.Defaults != nil {
+		out.Defaults = &WorkspaceDefaults{
+			Requests: copyWorkspaceResources(in.Defaults.Requests),
+			Limits:   copyWorkspaceResources(in.Defaults.Limits),
+		}
+	}
+	if in.Members != nil {
+		out.Members = append([]WorkspaceMember(nil), in.Members...)
+	}
+	if in.AllowFrom != nil {
+		out.AllowFrom = make([]WorkspaceGrant, len(in.AllowFrom))
+		for index, grant := range in.AllowFrom {
+			grant.Ports = append([]int32(nil), grant.Ports...)
+			out.AllowFrom[index] = grant
+		}
+	}
 	return out
 }
 
+func copyWorkspaceResources(in *WorkspaceResources) *WorkspaceResources {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	return &out
+}
+
 func copyObjectMeta(in *v1.ObjectMeta, out *v1.ObjectMeta) {
 	in.DeepCopyInto(out)
 }